@@ -0,0 +1,50 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+
+	envstruct "code.cloudfoundry.org/go-envstruct"
+	"github.com/knative/observability/pkg/sink"
+)
+
+type config struct {
+	ConfigDir string `env:"CONFIG_DIR,report"`
+	Port      string `env:"PORT,report"`
+}
+
+func main() {
+	conf := config{
+		ConfigDir: "/fluent-bit/etc",
+		Port:      "2021",
+	}
+	err := envstruct.Load(&conf)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = envstruct.WriteReport(&conf)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	log.Fatal(http.ListenAndServe(
+		net.JoinHostPort("", conf.Port),
+		sink.NewConfigHashHandler(conf.ConfigDir),
+	))
+}
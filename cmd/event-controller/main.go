@@ -16,34 +16,99 @@ limitations under the License.
 package main
 
 import (
+	"crypto/tls"
 	_ "expvar"
+	"io"
+	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
+	"os"
 	"time"
 
 	"code.cloudfoundry.org/go-envstruct"
+	eventsv1beta1 "k8s.io/api/events/v1beta1"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 
 	"github.com/fluent/fluent-logger-golang/fluent"
 	"github.com/knative/observability/pkg/event"
+	"github.com/knative/observability/pkg/leader"
 	"github.com/knative/pkg/signals"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type config struct {
-	Host        string `env:"FORWARDER_HOST,required,report"`
-	MetricsPort string `env:"METRICS_PORT,report"`
-	BufferLimit int    `env:"SEND_BUFFER_SIZE,report"`
+	// EventsAPI selects the events that are watched: v1 (the default) for
+	// the core API, or events.k8s.io/v1 or events.k8s.io/v1beta1 for the
+	// events API, which has series, actions and related objects.
+	EventsAPI string `env:"EVENTS_API,report"`
+
+	// Forwarder selects where events are sent: fluent (the default) sends
+	// them to fluent-bit at Host, webhook posts them as JSON to URL,
+	// cloudevents posts them as CloudEvents in CloudEventsMode to URL,
+	// syslog sends them to SyslogAddr and stdout writes them as JSON lines.
+	Forwarder       string `env:"FORWARDER,report"`
+	Host            string `env:"FORWARDER_HOST,report"`
+	URL             string `env:"FORWARDER_URL,report"`
+	CloudEventsMode string `env:"CLOUDEVENTS_MODE,report"`
+	SyslogAddr      string `env:"SYSLOG_ADDR,report"`
+	SyslogTLS       bool   `env:"SYSLOG_TLS,report"`
+	MetricsPort     string `env:"METRICS_PORT,report"`
+	BufferLimit     int    `env:"SEND_BUFFER_SIZE,report"`
+
+	// Filter holds event filter rules in YAML or JSON. FilterFile names a
+	// file with them instead, such as a key of a mounted ConfigMap. Changes
+	// to the file take effect on restart.
+	Filter     string `env:"EVENT_FILTER,report"`
+	FilterFile string `env:"EVENT_FILTER_FILE,report"`
+
+	// CheckpointConfigMap names the ConfigMap in Namespace where forwarded
+	// events are checkpointed, so they are not forwarded again after a
+	// restart. It is saved every CheckpointInterval. Events are remembered
+	// for CheckpointTTL, which should be at least the --event-ttl of the
+	// API server, and at most CheckpointMaxEntries are remembered.
+	Namespace            string        `env:"NAMESPACE,report"`
+	CheckpointConfigMap  string        `env:"CHECKPOINT_CONFIGMAP,report"`
+	CheckpointInterval   time.Duration `env:"CHECKPOINT_INTERVAL,report"`
+	CheckpointTTL        time.Duration `env:"CHECKPOINT_TTL,report"`
+	CheckpointMaxEntries int           `env:"CHECKPOINT_MAX_ENTRIES,report"`
+
+	// Storm protection limits the events forwarded per second from each
+	// namespace and involved object, and collapses repeated reasons of an
+	// object within StormWindow. Zero disables each of them. Collapsed
+	// events and summaries of suppressed events are sent every
+	// StormFlushInterval.
+	StormNamespaceRate  float64       `env:"STORM_NAMESPACE_RATE,report"`
+	StormNamespaceBurst int           `env:"STORM_NAMESPACE_BURST,report"`
+	StormObjectRate     float64       `env:"STORM_OBJECT_RATE,report"`
+	StormObjectBurst    int           `env:"STORM_OBJECT_BURST,report"`
+	StormWindow         time.Duration `env:"STORM_WINDOW,report"`
+	StormFlushInterval  time.Duration `env:"STORM_FLUSH_INTERVAL,report"`
+
+	// LeaderElection forwards events from a single replica, elected with
+	// a Lease in Namespace. Only the leader is ready.
+	LeaderElection bool `env:"LEADER_ELECTION,report"`
 }
 
 func main() {
 	stopCh := signals.SetupSignalHandler()
 
 	conf := config{
-		MetricsPort: "6060",
-		BufferLimit: 8 * 1024, // this is the default in fluent-logger-golang
+		Forwarder:       "fluent",
+		EventsAPI:       "v1",
+		CloudEventsMode: string(event.CloudEventsBinary),
+		MetricsPort:     "6060",
+		BufferLimit:     8 * 1024, // this is the default in fluent-logger-golang
+
+		CheckpointInterval:   10 * time.Second,
+		CheckpointTTL:        event.DefaultCheckpointTTL,
+		CheckpointMaxEntries: event.DefaultCheckpointMaxEntries,
+		StormFlushInterval:   10 * time.Second,
+		LeaderElection:       true,
 	}
 	err := envstruct.Load(&conf)
 	if err != nil {
@@ -54,10 +119,6 @@ func main() {
 		log.Fatal(err.Error())
 	}
 
-	go func() {
-		log.Fatal(http.ListenAndServe(net.JoinHostPort("", conf.MetricsPort), nil))
-	}()
-
 	cfg, err := rest.InClusterConfig()
 	if err != nil {
 		log.Fatal(err.Error())
@@ -68,27 +129,196 @@ func main() {
 		log.Fatal(err.Error())
 	}
 
-	f, err := fluent.New(fluent.Config{
-		FluentHost:   conf.Host,
-		WriteTimeout: time.Millisecond * 500,
-		Async:        true,
-		BufferLimit:  conf.BufferLimit,
+	elector := newElector(cfg, conf)
+	// expvar serves /debug/vars on the same port.
+	http.Handle("/ready", elector)
+	http.Handle("/metrics", promhttp.Handler())
+	go func() {
+		log.Fatal(http.ListenAndServe(net.JoinHostPort("", conf.MetricsPort), nil))
+	}()
+
+	f := forwarder(conf)
+	if closer, ok := f.(io.Closer); ok {
+		defer func() {
+			if err := closer.Close(); err != nil {
+				log.Fatalf("error closing forwarder: %s\n", err)
+			}
+		}()
+	}
+
+	opts := []event.ControllerOpt{
+		event.WithMetrics(prometheus.DefaultRegisterer),
+	}
+	if filter := loadFilter(conf); filter != nil {
+		opts = append(opts, event.WithFilter(filter))
+	}
+	var checkpoint *event.Checkpoint
+	if conf.CheckpointConfigMap != "" {
+		checkpoint = event.NewCheckpoint(
+			kclientset.CoreV1().ConfigMaps(conf.Namespace),
+			conf.CheckpointConfigMap,
+			event.WithCheckpointTTL(conf.CheckpointTTL),
+			event.WithCheckpointMaxEntries(conf.CheckpointMaxEntries),
+		)
+		opts = append(opts, event.WithCheckpoint(checkpoint))
+	}
+	stormConfig := event.StormConfig{
+		NamespaceRate:  conf.StormNamespaceRate,
+		NamespaceBurst: conf.StormNamespaceBurst,
+		ObjectRate:     conf.StormObjectRate,
+		ObjectBurst:    conf.StormObjectBurst,
+		Window:         conf.StormWindow,
+	}
+	if stormConfig != (event.StormConfig{}) {
+		opts = append(opts, event.WithStormGuard(event.NewStormGuard(stormConfig)))
+	}
+	controller := event.NewController(f, opts...)
+
+	eventInformer := informer(conf, cfg, kclientset)
+	eventInformer.AddEventHandler(controller)
+
+	err = elector.Run(stopCh, func(stopCh <-chan struct{}) {
+		// The checkpoint is loaded once leading, so it has the events
+		// forwarded by the previous leader.
+		if checkpoint != nil {
+			if err := checkpoint.Load(); err != nil {
+				log.Fatalf("unable to load checkpoint: %s", err)
+			}
+			go checkpoint.Run(conf.CheckpointInterval, stopCh)
+		}
+		go controller.Run(conf.StormFlushInterval, stopCh)
+
+		eventInformer.Run(stopCh)
+
+		if checkpoint != nil {
+			if err := checkpoint.Save(time.Now()); err != nil {
+				log.Printf("unable to save checkpoint: %s\n", err)
+			}
+		}
 	})
 	if err != nil {
-		log.Fatalf("unable to create fluent logger client: %s", err)
+		log.Fatal(err.Error())
+	}
+}
+
+// newElector creates the elector of the event-controller lease, so events
+// are forwarded once. It is nil when leader election is disabled.
+func newElector(cfg *rest.Config, conf config) *leader.Elector {
+	if !conf.LeaderElection {
+		return nil
+	}
+	if conf.Namespace == "" {
+		log.Fatal("NAMESPACE is required for leader election")
 	}
-	defer func() {
-		if err := f.Close(); err != nil {
-			log.Fatalf("error closing fluent connection: %s\n", err)
-		}
-	}()
 
-	controller := event.NewController(f)
+	client, err := leader.NewLeaseClient(cfg, conf.Namespace)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
 
+	return leader.NewElector(client, "event-controller", hostname)
+}
+
+// informer creates the informer of the configured events API.
+func informer(conf config, cfg *rest.Config, kclientset kubernetes.Interface) cache.SharedIndexInformer {
 	informerFactory := informers.NewSharedInformerFactory(kclientset, 30*time.Second)
 
-	eventInformer := informerFactory.Core().V1().Events().Informer()
-	eventInformer.AddEventHandler(controller)
+	switch conf.EventsAPI {
+	case "v1":
+		return informerFactory.Core().V1().Events().Informer()
+	case "events.k8s.io/v1beta1":
+		return informerFactory.Events().V1beta1().Events().Informer()
+	case event.EventsV1.String():
+		lw, err := event.NewEventsV1ListWatch(cfg)
+		if err != nil {
+			log.Fatalf("unable to create events.k8s.io/v1 client: %s", err)
+		}
+		return cache.NewSharedIndexInformer(lw, &eventsv1beta1.Event{}, 30*time.Second, cache.Indexers{})
+	default:
+		log.Fatalf("unknown events API %q, should be one of v1, events.k8s.io/v1 or events.k8s.io/v1beta1", conf.EventsAPI)
+		return nil
+	}
+}
+
+// forwarder creates the configured forwarder.
+// forwarder buffers records for the configured forwarder, so the informer
+// handlers never wait on a destination.
+func forwarder(conf config) event.Forwarder {
+	return event.NewBufferedForwarder(newForwarder(conf), conf.BufferLimit, prometheus.DefaultRegisterer)
+}
 
-	eventInformer.Run(stopCh)
+func newForwarder(conf config) event.Forwarder {
+	switch conf.Forwarder {
+	case "fluent":
+		if conf.Host == "" {
+			log.Fatal("FORWARDER_HOST is required for the fluent forwarder")
+		}
+		// The client sends synchronously, so the buffer can count the
+		// records it sent.
+		f, err := fluent.New(fluent.Config{
+			FluentHost:   conf.Host,
+			WriteTimeout: time.Millisecond * 500,
+		})
+		if err != nil {
+			log.Fatalf("unable to create fluent logger client: %s", err)
+		}
+		return f
+	case "webhook":
+		if conf.URL == "" {
+			log.Fatal("FORWARDER_URL is required for the webhook forwarder")
+		}
+		return event.NewWebhookForwarder(conf.URL, &http.Client{Timeout: 5 * time.Second})
+	case "cloudevents":
+		if conf.URL == "" {
+			log.Fatal("FORWARDER_URL is required for the cloudevents forwarder")
+		}
+		mode := event.CloudEventsMode(conf.CloudEventsMode)
+		if mode != event.CloudEventsBinary && mode != event.CloudEventsStructured {
+			log.Fatalf("unknown CloudEvents mode %q, should be binary or structured", mode)
+		}
+		return event.NewCloudEventsForwarder(conf.URL, &http.Client{Timeout: 5 * time.Second}, mode)
+	case "syslog":
+		if conf.SyslogAddr == "" {
+			log.Fatal("SYSLOG_ADDR is required for the syslog forwarder")
+		}
+		var tlsConfig *tls.Config
+		if conf.SyslogTLS {
+			tlsConfig = &tls.Config{}
+		}
+		return event.NewSyslogForwarder(conf.SyslogAddr, tlsConfig)
+	case "stdout":
+		return event.NewJSONLinesForwarder(os.Stdout)
+	default:
+		log.Fatalf("unknown forwarder %q, should be one of fluent, webhook, cloudevents, syslog or stdout", conf.Forwarder)
+		return nil
+	}
+}
+
+// loadFilter reads the filter from the environment or the filter file. A
+// missing file means no filter, so the ConfigMap can be optional.
+func loadFilter(conf config) *event.Filter {
+	data := []byte(conf.Filter)
+	if conf.FilterFile != "" {
+		var err error
+		data, err = ioutil.ReadFile(conf.FilterFile)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			log.Fatalf("unable to read event filter: %s", err)
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	filter, err := event.ParseFilter(data)
+	if err != nil {
+		log.Fatalf("invalid event filter: %s", err)
+	}
+	return filter
 }
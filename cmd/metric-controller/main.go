@@ -18,11 +18,16 @@ package main
 import (
 	"flag"
 	"log"
+	"net"
+	"net/http"
+	"os"
 	"time"
 
 	envstruct "code.cloudfoundry.org/go-envstruct"
 	"github.com/knative/observability/pkg/client/clientset/versioned"
 	informers "github.com/knative/observability/pkg/client/informers/externalversions"
+	"github.com/knative/observability/pkg/debug"
+	"github.com/knative/observability/pkg/leader"
 	"github.com/knative/observability/pkg/metric"
 	"github.com/knative/pkg/signals"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -35,13 +40,20 @@ import (
 type config struct {
 	Namespace                 string `env:"NAMESPACE,required,report"`
 	UseInsecureKubernetesPort bool   `env:"USE_INSECURE_KUBERNETES_PORT,report"`
+	DebugPort                 string `env:"DEBUG_PORT,report"`
+	DebugAddr                 string `env:"DEBUG_ADDR,report"`
+	LeaderElection            bool   `env:"LEADER_ELECTION,report"`
 }
 
 func main() {
 	flag.Parse()
 	stopCh := signals.SetupSignalHandler()
 
-	var conf config
+	conf := config{
+		DebugPort:      "6060",
+		DebugAddr:      "localhost:6061",
+		LeaderElection: true,
+	}
 	err := envstruct.Load(&conf)
 	if err != nil {
 		log.Fatal(err.Error())
@@ -71,6 +83,8 @@ func main() {
 		log.Fatal(err.Error())
 	}
 
+	elector := newElector(cfg, conf)
+
 	nodes, err := coreV1Client.Nodes().List(metav1.ListOptions{})
 	if err != nil {
 		log.Fatal(err.Error())
@@ -95,6 +109,26 @@ func main() {
 		k8sClient.RbacV1(),
 	)
 
+	mux := http.NewServeMux()
+	authorizer := debug.NewAuthorizer(
+		k8sClient.AuthenticationV1().TokenReviews(),
+		k8sClient.AuthorizationV1().SubjectAccessReviews(),
+		"metricsinks",
+		"clustermetricsinks",
+	)
+	mux.Handle("/ready", elector)
+	go func() {
+		log.Fatal(http.ListenAndServe(net.JoinHostPort("", conf.DebugPort), mux))
+	}()
+
+	// The config is only served on localhost so bearer tokens never cross
+	// the network in plain text. It is reached with kubectl port-forward.
+	debugMux := http.NewServeMux()
+	debugMux.Handle("/debug/config", authorizer.Wrap(elector.Wrap(metric.NewDebugHandler(metricSinkConfig, msController))))
+	go func() {
+		log.Fatal(http.ListenAndServe(conf.DebugAddr, debugMux))
+	}()
+
 	sinkInformerFactory := informers.NewSharedInformerFactory(client, time.Second*30)
 
 	cmsInformer := sinkInformerFactory.Observability().V1alpha1().ClusterMetricSinks().Informer()
@@ -103,6 +137,31 @@ func main() {
 	msInformer := sinkInformerFactory.Observability().V1alpha1().MetricSinks().Informer()
 	msInformer.AddEventHandler(msController)
 
-	go msInformer.Run(stopCh)
-	cmsInformer.Run(stopCh)
+	err = elector.Run(stopCh, func(stopCh <-chan struct{}) {
+		go msInformer.Run(stopCh)
+		cmsInformer.Run(stopCh)
+	})
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
+
+// newElector creates the elector of the metric-controller lease, so only
+// one replica writes the telegraf ConfigMaps and deployments. It is nil
+// when leader election is disabled.
+func newElector(cfg *rest.Config, conf config) *leader.Elector {
+	if !conf.LeaderElection {
+		return nil
+	}
+
+	client, err := leader.NewLeaseClient(cfg, conf.Namespace)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return leader.NewElector(client, "metric-controller", hostname)
 }
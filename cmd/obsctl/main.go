@@ -0,0 +1,193 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/knative/observability/pkg/apis/sink/v1alpha1"
+	"github.com/knative/observability/pkg/client/clientset/versioned/scheme"
+	"github.com/knative/observability/pkg/metric"
+	"github.com/knative/observability/pkg/sink"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const usage = `Usage: obsctl render [flags] FILE...
+
+Renders the fluent-bit and telegraf config for the LogSink, ClusterLogSink,
+LogParser, MetricSink and ClusterMetricSink resources in the given YAML files.
+
+Flags:
+`
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 || os.Args[1] != "render" {
+		fmt.Fprint(os.Stderr, usage)
+		newRenderFlags().PrintDefaults()
+		os.Exit(2)
+	}
+
+	err := render(os.Args[2:], os.Stdout)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
+
+type renderFlags struct {
+	*flag.FlagSet
+
+	clusterName  string
+	namespace    string
+	insecurePort bool
+}
+
+func newRenderFlags() *renderFlags {
+	f := &renderFlags{
+		FlagSet: flag.NewFlagSet("render", flag.ContinueOnError),
+	}
+	f.StringVar(&f.clusterName, "cluster-name", "", "cluster name added to the telegraf global tags")
+	f.StringVar(&f.namespace, "namespace", "default", "namespace for namespaced resources that do not set one")
+	f.BoolVar(&f.insecurePort, "insecure-kubernetes-port", false, "use the insecure kubelet port for the kubernetes input")
+	return f
+}
+
+// resources are the sink resources read from the given files, in the order
+// they were read.
+type resources struct {
+	logSinks           []*v1alpha1.LogSink
+	clusterLogSinks    []*v1alpha1.ClusterLogSink
+	logParsers         []*v1alpha1.LogParser
+	metricSinks        []*v1alpha1.MetricSink
+	clusterMetricSinks []*v1alpha1.ClusterMetricSink
+}
+
+func render(args []string, w io.Writer) error {
+	f := newRenderFlags()
+	f.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		f.PrintDefaults()
+	}
+	err := f.Parse(args)
+	if err != nil {
+		return err
+	}
+	if f.NArg() == 0 {
+		f.Usage()
+		return fmt.Errorf("no files given")
+	}
+
+	var res resources
+	for _, path := range f.Args() {
+		err := res.readFile(path, f.namespace)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+	}
+
+	sc := sink.NewConfig()
+	for _, s := range res.logSinks {
+		sc.UpsertSink(s)
+	}
+	for _, s := range res.clusterLogSinks {
+		sc.UpsertClusterSink(s)
+	}
+	for _, p := range res.logParsers {
+		sc.UpsertParser(p)
+	}
+
+	cc := metric.NewConfig(f.clusterName, metric.KubernetesDefault(f.insecurePort))
+	for _, s := range res.clusterMetricSinks {
+		cc.UpsertSink(*s)
+	}
+
+	snap := sc.Snapshot()
+	printSection(w, "fluent-bit outputs.conf", snap.Outputs)
+	printSection(w, "fluent-bit namespace-filters.conf", snap.Filters)
+	printSection(w, "fluent-bit namespace-parsers.conf", snap.Parsers)
+	printSection(w, "telegraf cluster-metric-sinks.conf", cc.String())
+	for _, s := range res.metricSinks {
+		printSection(
+			w,
+			fmt.Sprintf("telegraf metric-sinks.conf for MetricSink %s/%s", s.Namespace, s.Name),
+			metric.MetricSinkConfig(f.clusterName, s),
+		)
+	}
+
+	return nil
+}
+
+func (r *resources) readFile(path, namespace string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := yaml.NewYAMLReader(bufio.NewReader(file))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+
+		obj, gvk, err := scheme.Codecs.UniversalDeserializer().Decode(doc, nil, nil)
+		if err != nil {
+			return err
+		}
+
+		switch o := obj.(type) {
+		case *v1alpha1.LogSink:
+			if o.Namespace == "" {
+				o.Namespace = namespace
+			}
+			r.logSinks = append(r.logSinks, o)
+		case *v1alpha1.ClusterLogSink:
+			r.clusterLogSinks = append(r.clusterLogSinks, o)
+		case *v1alpha1.LogParser:
+			if o.Namespace == "" {
+				o.Namespace = namespace
+			}
+			r.logParsers = append(r.logParsers, o)
+		case *v1alpha1.MetricSink:
+			if o.Namespace == "" {
+				o.Namespace = namespace
+			}
+			r.metricSinks = append(r.metricSinks, o)
+		case *v1alpha1.ClusterMetricSink:
+			r.clusterMetricSinks = append(r.clusterMetricSinks, o)
+		default:
+			return fmt.Errorf("unsupported kind %s", gvk.Kind)
+		}
+	}
+}
+
+func printSection(w io.Writer, title, config string) {
+	fmt.Fprintf(w, "### %s\n%s\n", title, config)
+}
@@ -0,0 +1,277 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runMainEnv makes the test binary run main instead of the tests, so exit
+// codes can be checked.
+const runMainEnv = "OBSCTL_TEST_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) != "" {
+		os.Args = append([]string{"obsctl"}, os.Args[1:]...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fixtures are the files in test/crd with what rendering them gives. The
+// invalid fixtures that render are rejected by the CRD schema in the API
+// server, which obsctl does not check.
+var fixtures = []struct {
+	path     string
+	exitCode int
+	contains string
+}{
+	{"valid/cluster-metric-sink-missing-inputs.yaml", 0, "[[inputs.kubernetes]]"},
+	{"valid/cluster-metric-sink.yaml", 0, `commands = ["echo 5"]`},
+	{"valid/cluster-syslog-hostname.yaml", 0, "Addr example.com:12343\n    Cluster true"},
+	{"valid/cluster-webhook.yaml", 0, "Name http\n    Match *\n"},
+	{"valid/log-parser-regex.yaml", 0, "Name default.valid-regex-parser"},
+	{"valid/metric-sink-missing-inputs.yaml", 0, `monitor_kubernetes_pods_namespace = "default"`},
+	{"valid/metric-sink.yaml", 0, "### telegraf metric-sinks.conf for MetricSink default/"},
+	{"valid/syslog-high-port.yaml", 0, "Addr example.com:65535"},
+	{"valid/syslog-hostname.yaml", 0, "Addr example.com:12345\n    Namespace default"},
+	{"valid/syslog-ipv4-address.yaml", 0, "Addr 127.0.0.1:12345"},
+	{"valid/syslog-ipv6-address.yaml", 0, "Addr :::12345"},
+	{"valid/syslog-low-port.yaml", 0, "Addr example.com:1\n"},
+	{"valid/syslog-multiline.yaml", 0, "Name multiline\n    Match kube.*_default_*"},
+	{"valid/syslog-parser.yaml", 0, "InstanceName valid-syslog-parser"},
+	{"valid/syslog-tls-insecure.yaml", 0, `TLSConfig {"insecure_skip_verify":true}`},
+	{"valid/webhook.yaml", 0, "URI /test\n    tls On"},
+
+	{"invalid/cluster-metric-sink-invalid-datadog-config.yaml", 0, `commands = ["echo", "5"]`},
+	{"invalid/cluster-metric-sink-missing-outputs.yaml", 0, "### telegraf cluster-metric-sinks.conf"},
+	{"invalid/cluster-syslog-host-type.yaml", 1, "Host: ReadString"},
+	{"invalid/log-parser-format.yaml", 0, "Format xml"},
+	{"invalid/metric-sink-invalid-datadog-config.yaml", 0, `commands = ["echo", "5"]`},
+	{"invalid/no-drain-type.yaml", 0, "### fluent-bit outputs.conf"},
+	{"invalid/pending-syslog-bad-hostname.yaml", 0, "Addr example/com:12345"},
+	{"invalid/pending-syslog-bad-ipv6-address.yaml", 0, "Addr zz:::12345"},
+	{"invalid/sink-type.yaml", 0, "### fluent-bit outputs.conf"},
+	{"invalid/syslog-high-port.yaml", 0, "Addr example.com:70000"},
+	{"invalid/syslog-host-type.yaml", 1, "Host: ReadString"},
+	{"invalid/syslog-low-port.yaml", 0, "Addr example.com:0"},
+	{"invalid/syslog-multiline-preset.yaml", 0, "Name multiline"},
+	{"invalid/syslog-no-host.yaml", 0, "Addr :12345"},
+	{"invalid/syslog-no-port.yaml", 0, "Addr example.com:0"},
+	{"invalid/syslog-no-tls.yaml", 0, "InstanceName invalid-syslog-no-tls"},
+	{"invalid/syslog-port-type.yaml", 1, "Port: readUint64"},
+	{"invalid/syslog-tls-insecure.yaml", 1, "InsecureSkipVerify: ReadBool"},
+	{"invalid/syslog-tls.yaml", 1, "EnableTLS: ReadBool"},
+	{"invalid/webhook-no-tls.yaml", 0, "Port 80\n    URI /test\n"},
+	{"invalid/webhook-no-url.yaml", 0, "Name http"},
+}
+
+func fixturePath(name string) string {
+	return filepath.Join("..", "..", "test", "crd", name)
+}
+
+func TestFixturesCoverTestCRDs(t *testing.T) {
+	paths, err := filepath.Glob(fixturePath("*/*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	known := make(map[string]bool)
+	for _, f := range fixtures {
+		known[fixturePath(f.path)] = true
+	}
+	for _, p := range paths {
+		if !known[p] {
+			t.Errorf("%s is not in the fixtures table", p)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	for _, f := range fixtures {
+		t.Run(f.path, func(t *testing.T) {
+			var out bytes.Buffer
+			err := render([]string{fixturePath(f.path)}, &out)
+
+			if f.exitCode != 0 {
+				if err == nil {
+					t.Fatalf("expected an error, got output:\n%s", out.String())
+				}
+				if !strings.HasPrefix(err.Error(), fixturePath(f.path)+": ") {
+					t.Errorf("expected the error to name the file, got %q", err)
+				}
+				if !strings.Contains(err.Error(), f.contains) {
+					t.Errorf("expected the error to contain %q, got %q", f.contains, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for _, title := range []string{
+				"### fluent-bit outputs.conf\n",
+				"### fluent-bit namespace-filters.conf\n",
+				"### fluent-bit namespace-parsers.conf\n",
+				"### telegraf cluster-metric-sinks.conf\n",
+			} {
+				if !strings.Contains(out.String(), title) {
+					t.Errorf("expected section %q in output:\n%s", title, out.String())
+				}
+			}
+			if !strings.Contains(out.String(), f.contains) {
+				t.Errorf("expected %q in output:\n%s", f.contains, out.String())
+			}
+		})
+	}
+}
+
+func TestRenderWithoutFiles(t *testing.T) {
+	err := render(nil, &bytes.Buffer{})
+	if err == nil || err.Error() != "no files given" {
+		t.Fatalf("expected no files error, got %v", err)
+	}
+}
+
+func TestRenderFlags(t *testing.T) {
+	var out bytes.Buffer
+	err := render([]string{
+		"-namespace", "other",
+		"-cluster-name", "some-cluster",
+		fixturePath("valid/metric-sink.yaml"),
+	}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{
+		"### telegraf metric-sinks.conf for MetricSink other/",
+		`cluster_name = "some-cluster"`,
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected %q in output:\n%s", s, out.String())
+		}
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	tests := []struct {
+		path               string
+		logSinks           int
+		clusterLogSinks    int
+		logParsers         int
+		metricSinks        int
+		clusterMetricSinks int
+	}{
+		{path: "valid/syslog-hostname.yaml", logSinks: 1},
+		{path: "valid/cluster-syslog-hostname.yaml", clusterLogSinks: 1},
+		{path: "valid/log-parser-regex.yaml", logParsers: 1},
+		{path: "valid/metric-sink.yaml", metricSinks: 1},
+		{path: "valid/cluster-metric-sink.yaml", clusterMetricSinks: 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.path, func(t *testing.T) {
+			var r resources
+			err := r.readFile(fixturePath(tc.path), "some-namespace")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(r.logSinks) != tc.logSinks ||
+				len(r.clusterLogSinks) != tc.clusterLogSinks ||
+				len(r.logParsers) != tc.logParsers ||
+				len(r.metricSinks) != tc.metricSinks ||
+				len(r.clusterMetricSinks) != tc.clusterMetricSinks {
+				t.Fatalf("unexpected resources read: %+v", r)
+			}
+
+			for _, s := range r.logSinks {
+				if s.Namespace != "some-namespace" {
+					t.Errorf("expected namespace some-namespace on %s, got %q", s.Name, s.Namespace)
+				}
+			}
+			for _, p := range r.logParsers {
+				if p.Namespace != "some-namespace" {
+					t.Errorf("expected namespace some-namespace on %s, got %q", p.Name, p.Namespace)
+				}
+			}
+			for _, s := range r.metricSinks {
+				if s.Namespace != "some-namespace" {
+					t.Errorf("expected namespace some-namespace on %s, got %q", s.Name, s.Namespace)
+				}
+			}
+		})
+	}
+}
+
+func TestReadFileErrors(t *testing.T) {
+	var r resources
+	err := r.readFile(fixturePath("valid/does-not-exist.yaml"), "default")
+	if !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+
+	err = r.readFile(fixturePath("invalid/syslog-port-type.yaml"), "default")
+	if err == nil {
+		t.Error("expected a decode error")
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	tests := []struct {
+		args     []string
+		exitCode int
+	}{
+		{nil, 2},
+		{[]string{"apply"}, 2},
+		{[]string{"render"}, 1},
+		{[]string{"render", "-unknown-flag"}, 1},
+	}
+	for _, f := range fixtures {
+		tests = append(tests, struct {
+			args     []string
+			exitCode int
+		}{[]string{"render", fixturePath(f.path)}, f.exitCode})
+	}
+
+	for _, tc := range tests {
+		t.Run(strings.Join(tc.args, " "), func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], tc.args...)
+			cmd.Env = append(os.Environ(), runMainEnv+"=1")
+			var stderr bytes.Buffer
+			cmd.Stderr = &stderr
+
+			err := cmd.Run()
+
+			exitCode := 0
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				exitCode = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if exitCode != tc.exitCode {
+				t.Errorf("expected exit code %d, got %d: %s", tc.exitCode, exitCode, stderr.String())
+			}
+		})
+	}
+}
@@ -18,27 +18,44 @@ package main
 import (
 	"flag"
 	"log"
+	"net"
+	"net/http"
+	"os"
 	"time"
 
 	envstruct "code.cloudfoundry.org/go-envstruct"
 	"github.com/knative/observability/pkg/client/clientset/versioned"
 	informers "github.com/knative/observability/pkg/client/informers/externalversions"
+	"github.com/knative/observability/pkg/debug"
+	"github.com/knative/observability/pkg/leader"
 	"github.com/knative/observability/pkg/sink"
 	"github.com/knative/pkg/signals"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 	coreV1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 )
 
 type config struct {
-	Namespace           string `env:"NAMESPACE,              required, report"`
+	Namespace      string        `env:"NAMESPACE,required,report"`
+	ReloadDelay    time.Duration `env:"RELOAD_DELAY,report"`
+	SyncTimeout    time.Duration `env:"SYNC_TIMEOUT,report"`
+	DebugPort      string        `env:"DEBUG_PORT,report"`
+	DebugAddr      string        `env:"DEBUG_ADDR,report"`
+	LeaderElection bool          `env:"LEADER_ELECTION,report"`
 }
 
 func main() {
 	flag.Parse()
 	stopCh := signals.SetupSignalHandler()
 
-	var conf config
+	conf := config{
+		ReloadDelay:    5 * time.Second,
+		SyncTimeout:    2 * time.Minute,
+		DebugPort:      "6060",
+		DebugAddr:      "localhost:6061",
+		LeaderElection: true,
+	}
 	err := envstruct.Load(&conf)
 	if err != nil {
 		log.Fatal(err.Error())
@@ -63,6 +80,13 @@ func main() {
 		log.Fatal(err.Error())
 	}
 
+	k8sClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	elector := newElector(cfg, conf)
+
 	nodes, err := coreV1Client.Nodes().List(metav1.ListOptions{})
 	if err != nil {
 		log.Fatal(err.Error())
@@ -72,22 +96,49 @@ func main() {
 	}
 	hostOverride := nodes.Items[0].Labels["pks-system/cluster.name"]
 
-	sink.SetClusterNameFilter(
+	reloader := sink.NewPodReloader(
 		coreV1Client.ConfigMaps(conf.Namespace),
 		coreV1Client.Pods(conf.Namespace),
-		hostOverride,
+		sink.WithSyncDelay(conf.ReloadDelay),
+		sink.WithSyncTimeout(conf.SyncTimeout),
 	)
 
 	sinkConfig := sink.NewConfig()
+
+	mux := http.NewServeMux()
+	authorizer := debug.NewAuthorizer(
+		k8sClient.AuthenticationV1().TokenReviews(),
+		k8sClient.AuthorizationV1().SubjectAccessReviews(),
+		"logsinks",
+		"clusterlogsinks",
+	)
+	mux.Handle("/ready", elector)
+	go func() {
+		log.Fatal(http.ListenAndServe(net.JoinHostPort("", conf.DebugPort), mux))
+	}()
+
+	// The config is only served on localhost so bearer tokens never cross
+	// the network in plain text. It is reached with kubectl port-forward.
+	debugMux := http.NewServeMux()
+	debugMux.Handle("/debug/config", authorizer.Wrap(elector.Wrap(sink.NewDebugHandler(sinkConfig))))
+	go func() {
+		log.Fatal(http.ListenAndServe(conf.DebugAddr, debugMux))
+	}()
 	controller := sink.NewController(
 		coreV1Client.ConfigMaps(conf.Namespace),
-		coreV1Client.Pods(conf.Namespace),
+		reloader,
 		sinkConfig,
 	)
 
 	clusterController := sink.NewClusterController(
 		coreV1Client.ConfigMaps(conf.Namespace),
-		coreV1Client.Pods(conf.Namespace),
+		reloader,
+		sinkConfig,
+	)
+
+	parserController := sink.NewParserController(
+		coreV1Client.ConfigMaps(conf.Namespace),
+		reloader,
 		sinkConfig,
 	)
 
@@ -99,6 +150,41 @@ func main() {
 	clusterSinkInformer := sinkInformerFactory.Observability().V1alpha1().ClusterLogSinks().Informer()
 	clusterSinkInformer.AddEventHandler(clusterController)
 
-	go sinkInformer.Run(stopCh)
-	clusterSinkInformer.Run(stopCh)
+	parserInformer := sinkInformerFactory.Observability().V1alpha1().LogParsers().Informer()
+	parserInformer.AddEventHandler(parserController)
+
+	err = elector.Run(stopCh, func(stopCh <-chan struct{}) {
+		sink.SetClusterNameFilter(
+			coreV1Client.ConfigMaps(conf.Namespace),
+			reloader,
+			hostOverride,
+		)
+
+		go parserInformer.Run(stopCh)
+		go sinkInformer.Run(stopCh)
+		clusterSinkInformer.Run(stopCh)
+	})
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
+
+// newElector creates the elector of the sink-controller lease, so only
+// one replica writes the fluent-bit ConfigMap. It is nil when leader
+// election is disabled.
+func newElector(cfg *rest.Config, conf config) *leader.Elector {
+	if !conf.LeaderElection {
+		return nil
+	}
+
+	client, err := leader.NewLeaseClient(cfg, conf.Namespace)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return leader.NewElector(client, "sink-controller", hostname)
 }
@@ -3,37 +3,260 @@ package main
 import (
 	"crypto/tls"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
 
 	envstruct "code.cloudfoundry.org/go-envstruct"
+	"github.com/knative/observability/pkg/client/clientset/versioned"
+	sinkinformers "github.com/knative/observability/pkg/client/informers/externalversions"
 	"github.com/knative/observability/pkg/webhook"
+	"github.com/knative/pkg/signals"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 )
 
 type config struct {
 	HTTPAddr string `env:"HTTP_ADDR, required, report"`
-	Cert     string `env:"VALIDATOR_CERT, required, report"`
-	Key      string `env:"VALIDATOR_KEY, required, report"`
+	Cert     string `env:"VALIDATOR_CERT, report"`
+	Key      string `env:"VALIDATOR_KEY, report"`
+
+	// CertSecret enables generating and rotating the serving certificate.
+	// It is stored in the named Secret in Namespace and the CA is patched
+	// into the webhook configurations. Cert and Key are used otherwise.
+	CertSecret              string        `env:"CERT_SECRET,               report"`
+	CertSyncInterval        time.Duration `env:"CERT_SYNC_INTERVAL,        report"`
+	ServiceName             string        `env:"SERVICE_NAME,              report"`
+	ValidatingWebhookConfig string        `env:"VALIDATING_WEBHOOK_CONFIG, report"`
+	MutatingWebhookConfig   string        `env:"MUTATING_WEBHOOK_CONFIG,   report"`
+
+	// TelegrafPath enables running telegraf against rendered metric sink
+	// configs in addition to the built in validation.
+	TelegrafPath        string        `env:"TELEGRAF_PATH, report"`
+	TelegrafTimeout     time.Duration `env:"TELEGRAF_TIMEOUT, report"`
+	TelegrafConcurrency int           `env:"TELEGRAF_CONCURRENCY, report"`
+
+	// PolicyConfigMap names the ConfigMap in Namespace holding the
+	// destination policy for tenant sinks.
+	Namespace       string `env:"NAMESPACE,        report"`
+	PolicyConfigMap string `env:"POLICY_CONFIGMAP, report"`
+
+	// MetricsPort serves Prometheus metrics over plain HTTP. AuditLog
+	// writes a JSON line per admission decision to stdout.
+	MetricsPort string `env:"METRICS_PORT, report"`
+	AuditLog    bool   `env:"AUDIT_LOG,    report"`
+
+	// Sink quotas limit the LogSinks and MetricSinks tenants may create,
+	// per namespace and across the cluster. Zero means unlimited.
+	MaxLogSinksPerNamespace    int `env:"MAX_LOG_SINKS_PER_NAMESPACE,    report"`
+	MaxMetricSinksPerNamespace int `env:"MAX_METRIC_SINKS_PER_NAMESPACE, report"`
+	MaxLogSinks                int `env:"MAX_LOG_SINKS,                  report"`
+	MaxMetricSinks             int `env:"MAX_METRIC_SINKS,               report"`
+
+	// ProbeTimeout enables probing the destinations of sinks in namespaces
+	// whose destination policy asks for it and of annotated cluster sinks,
+	// and bounds how long probing a sink may take. Probing is disabled
+	// unless it is set.
+	ProbeTimeout time.Duration `env:"PROBE_TIMEOUT, report"`
 }
 
 func main() {
 	cfg := config{
 		Cert: "/etc/validator-certs/tls.crt",
 		Key:  "/etc/validator-certs/tls.key",
+
+		CertSyncInterval:        time.Hour,
+		ServiceName:             "validator",
+		ValidatingWebhookConfig: "validator.observability.knative.dev",
+		MutatingWebhookConfig:   "defaulter.observability.knative.dev",
+
+		MetricsPort: "9090",
+
+		// Shorter than the 30s default timeout of the webhook configuration.
+		TelegrafTimeout:     5 * time.Second,
+		TelegrafConcurrency: 4,
 	}
 	if err := envstruct.Load(&cfg); err != nil {
 		log.Fatalf("Failed to load config from environment: %s", err)
 	}
 
-	cert, err := tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+	err := envstruct.WriteReport(&cfg)
 	if err != nil {
-		log.Fatalf("Unable to load certs: %s", err)
+		log.Printf("Unable to write envstruct report: %s", err)
+	}
+
+	stopCh := signals.SetupSignalHandler()
+
+	var tlsConf *tls.Config
+	if cfg.CertSecret != "" {
+		tlsConf = &tls.Config{
+			GetCertificate: certManager(cfg, stopCh).GetCertificate,
+		}
+	} else {
+		cert, err := tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+		if err != nil {
+			log.Fatalf("Unable to load certs: %s", err)
+		}
+		tlsConf = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+		}
+	}
+
+	opts := []webhook.ServerOpt{
+		webhook.WithTLSConfig(tlsConf),
+		webhook.WithMetrics(prometheus.DefaultRegisterer),
+	}
+	if cfg.AuditLog {
+		opts = append(opts, webhook.WithAuditLog(os.Stdout))
+	}
+	if cfg.TelegrafPath != "" {
+		opts = append(opts,
+			webhook.WithTelegrafBinary(cfg.TelegrafPath),
+			webhook.WithTelegrafTimeout(cfg.TelegrafTimeout),
+			webhook.WithTelegrafConcurrency(cfg.TelegrafConcurrency),
+		)
+	}
+
+	if cfg.PolicyConfigMap != "" {
+		opts = append(opts, destinationPolicy(cfg.Namespace, cfg.PolicyConfigMap, stopCh))
+	}
+
+	if cfg.ProbeTimeout > 0 {
+		opts = append(opts, webhook.WithDestinationProbe(cfg.ProbeTimeout))
 	}
-	tlsConf := &tls.Config{
-		Certificates: []tls.Certificate{cert},
+
+	q := webhook.SinkQuota{
+		LogSinksPerNamespace:    cfg.MaxLogSinksPerNamespace,
+		MetricSinksPerNamespace: cfg.MaxMetricSinksPerNamespace,
+		LogSinks:                cfg.MaxLogSinks,
+		MetricSinks:             cfg.MaxMetricSinks,
+	}
+	if q != (webhook.SinkQuota{}) {
+		opts = append(opts, sinkQuota(q, stopCh))
 	}
-	err = envstruct.WriteReport(&cfg)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		log.Fatal(http.ListenAndServe(net.JoinHostPort("", cfg.MetricsPort), mux))
+	}()
+
+	webhook.NewServer(cfg.HTTPAddr, opts...).Run(true)
+}
+
+// destinationPolicy follows the policy ConfigMap and the namespace labels
+// its rules select on.
+func destinationPolicy(namespace, configMap string, stopCh <-chan struct{}) webhook.ServerOpt {
+	kcfg, err := rest.InClusterConfig()
 	if err != nil {
-		log.Printf("Unable to write envstruct report: %s", err)
+		log.Fatal(err.Error())
+	}
+	kclientset, err := kubernetes.NewForConfig(kcfg)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	ps := webhook.NewPolicyStore(configMap)
+	cmInformerFactory := informers.NewSharedInformerFactoryWithOptions(
+		kclientset,
+		30*time.Second,
+		informers.WithNamespace(namespace),
+	)
+	cmInformer := cmInformerFactory.Core().V1().ConfigMaps().Informer()
+	cmInformer.AddEventHandler(ps)
+
+	nsInformerFactory := informers.NewSharedInformerFactory(kclientset, 30*time.Second)
+	nsInformer := nsInformerFactory.Core().V1().Namespaces()
+	nsSynced := nsInformer.Informer().HasSynced
+
+	cmInformerFactory.Start(stopCh)
+	nsInformerFactory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, cmInformer.HasSynced, nsSynced) {
+		log.Fatal("Unable to sync destination policy caches")
+	}
+
+	return webhook.WithDestinationPolicy(ps, nsInformer.Lister())
+}
+
+// sinkQuota counts existing sinks from informer caches.
+func sinkQuota(q webhook.SinkQuota, stopCh <-chan struct{}) webhook.ServerOpt {
+	kcfg, err := rest.InClusterConfig()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	client, err := versioned.NewForConfig(kcfg)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	sinkInformerFactory := sinkinformers.NewSharedInformerFactory(client, 30*time.Second)
+	logSinks := sinkInformerFactory.Observability().V1alpha1().LogSinks()
+	metricSinks := sinkInformerFactory.Observability().V1alpha1().MetricSinks()
+	logSinksSynced := logSinks.Informer().HasSynced
+	metricSinksSynced := metricSinks.Informer().HasSynced
+
+	sinkInformerFactory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, logSinksSynced, metricSinksSynced) {
+		log.Fatal("Unable to sync sink quota caches")
+	}
+
+	return webhook.WithSinkQuota(q, logSinks.Lister(), metricSinks.Lister())
+}
+
+// certManager syncs the serving certificate until it is available and keeps
+// rotating it in the background.
+func certManager(cfg config, stopCh <-chan struct{}) *webhook.CertManager {
+	kcfg, err := rest.InClusterConfig()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	kclientset, err := kubernetes.NewForConfig(kcfg)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	dclient, err := dynamic.NewForConfig(kcfg)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	gv := schema.GroupVersion{Group: "admissionregistration.k8s.io", Version: "v1"}
+	m := webhook.NewCertManager(
+		kclientset.CoreV1().Secrets(cfg.Namespace),
+		cfg.CertSecret,
+		cfg.ServiceName,
+		cfg.Namespace,
+		webhook.WithWebhookConfigs(
+			webhook.WebhookConfig{
+				Client: dclient.Resource(gv.WithResource("validatingwebhookconfigurations")),
+				Name:   cfg.ValidatingWebhookConfig,
+			},
+			webhook.WebhookConfig{
+				Client: dclient.Resource(gv.WithResource("mutatingwebhookconfigurations")),
+				Name:   cfg.MutatingWebhookConfig,
+			},
+		),
+	)
+
+	for {
+		err := m.Sync()
+		if err == nil {
+			break
+		}
+		log.Printf("Unable to sync serving certificate, retrying: %s", err)
+		select {
+		case <-time.After(5 * time.Second):
+		case <-stopCh:
+			log.Fatal("Stopped before serving certificate was available")
+		}
 	}
+	go m.Run(cfg.CertSyncInterval, stopCh)
 
-	webhook.NewServer(cfg.HTTPAddr, webhook.WithTLSConfig(tlsConf)).Run(true)
+	return m
 }
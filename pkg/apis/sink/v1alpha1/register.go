@@ -45,6 +45,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&LogSink{},
 		&LogSinkList{},
+		&LogParser{},
+		&LogParserList{},
 		&MetricSink{},
 		&MetricSinkList{},
 		&ClusterLogSink{},
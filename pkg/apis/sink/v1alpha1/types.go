@@ -37,6 +37,11 @@ type SinkSpec struct {
 	SyslogSpec         `json:",inline"`
 	WebhookSpec        `json:",inline"`
 	InsecureSkipVerify bool `json:"insecure_skip_verify"`
+
+	Multiline *MultilineSpec `json:"multiline,omitempty"`
+	// Parser is the name of a LogParser in the namespace of the LogSink that
+	// is applied to the logs of that namespace.
+	Parser string `json:"parser,omitempty"`
 }
 
 type SyslogSpec struct {
@@ -49,6 +54,17 @@ type WebhookSpec struct {
 	URL string `json:"url"`
 }
 
+// MultilineSpec configures reassembly of multiline log records, such as
+// stack traces, for the namespace of a LogSink. Presets name the built-in
+// fluent-bit multiline parsers (go, java, python and ruby). StartRegex
+// matches the first line of a record and ContinueRegex matches the lines that
+// belong to it.
+type MultilineSpec struct {
+	Presets       []string `json:"presets,omitempty"`
+	StartRegex    string   `json:"start_regex,omitempty"`
+	ContinueRegex string   `json:"continue_regex,omitempty"`
+}
+
 // SinkStatus is the status for a Sink resource
 type SinkStatus struct {
 	State              SinkState         `json:"state,omitempty"`
@@ -77,6 +93,40 @@ type LogSinkList struct {
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
+// LogParser is a specification for a LogParser resource. The parser is
+// registered with fluent-bit as <namespace>.<name> and can be selected by a
+// LogSink in the same namespace or by annotating a pod with
+// fluentbit.io/parser.
+type LogParser struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	Spec LogParserSpec `json:"spec"`
+}
+
+// LogParserSpec is the spec for a LogParser resource
+type LogParserSpec struct {
+	// Format is one of regex, json, logfmt or ltsv.
+	Format string `json:"format"`
+	// Regex is required by the regex format and must use named captures.
+	Regex      string `json:"regex,omitempty"`
+	TimeKey    string `json:"time_key,omitempty"`
+	TimeFormat string `json:"time_format,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// LogParserList is a list of LogParser resources
+type LogParserList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []LogParser `json:"items"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
 // ClusterLogSink is a specification for a ClusterLogSink resource
 type ClusterLogSink struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -29,7 +29,7 @@ func (in *ClusterLogSink) DeepCopyInto(out *ClusterLogSink) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	return
 }
 
@@ -146,7 +146,7 @@ func (in *ClusterMetricSinkList) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *LogSink) DeepCopyInto(out *LogSink) {
+func (in *LogParser) DeepCopyInto(out *LogParser) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
@@ -154,6 +154,82 @@ func (in *LogSink) DeepCopyInto(out *LogSink) {
 	return
 }
 
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogParser.
+func (in *LogParser) DeepCopy() *LogParser {
+	if in == nil {
+		return nil
+	}
+	out := new(LogParser)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LogParser) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LogParserList) DeepCopyInto(out *LogParserList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]LogParser, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogParserList.
+func (in *LogParserList) DeepCopy() *LogParserList {
+	if in == nil {
+		return nil
+	}
+	out := new(LogParserList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LogParserList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LogParserSpec) DeepCopyInto(out *LogParserSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogParserSpec.
+func (in *LogParserSpec) DeepCopy() *LogParserSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(LogParserSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LogSink) DeepCopyInto(out *LogSink) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	return
+}
+
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogSink.
 func (in *LogSink) DeepCopy() *LogSink {
 	if in == nil {
@@ -305,11 +381,37 @@ func (in *MetricSinkSpec) DeepCopy() *MetricSinkSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MultilineSpec) DeepCopyInto(out *MultilineSpec) {
+	*out = *in
+	if in.Presets != nil {
+		in, out := &in.Presets, &out.Presets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MultilineSpec.
+func (in *MultilineSpec) DeepCopy() *MultilineSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MultilineSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SinkSpec) DeepCopyInto(out *SinkSpec) {
 	*out = *in
 	out.SyslogSpec = in.SyslogSpec
 	out.WebhookSpec = in.WebhookSpec
+	if in.Multiline != nil {
+		in, out := &in.Multiline, &out.Multiline
+		*out = new(MultilineSpec)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
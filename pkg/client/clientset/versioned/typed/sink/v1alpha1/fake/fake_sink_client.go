@@ -36,6 +36,10 @@ func (c *FakeObservabilityV1alpha1) ClusterMetricSinks(namespace string) v1alpha
 	return &FakeClusterMetricSinks{c, namespace}
 }
 
+func (c *FakeObservabilityV1alpha1) LogParsers(namespace string) v1alpha1.LogParserInterface {
+	return &FakeLogParsers{c, namespace}
+}
+
 func (c *FakeObservabilityV1alpha1) LogSinks(namespace string) v1alpha1.LogSinkInterface {
 	return &FakeLogSinks{c, namespace}
 }
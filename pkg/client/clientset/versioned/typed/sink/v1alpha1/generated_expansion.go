@@ -22,6 +22,8 @@ type ClusterLogSinkExpansion interface{}
 
 type ClusterMetricSinkExpansion interface{}
 
+type LogParserExpansion interface{}
+
 type LogSinkExpansion interface{}
 
 type MetricSinkExpansion interface{}
@@ -29,6 +29,7 @@ type ObservabilityV1alpha1Interface interface {
 	RESTClient() rest.Interface
 	ClusterLogSinksGetter
 	ClusterMetricSinksGetter
+	LogParsersGetter
 	LogSinksGetter
 	MetricSinksGetter
 }
@@ -46,6 +47,10 @@ func (c *ObservabilityV1alpha1Client) ClusterMetricSinks(namespace string) Clust
 	return newClusterMetricSinks(c, namespace)
 }
 
+func (c *ObservabilityV1alpha1Client) LogParsers(namespace string) LogParserInterface {
+	return newLogParsers(c, namespace)
+}
+
 func (c *ObservabilityV1alpha1Client) LogSinks(namespace string) LogSinkInterface {
 	return newLogSinks(c, namespace)
 }
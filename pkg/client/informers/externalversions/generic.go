@@ -57,6 +57,8 @@ func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Observability().V1alpha1().ClusterLogSinks().Informer()}, nil
 	case v1alpha1.SchemeGroupVersion.WithResource("clustermetricsinks"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Observability().V1alpha1().ClusterMetricSinks().Informer()}, nil
+	case v1alpha1.SchemeGroupVersion.WithResource("logparsers"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Observability().V1alpha1().LogParsers().Informer()}, nil
 	case v1alpha1.SchemeGroupVersion.WithResource("logsinks"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Observability().V1alpha1().LogSinks().Informer()}, nil
 	case v1alpha1.SchemeGroupVersion.WithResource("metricsinks"):
@@ -28,6 +28,8 @@ type Interface interface {
 	ClusterLogSinks() ClusterLogSinkInformer
 	// ClusterMetricSinks returns a ClusterMetricSinkInformer.
 	ClusterMetricSinks() ClusterMetricSinkInformer
+	// LogParsers returns a LogParserInformer.
+	LogParsers() LogParserInformer
 	// LogSinks returns a LogSinkInformer.
 	LogSinks() LogSinkInformer
 	// MetricSinks returns a MetricSinkInformer.
@@ -55,6 +57,11 @@ func (v *version) ClusterMetricSinks() ClusterMetricSinkInformer {
 	return &clusterMetricSinkInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
 }
 
+// LogParsers returns a LogParserInformer.
+func (v *version) LogParsers() LogParserInformer {
+	return &logParserInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
 // LogSinks returns a LogSinkInformer.
 func (v *version) LogSinks() LogSinkInformer {
 	return &logSinkInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
@@ -34,6 +34,14 @@ type ClusterMetricSinkListerExpansion interface{}
 // ClusterMetricSinkNamespaceLister.
 type ClusterMetricSinkNamespaceListerExpansion interface{}
 
+// LogParserListerExpansion allows custom methods to be added to
+// LogParserLister.
+type LogParserListerExpansion interface{}
+
+// LogParserNamespaceListerExpansion allows custom methods to be added to
+// LogParserNamespaceLister.
+type LogParserNamespaceListerExpansion interface{}
+
 // LogSinkListerExpansion allows custom methods to be added to
 // LogSinkLister.
 type LogSinkListerExpansion interface{}
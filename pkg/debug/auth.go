@@ -0,0 +1,147 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package debug
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+)
+
+const group = "observability.knative.dev"
+
+// TokenReviewer authenticates bearer tokens. It is satisfied by the typed
+// TokenReview client.
+type TokenReviewer interface {
+	Create(*authenticationv1.TokenReview) (*authenticationv1.TokenReview, error)
+}
+
+// SubjectAccessReviewer authorizes users. It is satisfied by the typed
+// SubjectAccessReview client.
+type SubjectAccessReviewer interface {
+	Create(*authorizationv1.SubjectAccessReview) (*authorizationv1.SubjectAccessReview, error)
+}
+
+// Authorizer guards the debug handlers of a controller, which serve the
+// rendered config including destinations and credentials. A request must
+// carry a bearer token of a user who may get the sinks of the requested
+// namespace. Without a namespace the whole config is served, so the user
+// must be able to list the sinks of every namespace and the cluster sinks.
+type Authorizer struct {
+	tokens          TokenReviewer
+	access          SubjectAccessReviewer
+	resource        string
+	clusterResource string
+}
+
+// NewAuthorizer returns an Authorizer checking access to resource, such
+// as logsinks, and its cluster scoped counterpart, such as clusterlogsinks.
+func NewAuthorizer(tokens TokenReviewer, access SubjectAccessReviewer, resource, clusterResource string) *Authorizer {
+	return &Authorizer{
+		tokens:          tokens,
+		access:          access,
+		resource:        resource,
+		clusterResource: clusterResource,
+	}
+}
+
+// Wrap only passes authorized requests to h.
+func (a *Authorizer) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := a.authenticate(r)
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var attrs []authorizationv1.ResourceAttributes
+		if ns := r.URL.Query().Get("namespace"); ns != "" {
+			attrs = append(attrs, authorizationv1.ResourceAttributes{
+				Namespace: ns,
+				Verb:      "get",
+				Group:     group,
+				Resource:  a.resource,
+			})
+		} else {
+			attrs = append(attrs,
+				authorizationv1.ResourceAttributes{
+					Verb:     "list",
+					Group:    group,
+					Resource: a.resource,
+				},
+				authorizationv1.ResourceAttributes{
+					Verb:     "list",
+					Group:    group,
+					Resource: a.clusterResource,
+				},
+			)
+		}
+
+		for _, attr := range attrs {
+			if !a.authorize(user, attr) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (a *Authorizer) authenticate(r *http.Request) (authenticationv1.UserInfo, bool) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return authenticationv1.UserInfo{}, false
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	if token == "" {
+		return authenticationv1.UserInfo{}, false
+	}
+
+	review, err := a.tokens.Create(&authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	})
+	if err != nil {
+		log.Printf("Unable to review token: %s", err)
+		return authenticationv1.UserInfo{}, false
+	}
+	return review.Status.User, review.Status.Authenticated
+}
+
+func (a *Authorizer) authorize(user authenticationv1.UserInfo, attr authorizationv1.ResourceAttributes) bool {
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+
+	review, err := a.access.Create(&authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &attr,
+			User:               user.Username,
+			UID:                user.UID,
+			Groups:             user.Groups,
+			Extra:              extra,
+		},
+	})
+	if err != nil {
+		log.Printf("Unable to review access of %s: %s", user.Username, err)
+		return false
+	}
+	return review.Status.Allowed
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package debug_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+
+	"github.com/knative/observability/pkg/debug"
+)
+
+func TestAuthorizer(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		url      string
+		allowed  map[string]bool
+		tokenErr error
+		code     int
+	}{
+		{
+			name: "no token",
+			url:  "/debug/config?namespace=ns1",
+			code: http.StatusUnauthorized,
+		},
+		{
+			name:   "unknown token",
+			header: "Bearer unknown",
+			url:    "/debug/config?namespace=ns1",
+			code:   http.StatusUnauthorized,
+		},
+		{
+			name:     "token review failure",
+			header:   "Bearer some-token",
+			url:      "/debug/config?namespace=ns1",
+			tokenErr: errors.New("some error"),
+			code:     http.StatusUnauthorized,
+		},
+		{
+			name:    "namespace the user may read",
+			header:  "Bearer some-token",
+			url:     "/debug/config?namespace=ns1",
+			allowed: map[string]bool{"get logsinks ns1": true},
+			code:    http.StatusOK,
+		},
+		{
+			name:    "namespace the user may not read",
+			header:  "Bearer some-token",
+			url:     "/debug/config?namespace=ns2",
+			allowed: map[string]bool{"get logsinks ns1": true},
+			code:    http.StatusForbidden,
+		},
+		{
+			name:    "cluster config without access to cluster sinks",
+			header:  "Bearer some-token",
+			url:     "/debug/config",
+			allowed: map[string]bool{"list logsinks ": true},
+			code:    http.StatusForbidden,
+		},
+		{
+			name:    "cluster config",
+			header:  "Bearer some-token",
+			url:     "/debug/config",
+			allowed: map[string]bool{"list logsinks ": true, "list clusterlogsinks ": true},
+			code:    http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokens := &spyTokenReviewer{err: test.tokenErr}
+			access := &spyAccessReviewer{allowed: test.allowed}
+			a := debug.NewAuthorizer(tokens, access, "logsinks", "clusterlogsinks")
+			h := a.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("config"))
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, test.url, nil)
+			if test.header != "" {
+				req.Header.Set("Authorization", test.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != test.code {
+				t.Errorf("Expected status %d, got %d", test.code, rec.Code)
+			}
+			if rec.Code != http.StatusOK && rec.Body.String() == "config" {
+				t.Errorf("Expected the config not to be served")
+			}
+			for _, u := range access.users {
+				if u != "some-user" {
+					t.Errorf("Expected access to be reviewed for some-user, got %s", u)
+				}
+			}
+		})
+	}
+}
+
+type spyTokenReviewer struct {
+	err error
+}
+
+func (s *spyTokenReviewer) Create(r *authenticationv1.TokenReview) (*authenticationv1.TokenReview, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if r.Spec.Token == "some-token" {
+		r.Status.Authenticated = true
+		r.Status.User = authenticationv1.UserInfo{Username: "some-user"}
+	}
+	return r, nil
+}
+
+type spyAccessReviewer struct {
+	allowed map[string]bool
+	users   []string
+}
+
+func (s *spyAccessReviewer) Create(r *authorizationv1.SubjectAccessReview) (*authorizationv1.SubjectAccessReview, error) {
+	s.users = append(s.users, r.Spec.User)
+	attr := r.Spec.ResourceAttributes
+	if attr.Group != "observability.knative.dev" {
+		return r, nil
+	}
+	r.Status.Allowed = s.allowed[attr.Verb+" "+attr.Resource+" "+attr.Namespace]
+	return r, nil
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package event
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// BufferedForwarder posts records to another forwarder in the background,
+// so a slow destination does not block the informer. Records are dropped
+// when the buffer is full. It counts the records queued and sent, times
+// sending them and reports how full the buffer is, in metrics registered
+// with reg.
+type BufferedForwarder struct {
+	f       Forwarder
+	pending chan bufferedRecord
+	done    chan struct{}
+
+	queued  prometheus.Counter
+	sent    prometheus.Counter
+	failed  prometheus.Counter
+	latency *prometheus.HistogramVec
+}
+
+type bufferedRecord struct {
+	tag string
+	msg interface{}
+}
+
+func NewBufferedForwarder(f Forwarder, limit int, reg prometheus.Registerer) *BufferedForwarder {
+	b := &BufferedForwarder{
+		f:       f,
+		pending: make(chan bufferedRecord, limit),
+		done:    make(chan struct{}),
+		queued: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "eventcontroller",
+			Name:      "buffer_queued_total",
+			Help:      "Records queued in the send buffer.",
+		}),
+		sent: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "eventcontroller",
+			Name:      "buffer_sent_total",
+			Help:      "Records from the send buffer that were sent.",
+		}),
+		failed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "eventcontroller",
+			Name:      "buffer_failed_total",
+			Help:      "Records from the send buffer that failed to send.",
+		}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "eventcontroller",
+			Name:      "forward_latency_seconds",
+			Help:      "Time to send a record from the send buffer, by result.",
+			Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5},
+		}, []string{"result"}),
+	}
+	utilization := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "eventcontroller",
+		Name:      "buffer_utilization",
+		Help:      "Fraction of the send buffer in use. Records are dropped when it is full.",
+	}, b.utilization)
+
+	reg.MustRegister(b.queued, b.sent, b.failed, b.latency, utilization)
+	go b.run()
+
+	return b
+}
+
+// Post queues a record. It returns an error without waiting if the buffer
+// is full. It must not be called after Close.
+func (b *BufferedForwarder) Post(tag string, msg interface{}) error {
+	select {
+	case b.pending <- bufferedRecord{tag: tag, msg: msg}:
+		b.queued.Inc()
+		return nil
+	default:
+		return fmt.Errorf("send buffer full, limit %d", cap(b.pending))
+	}
+}
+
+// Close sends the queued records and closes the forwarder it posts to if
+// it is an io.Closer.
+func (b *BufferedForwarder) Close() error {
+	close(b.pending)
+	<-b.done
+
+	if c, ok := b.f.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (b *BufferedForwarder) run() {
+	defer close(b.done)
+
+	for r := range b.pending {
+		start := time.Now()
+		err := b.f.Post(r.tag, r.msg)
+		if err != nil {
+			b.latency.WithLabelValues("failed").Observe(time.Since(start).Seconds())
+			b.failed.Inc()
+			log.Printf("unable to send buffered record: %s\n", err)
+			continue
+		}
+		b.latency.WithLabelValues("sent").Observe(time.Since(start).Seconds())
+		b.sent.Inc()
+	}
+}
+
+func (b *BufferedForwarder) utilization() float64 {
+	if cap(b.pending) == 0 {
+		return 0
+	}
+	return float64(len(b.pending)) / float64(cap(b.pending))
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package event_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/knative/observability/pkg/event"
+	"github.com/knative/observability/pkg/metrictest"
+)
+
+func TestBufferedForwarder(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	f := &blockingForwarder{
+		unblock: make(chan struct{}),
+		posted:  make(chan string, 3),
+		closed:  make(chan struct{}),
+	}
+	b := event.NewBufferedForwarder(f, 2, reg)
+
+	if err := b.Post("some-tag", "some-record"); err != nil {
+		t.Fatal(err)
+	}
+	// The first record is being sent until it is unblocked.
+	if tag := <-f.posted; tag != "some-tag" {
+		t.Errorf("Expected some-tag to be posted, got %s", tag)
+	}
+	for i := 0; i < 2; i++ {
+		if err := b.Post("other-tag", "other-record"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Post("dropped-tag", "dropped-record"); err == nil {
+		t.Errorf("Expected an error when the buffer is full")
+	}
+	if got := metrictest.Value(t, reg, "eventcontroller_buffer_utilization", nil); got != 1 {
+		t.Errorf("Expected a full buffer, got %v", got)
+	}
+
+	close(f.unblock)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-f.closed:
+	default:
+		t.Errorf("Expected the forwarder to be closed")
+	}
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		value  float64
+	}{
+		{"eventcontroller_buffer_queued_total", nil, 3},
+		{"eventcontroller_buffer_sent_total", nil, 3},
+		{"eventcontroller_buffer_failed_total", nil, 0},
+		{"eventcontroller_buffer_utilization", nil, 0},
+		{"eventcontroller_forward_latency_seconds", map[string]string{"result": "sent"}, 3},
+	}
+	for _, test := range tests {
+		if got := metrictest.Value(t, reg, test.name, test.labels); got != test.value {
+			t.Errorf("Expected %s%v to be %v, got %v", test.name, test.labels, test.value, got)
+		}
+	}
+}
+
+func TestBufferedForwarderFailures(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	b := event.NewBufferedForwarder(&spyFlogger{t: t, err: errors.New("some error")}, 2, reg)
+
+	if err := b.Post("some-tag", map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := metrictest.Value(t, reg, "eventcontroller_buffer_failed_total", nil); got != 1 {
+		t.Errorf("Expected 1 failed record, got %v", got)
+	}
+	if got := metrictest.Value(t, reg, "eventcontroller_buffer_sent_total", nil); got != 0 {
+		t.Errorf("Expected no records sent, got %v", got)
+	}
+	if got := metrictest.Value(t, reg, "eventcontroller_forward_latency_seconds", map[string]string{"result": "failed"}); got != 1 {
+		t.Errorf("Expected the failed send to be timed, got %v", got)
+	}
+}
+
+type blockingForwarder struct {
+	unblock chan struct{}
+	posted  chan string
+	closed  chan struct{}
+}
+
+func (f *blockingForwarder) Post(tag string, _ interface{}) error {
+	f.posted <- tag
+	<-f.unblock
+	return nil
+}
+
+func (f *blockingForwarder) Close() error {
+	close(f.closed)
+	return nil
+}
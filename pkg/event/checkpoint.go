@@ -0,0 +1,260 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package event
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CheckpointConfigMapKey is the key of the checkpoint in its ConfigMap.
+const CheckpointConfigMapKey = "checkpoint.json"
+
+const (
+	// DefaultCheckpointTTL is the default --event-ttl of the API server.
+	DefaultCheckpointTTL = time.Hour
+
+	// DefaultCheckpointMaxEntries keeps the checkpoint well below the
+	// 1 MiB limit of a ConfigMap, at about 70 bytes an entry.
+	DefaultCheckpointMaxEntries = 10000
+)
+
+// ConfigMapClient reads and writes the checkpoint ConfigMap. It is
+// satisfied by the typed ConfigMap client of a namespace.
+type ConfigMapClient interface {
+	Get(name string, options metav1.GetOptions) (*v1.ConfigMap, error)
+	Create(*v1.ConfigMap) (*v1.ConfigMap, error)
+	Update(*v1.ConfigMap) (*v1.ConfigMap, error)
+}
+
+// Checkpoint remembers the resourceVersion of the last forwarded version of
+// each event, so events that were already forwarded are skipped when the
+// informer lists them again after a restart. Resource versions are only
+// compared for equality; an event that changed while the controller was
+// down is forwarded again.
+//
+// The checkpoint is held in memory and saved to a ConfigMap periodically,
+// so events forwarded shortly before a crash may be forwarded twice.
+// Deleted events are forgotten. Events that were not forwarded again within
+// the TTL have been deleted by the API server, possibly while the
+// controller was down, and are forgotten when the checkpoint is saved. If
+// there are more than the max entries, the events forwarded least recently
+// are forgotten too, and may be forwarded again after a restart.
+type Checkpoint struct {
+	client     ConfigMapClient
+	name       string
+	ttl        time.Duration
+	maxEntries int
+
+	mu       sync.Mutex
+	versions map[string]checkpointEntry
+	dirty    bool
+}
+
+// checkpointEntry is the resourceVersion of an event and when it was
+// forwarded, in Unix seconds.
+type checkpointEntry struct {
+	ResourceVersion string `json:"v"`
+	Forwarded       int64  `json:"t"`
+}
+
+type CheckpointOpt func(*Checkpoint)
+
+func NewCheckpoint(client ConfigMapClient, name string, opts ...CheckpointOpt) *Checkpoint {
+	c := &Checkpoint{
+		client:     client,
+		name:       name,
+		ttl:        DefaultCheckpointTTL,
+		maxEntries: DefaultCheckpointMaxEntries,
+		versions:   make(map[string]checkpointEntry),
+	}
+
+	for _, o := range opts {
+		o(c)
+	}
+
+	return c
+}
+
+// WithCheckpointTTL sets how long events are remembered after they were
+// last forwarded. It should be at least the --event-ttl of the API server.
+func WithCheckpointTTL(ttl time.Duration) CheckpointOpt {
+	return func(c *Checkpoint) {
+		c.ttl = ttl
+	}
+}
+
+// WithCheckpointMaxEntries sets how many events are remembered at most.
+func WithCheckpointMaxEntries(n int) CheckpointOpt {
+	return func(c *Checkpoint) {
+		c.maxEntries = n
+	}
+}
+
+// Load reads the checkpoint from the ConfigMap. A missing ConfigMap is an
+// empty checkpoint.
+func (c *Checkpoint) Load() error {
+	cm, err := c.client.Get(c.name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	versions := make(map[string]checkpointEntry)
+	if data := cm.Data[CheckpointConfigMapKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &versions); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.versions = versions
+	return nil
+}
+
+// Forwarded reports whether the version of the event was forwarded.
+func (c *Checkpoint) Forwarded(uid, resourceVersion string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.versions[uid]
+	return ok && e.ResourceVersion == resourceVersion
+}
+
+// Mark records that the version of the event was forwarded at t.
+func (c *Checkpoint) Mark(uid, resourceVersion string, t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := checkpointEntry{
+		ResourceVersion: resourceVersion,
+		Forwarded:       t.Unix(),
+	}
+	if c.versions[uid] == e {
+		return
+	}
+	c.versions[uid] = e
+	c.dirty = true
+}
+
+// Forget removes a deleted event.
+func (c *Checkpoint) Forget(uid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.versions[uid]; !ok {
+		return
+	}
+	delete(c.versions, uid)
+	c.dirty = true
+}
+
+// Save writes the checkpoint to the ConfigMap if it changed, after
+// forgetting the events that expired by now or are over the max entries.
+func (c *Checkpoint) Save(now time.Time) error {
+	c.mu.Lock()
+	c.prune(now)
+	if !c.dirty {
+		c.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(c.versions)
+	c.dirty = false
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = c.write(string(data))
+	if err != nil {
+		c.mu.Lock()
+		c.dirty = true
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// prune forgets expired events, then the events forwarded least recently
+// until there are at most maxEntries. It must be called with mu held.
+func (c *Checkpoint) prune(now time.Time) {
+	expired := now.Add(-c.ttl).Unix()
+	for uid, e := range c.versions {
+		if e.Forwarded < expired {
+			delete(c.versions, uid)
+			c.dirty = true
+		}
+	}
+
+	if c.maxEntries <= 0 || len(c.versions) <= c.maxEntries {
+		return
+	}
+	uids := make([]string, 0, len(c.versions))
+	for uid := range c.versions {
+		uids = append(uids, uid)
+	}
+	sort.Slice(uids, func(i, j int) bool {
+		return c.versions[uids[i]].Forwarded < c.versions[uids[j]].Forwarded
+	})
+	for _, uid := range uids[:len(uids)-c.maxEntries] {
+		delete(c.versions, uid)
+	}
+	c.dirty = true
+}
+
+func (c *Checkpoint) write(data string) error {
+	cm, err := c.client.Get(c.name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		_, err = c.client.Create(&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: c.name},
+			Data:       map[string]string{CheckpointConfigMapKey: data},
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[CheckpointConfigMapKey] = data
+	_, err = c.client.Update(cm)
+	return err
+}
+
+// Run saves the checkpoint every interval until stopCh is closed.
+func (c *Checkpoint) Run(interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if err := c.Save(now); err != nil {
+				log.Printf("unable to save checkpoint: %s\n", err)
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
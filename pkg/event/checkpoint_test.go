@@ -0,0 +1,238 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package event_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/knative/observability/pkg/event"
+)
+
+func TestCheckpointSkipsReplays(t *testing.T) {
+	ResetForwarderMetrics()
+	configMaps := &spyConfigMapClient{}
+	ev := checkpointEvent("some-uid", "1")
+	other := checkpointEvent("other-uid", "1")
+
+	cp := event.NewCheckpoint(configMaps, "event-controller-checkpoint")
+	if err := cp.Load(); err != nil {
+		t.Fatal(err)
+	}
+	c := event.NewController(&spyFlogger{t: t}, event.WithCheckpoint(cp))
+	c.OnAdd(ev)
+	c.OnAdd(other)
+	if err := cp.Save(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if configMaps.creates != 1 {
+		t.Fatalf("Expected the checkpoint to be created, got %d creates", configMaps.creates)
+	}
+
+	t.Run("it skips forwarded events after a restart", func(t *testing.T) {
+		ResetForwarderMetrics()
+		cp := event.NewCheckpoint(configMaps, "event-controller-checkpoint")
+		if err := cp.Load(); err != nil {
+			t.Fatal(err)
+		}
+		spyFl := &spyFlogger{t: t}
+		c := event.NewController(spyFl, event.WithCheckpoint(cp))
+
+		c.OnAdd(ev)
+		if spyFl.called {
+			t.Errorf("Expected not to forward the event again")
+		}
+		if event.ForwarderReplaySkipped.Value() != 1 {
+			t.Errorf("Expected replays skipped to be 1, was %d", event.ForwarderReplaySkipped.Value())
+		}
+
+		c.OnAdd(checkpointEvent("other-uid", "2"))
+		if !spyFl.called {
+			t.Errorf("Expected events that changed while stopped to be forwarded")
+		}
+	})
+
+	t.Run("it keeps metadata updates forwarded", func(t *testing.T) {
+		cp := event.NewCheckpoint(configMaps, "event-controller-checkpoint")
+		if err := cp.Load(); err != nil {
+			t.Fatal(err)
+		}
+		c := event.NewController(&spyFlogger{t: t}, event.WithCheckpoint(cp))
+
+		updated := checkpointEvent("some-uid", "2")
+		c.OnUpdate(ev, updated)
+		if !cp.Forwarded("some-uid", "2") {
+			t.Errorf("Expected the new resourceVersion to be marked forwarded")
+		}
+	})
+
+	t.Run("it forgets deleted events", func(t *testing.T) {
+		cp := event.NewCheckpoint(configMaps, "event-controller-checkpoint")
+		if err := cp.Load(); err != nil {
+			t.Fatal(err)
+		}
+		c := event.NewController(&spyFlogger{t: t}, event.WithCheckpoint(cp))
+
+		c.OnDelete(ev)
+		c.OnDelete(cache.DeletedFinalStateUnknown{Key: "some-namespace/other", Obj: other})
+		if err := cp.Save(time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		if configMaps.updates != 1 {
+			t.Errorf("Expected the checkpoint to be updated, got %d updates", configMaps.updates)
+		}
+		if got := configMaps.cm.Data[event.CheckpointConfigMapKey]; got != "{}" {
+			t.Errorf("Expected an empty checkpoint, got %s", got)
+		}
+	})
+}
+
+func TestCheckpointSkipsFailedEvents(t *testing.T) {
+	ResetForwarderMetrics()
+	cp := event.NewCheckpoint(&spyConfigMapClient{}, "event-controller-checkpoint")
+	c := event.NewController(&spyFlogger{t: t, err: errors.New("some error")}, event.WithCheckpoint(cp))
+
+	c.OnAdd(checkpointEvent("some-uid", "1"))
+
+	if cp.Forwarded("some-uid", "1") {
+		t.Errorf("Expected events that failed to forward not to be marked")
+	}
+}
+
+func TestCheckpointPrunes(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("it forgets events older than the TTL", func(t *testing.T) {
+		configMaps := &spyConfigMapClient{}
+		cp := event.NewCheckpoint(configMaps, "event-controller-checkpoint", event.WithCheckpointTTL(time.Hour))
+		cp.Mark("expired-uid", "1", now.Add(-61*time.Minute))
+		cp.Mark("some-uid", "1", now.Add(-59*time.Minute))
+
+		if err := cp.Save(now); err != nil {
+			t.Fatal(err)
+		}
+
+		if cp.Forwarded("expired-uid", "1") {
+			t.Errorf("Expected expired events to be forgotten")
+		}
+		if !cp.Forwarded("some-uid", "1") {
+			t.Errorf("Expected events within the TTL to be remembered")
+		}
+		expectSavedUIDs(t, configMaps, "some-uid")
+	})
+
+	t.Run("it forgets the events forwarded least recently over the max", func(t *testing.T) {
+		configMaps := &spyConfigMapClient{}
+		cp := event.NewCheckpoint(configMaps, "event-controller-checkpoint", event.WithCheckpointMaxEntries(2))
+		cp.Mark("some-uid", "1", now.Add(-3*time.Second))
+		cp.Mark("other-uid", "1", now.Add(-2*time.Second))
+		cp.Mark("another-uid", "1", now.Add(-time.Second))
+		cp.Mark("some-uid", "2", now)
+
+		if err := cp.Save(now); err != nil {
+			t.Fatal(err)
+		}
+
+		expectSavedUIDs(t, configMaps, "another-uid", "some-uid")
+	})
+
+	t.Run("it saves when only pruning changed the checkpoint", func(t *testing.T) {
+		configMaps := &spyConfigMapClient{}
+		cp := event.NewCheckpoint(configMaps, "event-controller-checkpoint")
+		cp.Mark("some-uid", "1", now)
+		if err := cp.Save(now); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := cp.Save(now.Add(2 * event.DefaultCheckpointTTL)); err != nil {
+			t.Fatal(err)
+		}
+
+		if configMaps.updates != 1 {
+			t.Errorf("Expected the checkpoint to be updated, got %d updates", configMaps.updates)
+		}
+		expectSavedUIDs(t, configMaps)
+	})
+}
+
+func expectSavedUIDs(t *testing.T, configMaps *spyConfigMapClient, uids ...string) {
+	t.Helper()
+	var saved map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(configMaps.cm.Data[event.CheckpointConfigMapKey]), &saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != len(uids) {
+		t.Errorf("Expected %d events saved, got %d", len(uids), len(saved))
+	}
+	for _, uid := range uids {
+		if _, ok := saved[uid]; !ok {
+			t.Errorf("Expected %s to be saved, got %v", uid, saved)
+		}
+	}
+}
+
+func checkpointEvent(uid, resourceVersion string) *v1.Event {
+	return &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "some-event-" + uid,
+			Namespace:       "some-namespace",
+			UID:             types.UID(uid),
+			ResourceVersion: resourceVersion,
+		},
+		InvolvedObject: v1.ObjectReference{
+			Name:      "some-object-name",
+			Namespace: "some-namespace",
+		},
+		Message: "some note with log data",
+		Count:   1,
+	}
+}
+
+type spyConfigMapClient struct {
+	cm      *v1.ConfigMap
+	creates int
+	updates int
+}
+
+var configMapsResource = schema.GroupResource{Resource: "configmaps"}
+
+func (s *spyConfigMapClient) Get(name string, _ metav1.GetOptions) (*v1.ConfigMap, error) {
+	if s.cm == nil {
+		return nil, k8serrors.NewNotFound(configMapsResource, name)
+	}
+	return s.cm.DeepCopy(), nil
+}
+
+func (s *spyConfigMapClient) Create(cm *v1.ConfigMap) (*v1.ConfigMap, error) {
+	s.creates++
+	s.cm = cm.DeepCopy()
+	return cm, nil
+}
+
+func (s *spyConfigMapClient) Update(cm *v1.ConfigMap) (*v1.ConfigMap, error) {
+	s.updates++
+	s.cm = cm.DeepCopy()
+	return cm, nil
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CloudEventsMode is the HTTP content mode of CloudEvents.
+type CloudEventsMode string
+
+const (
+	// CloudEventsBinary sends the attributes as ce- headers and the data as
+	// the body.
+	CloudEventsBinary CloudEventsMode = "binary"
+	// CloudEventsStructured sends the whole CloudEvent as JSON.
+	CloudEventsStructured CloudEventsMode = "structured"
+)
+
+// CloudEventTypePrefix prefixes the type of CloudEvents, which is followed
+// by the lowercase kind of the involved object and reason, for example
+// dev.knative.observability.event.pod.backoff.
+const CloudEventTypePrefix = "dev.knative.observability.event"
+
+// CloudEventsForwarder posts each record as a CloudEvent 1.0 to a sink
+// URI, such as a Knative Broker. The subject is the involved object, the
+// source is the events of its namespace and the data is the whole record.
+type CloudEventsForwarder struct {
+	sink   string
+	client *http.Client
+	mode   CloudEventsMode
+}
+
+func NewCloudEventsForwarder(sink string, client *http.Client, mode CloudEventsMode) *CloudEventsForwarder {
+	return &CloudEventsForwarder{
+		sink:   sink,
+		client: client,
+		mode:   mode,
+	}
+}
+
+type cloudEvent struct {
+	SpecVersion     string                 `json:"specversion"`
+	ID              string                 `json:"id"`
+	Source          string                 `json:"source"`
+	Type            string                 `json:"type"`
+	Subject         string                 `json:"subject,omitempty"`
+	Time            string                 `json:"time,omitempty"`
+	DataContentType string                 `json:"datacontenttype"`
+	Data            map[string]interface{} `json:"data"`
+}
+
+func (f *CloudEventsForwarder) Post(_ string, msg interface{}) error {
+	ce := newCloudEvent(jsonRecord(msg))
+
+	var (
+		req *http.Request
+		err error
+	)
+	switch f.mode {
+	case CloudEventsStructured:
+		req, err = structuredRequest(f.sink, ce)
+	default:
+		req, err = binaryRequest(f.sink, ce)
+	}
+	if err != nil {
+		return err
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code from %s: %d", f.sink, resp.StatusCode)
+	}
+	return nil
+}
+
+func binaryRequest(sink string, ce cloudEvent) (*http.Request, error) {
+	body, err := json.Marshal(ce.Data)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, sink, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", ce.DataContentType)
+	req.Header.Set("ce-specversion", ce.SpecVersion)
+	req.Header.Set("ce-id", ce.ID)
+	req.Header.Set("ce-source", ce.Source)
+	req.Header.Set("ce-type", ce.Type)
+	if ce.Subject != "" {
+		req.Header.Set("ce-subject", ce.Subject)
+	}
+	if ce.Time != "" {
+		req.Header.Set("ce-time", ce.Time)
+	}
+	return req, nil
+}
+
+func structuredRequest(sink string, ce cloudEvent) (*http.Request, error) {
+	body, err := json.Marshal(ce)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, sink, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/cloudevents+json")
+	return req, nil
+}
+
+// newCloudEvent builds a CloudEvent from the JSON form of a record. The id
+// is unique for each version of an event, so recurrences are distinct
+// CloudEvents.
+func newCloudEvent(r map[string]interface{}) cloudEvent {
+	e, _ := r["event"].(map[string]interface{})
+	o, _ := e["involved_object"].(map[string]interface{})
+	str := func(m map[string]interface{}, k string) string {
+		s, _ := m[k].(string)
+		return s
+	}
+
+	namespace := str(e, "namespace")
+	if namespace == "" {
+		namespace = str(o, "namespace")
+	}
+
+	id := str(e, "uid")
+	if id == "" {
+		id = namespace + "/" + str(e, "name")
+	}
+	if rv := str(e, "resource_version"); rv != "" {
+		id += "." + rv
+	}
+
+	typ := CloudEventTypePrefix
+	for _, s := range []string{str(o, "kind"), str(e, "reason")} {
+		if s != "" {
+			typ += "." + strings.ToLower(s)
+		}
+	}
+
+	subject := str(o, "name")
+	if kind := str(o, "kind"); kind != "" {
+		subject = kind + "/" + subject
+	}
+	if ns := str(o, "namespace"); ns != "" {
+		subject = ns + "/" + subject
+	}
+
+	t := str(e, "last_timestamp")
+	if t == "" {
+		t = str(e, "event_time")
+	}
+	if t == "" {
+		t = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+
+	return cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              id,
+		Source:          "/apis/v1/namespaces/" + namespace + "/events",
+		Type:            typ,
+		Subject:         subject,
+		Time:            t,
+		DataContentType: "application/json",
+		Data:            r,
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package event_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/knative/observability/pkg/event"
+)
+
+var cloudEventsEvent = &v1.Event{
+	ObjectMeta: metav1.ObjectMeta{
+		Name:            "some-pod.157",
+		Namespace:       "some-namespace",
+		UID:             "some-uid",
+		ResourceVersion: "42",
+	},
+	InvolvedObject: v1.ObjectReference{
+		Kind:      "Pod",
+		Name:      "some-pod",
+		Namespace: "some-namespace",
+	},
+	Type:          "Warning",
+	Reason:        "BackOff",
+	Message:       "Back-off restarting failed container",
+	Count:         2,
+	LastTimestamp: metav1.NewTime(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)),
+}
+
+var expectedAttributes = map[string]string{
+	"specversion": "1.0",
+	"id":          "some-uid.42",
+	"source":      "/apis/v1/namespaces/some-namespace/events",
+	"type":        "dev.knative.observability.event.pod.backoff",
+	"subject":     "some-namespace/Pod/some-pod",
+	"time":        "2019-01-01T00:00:00Z",
+}
+
+func TestCloudEventsBinary(t *testing.T) {
+	ResetForwarderMetrics()
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		requests <- r
+		bodies <- b
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	c := event.NewController(event.NewCloudEventsForwarder(server.URL, server.Client(), event.CloudEventsBinary))
+	c.OnAdd(cloudEventsEvent)
+
+	r := <-requests
+	for k, v := range expectedAttributes {
+		if got := r.Header.Get("ce-" + k); got != v {
+			t.Errorf("Expected header ce-%s to be %q, was %q", k, v, got)
+		}
+	}
+	if r.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Expected JSON content type, was %s", r.Header.Get("Content-Type"))
+	}
+
+	var data event.Record
+	if err := json.Unmarshal(<-bodies, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Event.Reason != "BackOff" || data.Event.Count != 2 {
+		t.Errorf("Expected the record as data, got %+v", data)
+	}
+	if event.ForwarderSent.Value() != 1 {
+		t.Errorf("Expected events sent to be 1, was %d", event.ForwarderSent.Value())
+	}
+}
+
+func TestCloudEventsStructured(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		requests <- r
+		bodies <- b
+	}))
+	defer server.Close()
+
+	c := event.NewController(event.NewCloudEventsForwarder(server.URL, server.Client(), event.CloudEventsStructured))
+	c.OnAdd(cloudEventsEvent)
+
+	r := <-requests
+	if r.Header.Get("Content-Type") != "application/cloudevents+json" {
+		t.Errorf("Expected CloudEvents content type, was %s", r.Header.Get("Content-Type"))
+	}
+
+	var ce map[string]interface{}
+	if err := json.Unmarshal(<-bodies, &ce); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range expectedAttributes {
+		if ce[k] != v {
+			t.Errorf("Expected attribute %s to be %q, was %v", k, v, ce[k])
+		}
+	}
+	data, _ := ce["data"].(map[string]interface{})
+	if data["log"] != "Back-off restarting failed container" ||
+		data["summary"] != "Warning BackOff Pod/some-pod (x2): Back-off restarting failed container" {
+		t.Errorf("Expected the record as data, got %v", ce["data"])
+	}
+}
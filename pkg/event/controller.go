@@ -17,10 +17,13 @@ package event
 
 import (
 	"expvar"
-	"fmt"
 	"log"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/api/core/v1"
+	eventsv1beta1 "k8s.io/api/events/v1beta1"
+	"k8s.io/client-go/tools/cache"
 )
 
 var (
@@ -30,6 +33,10 @@ var (
 	ForwarderSent          *expvar.Int
 	ForwarderFailed        *expvar.Int
 	ForwarderConvertFailed *expvar.Int
+	ForwarderFiltered      *expvar.Int
+	ForwarderReplaySkipped *expvar.Int
+	ForwarderAggregated    *expvar.Int
+	ForwarderSuppressed    *expvar.Int
 )
 
 func init() {
@@ -39,65 +46,242 @@ func init() {
 	ForwarderSent = expvar.NewInt("eventcontroller_forwarder_sent_count")
 	ForwarderFailed = expvar.NewInt("eventcontroller_forwarder_failed_count")
 	ForwarderConvertFailed = expvar.NewInt("eventcontroller_convert_failed_count")
+	ForwarderFiltered = expvar.NewInt("eventcontroller_forwarder_filtered_count")
+	ForwarderReplaySkipped = expvar.NewInt("eventcontroller_forwarder_replay_skipped_count")
+	ForwarderAggregated = expvar.NewInt("eventcontroller_forwarder_aggregated_count")
+	ForwarderSuppressed = expvar.NewInt("eventcontroller_forwarder_suppressed_count")
 }
 
+// Forwarder sends records to a destination. Post is given the tag of a
+// record and its fluent form, see Record.Fluent. The fluent-logger-golang
+// client is a Forwarder.
 type Forwarder interface {
 	Post(string, interface{}) error
 }
 
 type Controller struct {
-	f Forwarder
+	f          Forwarder
+	filter     *Filter
+	checkpoint *Checkpoint
+	storm      *StormGuard
+	metrics    *metrics
 }
 
-func NewController(l Forwarder) *Controller {
-	return &Controller{
+type ControllerOpt func(*Controller)
+
+func NewController(l Forwarder, opts ...ControllerOpt) *Controller {
+	c := &Controller{
 		f: l,
 	}
+
+	for _, o := range opts {
+		o(c)
+	}
+	if c.metrics == nil {
+		c.metrics = newMetrics(prometheus.NewRegistry())
+	}
+
+	return c
+}
+
+// WithFilter only forwards events that match the filter.
+func WithFilter(f *Filter) ControllerOpt {
+	return func(c *Controller) {
+		c.filter = f
+	}
+}
+
+// WithCheckpoint skips events that were forwarded before a restart and
+// records the events that are forwarded. The checkpoint should be loaded
+// before the informer starts.
+func WithCheckpoint(cp *Checkpoint) ControllerOpt {
+	return func(c *Controller) {
+		c.checkpoint = cp
+	}
+}
+
+// WithStormGuard rate limits and aggregates events before they are
+// forwarded. Collapsed and suppressed events are forwarded by Run.
+func WithStormGuard(g *StormGuard) ControllerOpt {
+	return func(c *Controller) {
+		c.storm = g
+	}
+}
+
+// Run forwards the records flushed from the storm guard every interval
+// until stopCh is closed.
+func (c *Controller) Run(interval time.Duration, stopCh <-chan struct{}) {
+	if c.storm == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, r := range c.storm.Flush(now) {
+				c.sendToFluent(r)
+			}
+		case <-stopCh:
+			return
+		}
+	}
 }
 
+// OnAdd forwards events of the core/v1 API or the events.k8s.io API, which
+// are converted to the same record.
 func (c *Controller) OnAdd(o interface{}) {
 	ForwarderReceived.Add(1)
-	e, ok := o.(*v1.Event)
+	r, ok := toRecord(o)
 	if !ok {
 		ForwarderConvertFailed.Add(1)
+		c.metrics.convertFailed.Inc()
 		log.Printf("got something other an event: %T\n", o)
 		return
 	}
+	c.metrics.received.With(eventLabels(r)).Inc()
 
-	m := map[string]interface{}{
-		"log":    []byte(e.Message),
-		"stream": []byte("stdout"),
-		"kubernetes": map[string]interface{}{
-			"host":           []byte(e.Source.Host),
-			"pod_name":       []byte(e.InvolvedObject.Name),
-			"namespace_name": []byte(e.InvolvedObject.Namespace),
-			"source_type":    []byte("k8s.event"),
-		},
+	if c.forwarded(r) {
+		ForwarderReplaySkipped.Add(1)
+		return
 	}
 
-	tag := fmt.Sprintf("k8s.event._%s_", e.InvolvedObject.Namespace)
+	c.forward(r)
+}
 
-	c.sendToFluent(tag, m)
+func (c *Controller) forward(r Record) {
+	if !c.filter.Match(r) {
+		ForwarderFiltered.Add(1)
+		return
+	}
+	if c.storm != nil {
+		// Collapsed and suppressed events are handled, so they are not
+		// forwarded again after a restart.
+		switch c.storm.Admit(r, time.Now()) {
+		case StormAggregate:
+			ForwarderAggregated.Add(1)
+			c.mark(r)
+			return
+		case StormSuppress:
+			ForwarderSuppressed.Add(1)
+			c.mark(r)
+			return
+		}
+	}
+	if c.sendToFluent(r) {
+		c.mark(r)
+	}
 }
 
-func (c *Controller) sendToFluent(tag string, m map[string]interface{}) {
-	err := c.f.Post(tag, m)
+func (c *Controller) sendToFluent(r Record) bool {
+	err := c.f.Post(r.Tag(), r.Fluent())
 	if err != nil {
 		if ForwarderFailed.Value()%100 == 0 {
 			log.Printf("unable to forward event: %s\n", err.Error())
 		}
 		ForwarderFailed.Add(1)
-		return
+		c.metrics.failed.With(eventLabels(r)).Inc()
+		return false
 	}
 	ForwarderSent.Add(1)
+	c.metrics.sent.With(eventLabels(r)).Inc()
+	return true
+}
+
+// forwarded reports whether this version of the event was forwarded before
+// a restart.
+func (c *Controller) forwarded(r Record) bool {
+	if c.checkpoint == nil || r.Event.UID == "" {
+		return false
+	}
+	return c.checkpoint.Forwarded(r.Event.UID, r.Event.ResourceVersion)
+}
+
+func (c *Controller) mark(r Record) {
+	if c.checkpoint == nil || r.Event.UID == "" {
+		return
+	}
+	c.checkpoint.Mark(r.Event.UID, r.Event.ResourceVersion, time.Now())
 }
 
+// OnDelete forgets deleted events. Events are not forwarded again when they
+// are deleted.
 func (c *Controller) OnDelete(o interface{}) {
 	ForwarderDelete.Add(1)
-	// Do nothing!
+	if c.checkpoint == nil {
+		return
+	}
+
+	if tombstone, ok := o.(cache.DeletedFinalStateUnknown); ok {
+		o = tombstone.Obj
+	}
+	if r, ok := toRecord(o); ok && r.Event.UID != "" {
+		c.checkpoint.Forget(r.Event.UID)
+	}
 }
 
+// OnUpdate forwards events that recurred. Kubernetes aggregates repeated
+// events by incrementing Count and LastTimestamp of the existing event, or
+// the count and last observed time of its series in the events.k8s.io API.
+// Resyncs deliver updates with an unchanged resourceVersion and are dropped,
+// as are updates that change nothing but metadata.
 func (c *Controller) OnUpdate(o interface{}, n interface{}) {
 	ForwarderUpdate.Add(1)
-	// Do nothing!
+	oldRecord, ok := toRecord(o)
+	if !ok {
+		ForwarderConvertFailed.Add(1)
+		c.metrics.convertFailed.Inc()
+		log.Printf("got something other an event: %T\n", o)
+		return
+	}
+	newRecord, ok := toRecord(n)
+	if !ok {
+		ForwarderConvertFailed.Add(1)
+		c.metrics.convertFailed.Inc()
+		log.Printf("got something other an event: %T\n", n)
+		return
+	}
+
+	if newRecord.Event.ResourceVersion == oldRecord.Event.ResourceVersion {
+		return
+	}
+	oldCount, oldLast := observed(o)
+	newCount, newLast := observed(n)
+	if newCount <= oldCount && !newLast.After(oldLast) {
+		// The event did not recur, so it stays forwarded at its new
+		// resourceVersion.
+		if c.forwarded(oldRecord) {
+			c.mark(newRecord)
+		}
+		return
+	}
+
+	c.forward(newRecord)
+}
+
+// toRecord converts an event of either API.
+func toRecord(o interface{}) (Record, bool) {
+	switch e := o.(type) {
+	case *v1.Event:
+		return NewRecord(e), true
+	case *eventsv1beta1.Event:
+		return NewEventsRecord(e), true
+	default:
+		return Record{}, false
+	}
+}
+
+// observed returns the count and the time an event of either API was last
+// observed.
+func observed(o interface{}) (int32, time.Time) {
+	switch e := o.(type) {
+	case *v1.Event:
+		return e.Count, e.LastTimestamp.Time
+	case *eventsv1beta1.Event:
+		return observedEvents(e)
+	default:
+		return 0, time.Time{}
+	}
 }
@@ -20,10 +20,12 @@ import (
 	"io/ioutil"
 	"log"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/knative/observability/pkg/event"
 )
@@ -38,26 +40,65 @@ func TestForwarding(t *testing.T) {
 		t: t,
 	}
 	c := event.NewController(spyFl)
+	first := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
 	ev := &v1.Event{
-		InvolvedObject: v1.ObjectReference{
-			Name:      "some-object-name",
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "some-object-name.157",
 			Namespace: "some-namespace",
 		},
+		InvolvedObject: v1.ObjectReference{
+			Kind:       "Pod",
+			Name:       "some-object-name",
+			Namespace:  "some-namespace",
+			UID:        "some-uid",
+			APIVersion: "v1",
+			FieldPath:  "spec.containers{app}",
+		},
+		Reason:  "BackOff",
+		Type:    "Warning",
 		Message: "some note with log data",
 		Source: v1.EventSource{
-			Host: "some-host",
+			Component: "kubelet",
+			Host:      "some-host",
 		},
+		Count:               3,
+		FirstTimestamp:      metav1.NewTime(first),
+		LastTimestamp:       metav1.NewTime(first.Add(time.Minute)),
+		ReportingController: "kubelet",
+		ReportingInstance:   "some-host",
 	}
 
 	expected := map[string]interface{}{
-		"log":    []byte("some note with log data"),
-		"stream": []byte("stdout"),
+		"log":     []byte("some note with log data"),
+		"summary": []byte("Warning BackOff Pod/some-object-name[spec.containers{app}] (x3): some note with log data"),
+		"stream":  []byte("stdout"),
 		"kubernetes": map[string]interface{}{
 			"host":           []byte("some-host"),
 			"pod_name":       []byte("some-object-name"),
 			"namespace_name": []byte("some-namespace"),
 			"source_type":    []byte("k8s.event"),
 		},
+		"event": map[string]interface{}{
+			"name":                 []byte("some-object-name.157"),
+			"namespace":            []byte("some-namespace"),
+			"type":                 []byte("Warning"),
+			"reason":               []byte("BackOff"),
+			"message":              []byte("some note with log data"),
+			"count":                int32(3),
+			"first_timestamp":      []byte("2019-01-01T00:00:00Z"),
+			"last_timestamp":       []byte("2019-01-01T00:01:00Z"),
+			"source_component":     []byte("kubelet"),
+			"reporting_controller": []byte("kubelet"),
+			"reporting_instance":   []byte("some-host"),
+			"involved_object": map[string]interface{}{
+				"kind":        []byte("Pod"),
+				"namespace":   []byte("some-namespace"),
+				"name":        []byte("some-object-name"),
+				"uid":         []byte("some-uid"),
+				"api_version": []byte("v1"),
+				"field_path":  []byte("spec.containers{app}"),
+			},
+		},
 	}
 
 	c.OnAdd(ev)
@@ -84,6 +125,84 @@ func TestNoopUpdate(t *testing.T) {
 	}
 }
 
+func TestForwardingRecurrences(t *testing.T) {
+	now := time.Now()
+	old := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{ResourceVersion: "1"},
+		InvolvedObject: v1.ObjectReference{
+			Name:      "some-object-name",
+			Namespace: "some-namespace",
+		},
+		Message:       "Back-off restarting failed container",
+		Count:         1,
+		LastTimestamp: metav1.NewTime(now),
+	}
+
+	tests := []struct {
+		name    string
+		update  func(e *v1.Event)
+		forward bool
+	}{
+		{
+			name: "count advanced",
+			update: func(e *v1.Event) {
+				e.ResourceVersion = "2"
+				e.Count = 200
+			},
+			forward: true,
+		},
+		{
+			name: "last timestamp advanced",
+			update: func(e *v1.Event) {
+				e.ResourceVersion = "2"
+				e.LastTimestamp = metav1.NewTime(now.Add(time.Minute))
+			},
+			forward: true,
+		},
+		{
+			name: "resync",
+			update: func(e *v1.Event) {
+				e.Count = 200
+			},
+		},
+		{
+			name: "metadata only",
+			update: func(e *v1.Event) {
+				e.ResourceVersion = "2"
+				e.Labels = map[string]string{"some": "label"}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ResetForwarderMetrics()
+			spyFl := &spyFlogger{
+				t: t,
+			}
+			c := event.NewController(spyFl)
+
+			n := old.DeepCopy()
+			test.update(n)
+			c.OnUpdate(old, n)
+
+			if spyFl.called != test.forward {
+				t.Fatalf("Expected forwarded to be %t, was %t", test.forward, spyFl.called)
+			}
+			if !test.forward {
+				return
+			}
+			count := spyFl.receivedMsg["event"].(map[string]interface{})["count"]
+			if count != n.Count {
+				t.Errorf("Expected count to be %d, was %v", n.Count, count)
+			}
+			if event.ForwarderSent.Value() != 1 {
+				t.Errorf("Expected events sent to be 1, was %d", event.ForwarderSent.Value())
+			}
+		})
+	}
+}
+
 func TestNoopDelete(t *testing.T) {
 	spyFl := &spyFlogger{
 		t: t,
@@ -159,14 +278,24 @@ func TestEmptySource(t *testing.T) {
 	}
 
 	expected := map[string]interface{}{
-		"log":    []byte("some note with log data"),
-		"stream": []byte("stdout"),
+		"log":     []byte("some note with log data"),
+		"summary": []byte("some-object-name: some note with log data"),
+		"stream":  []byte("stdout"),
 		"kubernetes": map[string]interface{}{
 			"host":           []byte(""),
-			"pod_name":       []byte("some-object-name"),
 			"namespace_name": []byte("some-namespace"),
 			"source_type":    []byte("k8s.event"),
 		},
+		"event": map[string]interface{}{
+			"name":      []byte(""),
+			"namespace": []byte(""),
+			"message":   []byte("some note with log data"),
+			"count":     int32(0),
+			"involved_object": map[string]interface{}{
+				"namespace": []byte("some-namespace"),
+				"name":      []byte("some-object-name"),
+			},
+		},
 	}
 
 	c.OnAdd(ev)
@@ -183,6 +312,10 @@ func ResetForwarderMetrics() {
 	event.ForwarderSent.Set(0)
 	event.ForwarderFailed.Set(0)
 	event.ForwarderConvertFailed.Set(0)
+	event.ForwarderFiltered.Set(0)
+	event.ForwarderReplaySkipped.Set(0)
+	event.ForwarderAggregated.Set(0)
+	event.ForwarderSuppressed.Set(0)
 }
 
 type spyFlogger struct {
@@ -0,0 +1,127 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package event
+
+import (
+	"time"
+
+	eventsv1beta1 "k8s.io/api/events/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+// EventsV1 is the events.k8s.io/v1 API. It has the same schema as
+// events.k8s.io/v1beta1, so its events are decoded into the v1beta1 types.
+var EventsV1 = schema.GroupVersion{Group: "events.k8s.io", Version: "v1"}
+
+// NewEventsRecord converts an events.k8s.io event. Note is the message and
+// the regarding object is the involved object. Events in a series have the
+// count and last observed time of the series, other events have the
+// deprecated core fields when they are set.
+func NewEventsRecord(e *eventsv1beta1.Event) Record {
+	r := Record{
+		Log:    e.Note,
+		Stream: "stdout",
+		Kubernetes: KubernetesRecord{
+			Host:          e.DeprecatedSource.Host,
+			NamespaceName: e.Regarding.Namespace,
+			SourceType:    "k8s.event",
+		},
+		Event: EventRecord{
+			Name:                e.Name,
+			Namespace:           e.Namespace,
+			UID:                 string(e.UID),
+			ResourceVersion:     e.ResourceVersion,
+			Type:                e.Type,
+			Reason:              e.Reason,
+			Action:              e.Action,
+			Message:             e.Note,
+			Count:               e.DeprecatedCount,
+			FirstTimestamp:      formatTime(e.DeprecatedFirstTimestamp.Time),
+			LastTimestamp:       formatTime(e.DeprecatedLastTimestamp.Time),
+			EventTime:           formatTime(e.EventTime.Time),
+			SourceComponent:     e.DeprecatedSource.Component,
+			ReportingController: e.ReportingController,
+			ReportingInstance:   e.ReportingInstance,
+			InvolvedObject:      newObjectReference(e.Regarding),
+		},
+	}
+	if e.Related != nil {
+		related := newObjectReference(*e.Related)
+		r.Event.Related = &related
+	}
+	if s := e.Series; s != nil {
+		r.Event.Count = s.Count
+		r.Event.LastTimestamp = formatTime(s.LastObservedTime.Time)
+		r.Event.Series = &SeriesRecord{
+			Count:            s.Count,
+			LastObservedTime: formatTime(s.LastObservedTime.Time),
+			State:            string(s.State),
+		}
+	}
+	if r.Event.Count == 0 {
+		r.Event.Count = 1
+	}
+	if e.Regarding.Kind == "Pod" {
+		r.Kubernetes.PodName = e.Regarding.Name
+	}
+	r.Summary = r.summary()
+
+	return r
+}
+
+// observedEvents returns the count and the time an events.k8s.io event was
+// last observed.
+func observedEvents(e *eventsv1beta1.Event) (int32, time.Time) {
+	if s := e.Series; s != nil {
+		return s.Count, s.LastObservedTime.Time
+	}
+	last := e.EventTime.Time
+	if e.DeprecatedLastTimestamp.After(last) {
+		last = e.DeprecatedLastTimestamp.Time
+	}
+	if e.DeprecatedCount == 0 {
+		return 1, last
+	}
+	return e.DeprecatedCount, last
+}
+
+// NewEventsV1ListWatch lists and watches the events.k8s.io/v1 events of all
+// namespaces. The informer's object type is the v1beta1 Event.
+func NewEventsV1ListWatch(cfg *rest.Config) (cache.ListerWatcher, error) {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypes(EventsV1, &eventsv1beta1.Event{}, &eventsv1beta1.EventList{})
+	metav1.AddToGroupVersion(scheme, EventsV1)
+
+	c := rest.CopyConfig(cfg)
+	c.GroupVersion = &EventsV1
+	c.APIPath = "/apis"
+	c.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: serializer.NewCodecFactory(scheme)}
+	if c.UserAgent == "" {
+		c.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+
+	client, err := rest.RESTClientFor(c)
+	if err != nil {
+		return nil, err
+	}
+	return cache.NewListWatchFromClient(client, "events", metav1.NamespaceAll, fields.Everything()), nil
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package event_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	eventsv1beta1 "k8s.io/api/events/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+
+	"github.com/knative/observability/pkg/event"
+)
+
+var seriesTime = time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func seriesEvent(resourceVersion string, series *eventsv1beta1.EventSeries) *eventsv1beta1.Event {
+	return &eventsv1beta1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "some-pod.157",
+			Namespace:       "some-namespace",
+			UID:             "some-uid",
+			ResourceVersion: resourceVersion,
+		},
+		EventTime:           metav1.NewMicroTime(seriesTime),
+		Series:              series,
+		ReportingController: "kubernetes.io/kubelet",
+		ReportingInstance:   "kubelet-some-host",
+		Action:              "Pulling",
+		Reason:              "BackOff",
+		Regarding: v1.ObjectReference{
+			Kind:      "Pod",
+			Name:      "some-pod",
+			Namespace: "some-namespace",
+		},
+		Related: &v1.ObjectReference{
+			Kind:      "Node",
+			Name:      "some-node",
+			FieldPath: "spec",
+		},
+		Note: "Back-off pulling image",
+		Type: "Warning",
+	}
+}
+
+func TestNewEventsRecord(t *testing.T) {
+	r := event.NewEventsRecord(seriesEvent("1", &eventsv1beta1.EventSeries{
+		Count:            3,
+		LastObservedTime: metav1.NewMicroTime(seriesTime.Add(time.Minute)),
+		State:            eventsv1beta1.EventSeriesStateOngoing,
+	}))
+
+	expected := event.Record{
+		Log:     "Back-off pulling image",
+		Summary: "Warning BackOff Pod/some-pod (x3): Back-off pulling image",
+		Stream:  "stdout",
+		Kubernetes: event.KubernetesRecord{
+			NamespaceName: "some-namespace",
+			PodName:       "some-pod",
+			SourceType:    "k8s.event",
+		},
+		Event: event.EventRecord{
+			Name:            "some-pod.157",
+			Namespace:       "some-namespace",
+			UID:             "some-uid",
+			ResourceVersion: "1",
+			Type:            "Warning",
+			Reason:          "BackOff",
+			Action:          "Pulling",
+			Message:         "Back-off pulling image",
+			Count:           3,
+			Series: &event.SeriesRecord{
+				Count:            3,
+				LastObservedTime: "2019-01-01T00:01:00Z",
+				State:            "Ongoing",
+			},
+			LastTimestamp:       "2019-01-01T00:01:00Z",
+			EventTime:           "2019-01-01T00:00:00Z",
+			ReportingController: "kubernetes.io/kubelet",
+			ReportingInstance:   "kubelet-some-host",
+			InvolvedObject: event.ObjectReference{
+				Kind:      "Pod",
+				Namespace: "some-namespace",
+				Name:      "some-pod",
+			},
+			Related: &event.ObjectReference{
+				Kind:      "Node",
+				Name:      "some-node",
+				FieldPath: "spec",
+			},
+		},
+	}
+	if !reflect.DeepEqual(r, expected) {
+		t.Errorf("Unexpected record\nexpected: %+v\ngot:      %+v", expected, r)
+	}
+
+	t.Run("singletons have a count of one", func(t *testing.T) {
+		r := event.NewEventsRecord(seriesEvent("1", nil))
+		if r.Event.Count != 1 || r.Event.Series != nil {
+			t.Errorf("Expected a single event, got %+v", r.Event)
+		}
+	})
+
+	t.Run("the fluent record has the events.k8s.io fields", func(t *testing.T) {
+		e := r.Fluent()["event"].(map[string]interface{})
+		if string(e["action"].([]byte)) != "Pulling" {
+			t.Errorf("Expected the action, got %v", e["action"])
+		}
+		related := e["related"].(map[string]interface{})
+		if string(related["name"].([]byte)) != "some-node" {
+			t.Errorf("Expected the related object, got %v", related)
+		}
+		series := e["series"].(map[string]interface{})
+		if series["count"] != int32(3) || string(series["state"].([]byte)) != "Ongoing" {
+			t.Errorf("Expected the series, got %v", series)
+		}
+	})
+}
+
+func TestForwardingSeries(t *testing.T) {
+	singleton := seriesEvent("1", nil)
+	started := seriesEvent("2", &eventsv1beta1.EventSeries{
+		Count:            2,
+		LastObservedTime: metav1.NewMicroTime(seriesTime.Add(time.Minute)),
+		State:            eventsv1beta1.EventSeriesStateOngoing,
+	})
+	finished := seriesEvent("3", &eventsv1beta1.EventSeries{
+		Count:            2,
+		LastObservedTime: metav1.NewMicroTime(seriesTime.Add(time.Minute)),
+		State:            eventsv1beta1.EventSeriesStateFinished,
+	})
+
+	ResetForwarderMetrics()
+	spyFl := &spyFlogger{t: t}
+	c := event.NewController(spyFl)
+
+	c.OnAdd(singleton)
+	if !spyFl.called {
+		t.Fatalf("Expected events.k8s.io events to be forwarded")
+	}
+
+	spyFl.called = false
+	c.OnUpdate(singleton, started)
+	if !spyFl.called {
+		t.Errorf("Expected the start of a series to be forwarded")
+	}
+
+	spyFl.called = false
+	c.OnUpdate(started, finished)
+	if spyFl.called {
+		t.Errorf("Expected the end of a series not to be forwarded")
+	}
+	if event.ForwarderSent.Value() != 2 {
+		t.Errorf("Expected events sent to be 2, was %d", event.ForwarderSent.Value())
+	}
+}
+
+func TestEventsV1ListWatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/events.k8s.io/v1/events" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"kind": "EventList",
+			"apiVersion": "events.k8s.io/v1",
+			"metadata": {"resourceVersion": "10"},
+			"items": [{
+				"metadata": {"name": "some-pod.157", "namespace": "some-namespace"},
+				"series": {"count": 4, "lastObservedTime": "2019-01-01T00:01:00.000000Z"},
+				"action": "Pulling",
+				"regarding": {"kind": "Pod", "name": "some-pod", "namespace": "some-namespace"},
+				"note": "Back-off pulling image"
+			}]
+		}`))
+	}))
+	defer server.Close()
+
+	lw, err := event.NewEventsV1ListWatch(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := lw.List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, ok := o.(*eventsv1beta1.EventList)
+	if !ok || len(list.Items) != 1 {
+		t.Fatalf("Expected a list of 1 event, got %#v", o)
+	}
+	r := event.NewEventsRecord(&list.Items[0])
+	if r.Event.Count != 4 || r.Event.Action != "Pulling" || r.Event.Message != "Back-off pulling image" {
+		t.Errorf("Unexpected record %+v", r.Event)
+	}
+}
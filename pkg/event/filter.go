@@ -0,0 +1,116 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package event
+
+import (
+	"fmt"
+	"regexp"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Filter decides which events are forwarded. An event is forwarded when it
+// matches any Include rule, or there are none, and matches no Exclude rule.
+type Filter struct {
+	Include []FilterRule `json:"include,omitempty"`
+	Exclude []FilterRule `json:"exclude,omitempty"`
+}
+
+// FilterRule matches events that match all of its fields. Empty fields
+// match every event. Reason is a regular expression that must match the
+// whole reason.
+type FilterRule struct {
+	Namespaces []string `json:"namespaces,omitempty"`
+	Types      []string `json:"types,omitempty"`
+	Reason     string   `json:"reason,omitempty"`
+	Kinds      []string `json:"kinds,omitempty"`
+
+	reason *regexp.Regexp
+}
+
+// ParseFilter reads a filter from YAML or JSON.
+func ParseFilter(data []byte) (*Filter, error) {
+	var f Filter
+	err := yaml.UnmarshalStrict(data, &f)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rules := range [][]FilterRule{f.Include, f.Exclude} {
+		for i := range rules {
+			r := &rules[i]
+			if r.Reason == "" {
+				continue
+			}
+			r.reason, err = regexp.Compile("^(?:" + r.Reason + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("bad reason regex %q: %s", r.Reason, err)
+			}
+		}
+	}
+
+	return &f, nil
+}
+
+// Match reports whether the record should be forwarded. A nil filter
+// forwards everything.
+func (f *Filter) Match(r Record) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(f.Include) > 0 && !anyRuleMatches(f.Include, r) {
+		return false
+	}
+	return !anyRuleMatches(f.Exclude, r)
+}
+
+func anyRuleMatches(rules []FilterRule, r Record) bool {
+	for _, rule := range rules {
+		if rule.matches(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule FilterRule) matches(r Record) bool {
+	if !matchesAny(rule.Namespaces, r.Kubernetes.NamespaceName) {
+		return false
+	}
+	if !matchesAny(rule.Types, r.Event.Type) {
+		return false
+	}
+	if !matchesAny(rule.Kinds, r.Event.InvolvedObject.Kind) {
+		return false
+	}
+	if rule.reason != nil && !rule.reason.MatchString(r.Event.Reason) {
+		return false
+	}
+	return true
+}
+
+func matchesAny(values []string, v string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package event_test
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+
+	"github.com/knative/observability/pkg/event"
+)
+
+const testFilter = `
+include:
+- namespaces: [prod, staging]
+- types: [Warning]
+exclude:
+- types: [Normal]
+  reason: Pulled|Pulling|Scheduled
+- kinds: [Node]
+`
+
+func TestFilter(t *testing.T) {
+	f, err := event.ParseFilter([]byte(testFilter))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		eventType string
+		reason    string
+		kind      string
+		forward   bool
+	}{
+		{"included namespace", "prod", "Normal", "Started", "Pod", true},
+		{"included type", "dev", "Warning", "BackOff", "Pod", true},
+		{"not included", "dev", "Normal", "Started", "Pod", false},
+		{"excluded reason", "prod", "Normal", "Scheduled", "Pod", false},
+		{"reason must match whole", "prod", "Normal", "PulledTwice", "Pod", true},
+		{"excluded reason of other type", "prod", "Warning", "Pulled", "Pod", true},
+		{"excluded kind", "prod", "Warning", "NodeNotReady", "Node", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := event.NewRecord(&v1.Event{
+				InvolvedObject: v1.ObjectReference{
+					Kind:      test.kind,
+					Name:      "some-object-name",
+					Namespace: test.namespace,
+				},
+				Type:   test.eventType,
+				Reason: test.reason,
+			})
+			if got := f.Match(r); got != test.forward {
+				t.Errorf("Expected match to be %t, was %t", test.forward, got)
+			}
+		})
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	for _, filter := range []string{
+		`include: [{reason: "("}]`,
+		`exclude: [{namespace: [default]}]`,
+	} {
+		if _, err := event.ParseFilter([]byte(filter)); err == nil {
+			t.Errorf("Expected error for %s", filter)
+		}
+	}
+}
+
+func TestFilteredForwarding(t *testing.T) {
+	ResetForwarderMetrics()
+	f, err := event.ParseFilter([]byte(`exclude: [{types: [Normal]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spyFl := &spyFlogger{
+		t: t,
+	}
+	c := event.NewController(spyFl, event.WithFilter(f))
+
+	c.OnAdd(&v1.Event{Type: "Normal", Reason: "Pulled"})
+
+	if spyFl.called {
+		t.Errorf("Expected not to call Flogger")
+	}
+	if event.ForwarderFiltered.Value() != 1 {
+		t.Errorf("Expected events filtered to be 1, was %d", event.ForwarderFiltered.Value())
+	}
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package event
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WebhookForwarder posts each record as JSON to a URL.
+type WebhookForwarder struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookForwarder(url string, client *http.Client) *WebhookForwarder {
+	return &WebhookForwarder{
+		url:    url,
+		client: client,
+	}
+}
+
+func (f *WebhookForwarder) Post(_ string, msg interface{}) error {
+	body, err := json.Marshal(jsonRecord(msg))
+	if err != nil {
+		return err
+	}
+
+	resp, err := f.client.Post(f.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code from %s: %d", f.url, resp.StatusCode)
+	}
+	return nil
+}
+
+// JSONLinesForwarder writes each record as a line of JSON, for example to
+// stdout for local debugging.
+type JSONLinesForwarder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewJSONLinesForwarder(w io.Writer) *JSONLinesForwarder {
+	return &JSONLinesForwarder{
+		enc: json.NewEncoder(w),
+	}
+}
+
+func (f *JSONLinesForwarder) Post(_ string, msg interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.enc.Encode(jsonRecord(msg))
+}
+
+// SyslogForwarder sends records as RFC 5424 messages over TCP, or TLS when
+// it has a TLS config, with octet counting framing. Events of type Warning
+// have warning severity, others informational. The app name is the
+// namespace and the message is the Log field of the record.
+type SyslogForwarder struct {
+	addr      string
+	tlsConfig *tls.Config
+	timeout   time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func NewSyslogForwarder(addr string, tlsConfig *tls.Config) *SyslogForwarder {
+	return &SyslogForwarder{
+		addr:      addr,
+		tlsConfig: tlsConfig,
+		timeout:   5 * time.Second,
+	}
+}
+
+const (
+	syslogFacilityUser    = 1
+	syslogSeverityWarning = 4
+	syslogSeverityInfo    = 6
+)
+
+func (f *SyslogForwarder) Post(_ string, msg interface{}) error {
+	line := syslogMessage(jsonRecord(msg), time.Now())
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.conn == nil {
+		conn, err := f.dial()
+		if err != nil {
+			return err
+		}
+		f.conn = conn
+	}
+
+	f.conn.SetWriteDeadline(time.Now().Add(f.timeout))
+	_, err := fmt.Fprintf(f.conn, "%d %s", len(line), line)
+	if err != nil {
+		// Reconnect on the next record.
+		f.conn.Close()
+		f.conn = nil
+	}
+	return err
+}
+
+func (f *SyslogForwarder) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.conn == nil {
+		return nil
+	}
+	err := f.conn.Close()
+	f.conn = nil
+	return err
+}
+
+func (f *SyslogForwarder) dial() (net.Conn, error) {
+	d := &net.Dialer{Timeout: f.timeout}
+	if f.tlsConfig != nil {
+		return tls.DialWithDialer(d, "tcp", f.addr, f.tlsConfig)
+	}
+	return d.Dial("tcp", f.addr)
+}
+
+func syslogMessage(r map[string]interface{}, t time.Time) string {
+	kubernetes, _ := r["kubernetes"].(map[string]interface{})
+	event, _ := r["event"].(map[string]interface{})
+
+	severity := syslogSeverityInfo
+	if event["type"] == "Warning" {
+		severity = syslogSeverityWarning
+	}
+
+	return fmt.Sprintf(
+		"<%d>1 %s %s %s - - - %s\n",
+		syslogFacilityUser*8+severity,
+		t.UTC().Format(time.RFC3339Nano),
+		syslogHeader(kubernetes["host"], 255),
+		syslogHeader(kubernetes["namespace_name"], 48),
+		r["log"],
+	)
+}
+
+// syslogHeader returns a header field of at most n printable characters, or
+// the nil value "-".
+func syslogHeader(v interface{}, n int) string {
+	s, _ := v.(string)
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(b) < n; i++ {
+		if s[i] > 32 && s[i] < 127 {
+			b = append(b, s[i])
+		}
+	}
+	if len(b) == 0 {
+		return "-"
+	}
+	return string(b)
+}
+
+// jsonRecord converts the fluent form of a record back to the JSON schema
+// of Record, where strings are not bytes.
+func jsonRecord(msg interface{}) map[string]interface{} {
+	m, ok := msg.(map[string]interface{})
+	if !ok {
+		return map[string]interface{}{"log": fmt.Sprint(msg)}
+	}
+	return jsonValue(m).(map[string]interface{})
+}
+
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		return string(v)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = jsonValue(e)
+		}
+		return m
+	default:
+		return v
+	}
+}
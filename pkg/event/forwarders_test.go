@@ -0,0 +1,158 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package event_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"k8s.io/api/core/v1"
+
+	"github.com/knative/observability/pkg/event"
+)
+
+var warningEvent = &v1.Event{
+	InvolvedObject: v1.ObjectReference{
+		Kind:      "Pod",
+		Name:      "some-pod",
+		Namespace: "some-namespace",
+	},
+	Type:    "Warning",
+	Reason:  "BackOff",
+	Message: "Back-off restarting failed container",
+	Source: v1.EventSource{
+		Host: "some-host",
+	},
+	Count: 2,
+}
+
+func TestWebhookForwarder(t *testing.T) {
+	ResetForwarderMetrics()
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected JSON content type, was %s", r.Header.Get("Content-Type"))
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies <- b
+	}))
+	defer server.Close()
+
+	c := event.NewController(event.NewWebhookForwarder(server.URL, server.Client()))
+	c.OnAdd(warningEvent)
+
+	var r event.Record
+	if err := json.Unmarshal(<-bodies, &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Event.Reason != "BackOff" || r.Kubernetes.PodName != "some-pod" {
+		t.Errorf("Expected the record as JSON, got %+v", r)
+	}
+	if event.ForwarderSent.Value() != 1 {
+		t.Errorf("Expected events sent to be 1, was %d", event.ForwarderSent.Value())
+	}
+}
+
+func TestWebhookForwarderFailure(t *testing.T) {
+	ResetForwarderMetrics()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	c := event.NewController(event.NewWebhookForwarder(server.URL, server.Client()))
+	c.OnAdd(warningEvent)
+
+	if event.ForwarderFailed.Value() != 1 {
+		t.Errorf("Expected events failed to be 1, was %d", event.ForwarderFailed.Value())
+	}
+}
+
+func TestJSONLinesForwarder(t *testing.T) {
+	var buf bytes.Buffer
+	c := event.NewController(event.NewJSONLinesForwarder(&buf))
+	c.OnAdd(warningEvent)
+	c.OnAdd(warningEvent)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+	var r event.Record
+	if err := json.Unmarshal([]byte(lines[0]), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Log != "Back-off restarting failed container" {
+		t.Errorf("Unexpected log %q", r.Log)
+	}
+	if r.Summary != "Warning BackOff Pod/some-pod (x2): Back-off restarting failed container" {
+		t.Errorf("Unexpected summary %q", r.Summary)
+	}
+}
+
+func TestSyslogForwarder(t *testing.T) {
+	ResetForwarderMetrics()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+
+	messages := make(chan string, 2)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			length, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(length))
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(r, msg); err != nil {
+				return
+			}
+			messages <- string(msg)
+		}
+	}()
+
+	f := event.NewSyslogForwarder(lis.Addr().String(), nil)
+	defer f.Close()
+	c := event.NewController(f)
+	c.OnAdd(warningEvent)
+
+	expected := regexp.MustCompile(`^<12>1 \S+ some-host some-namespace - - - Back-off restarting failed container\n$`)
+	if msg := <-messages; !expected.MatchString(msg) {
+		t.Errorf("Unexpected syslog message %q", msg)
+	}
+	if event.ForwarderSent.Value() != 1 {
+		t.Errorf("Expected events sent to be 1, was %d", event.ForwarderSent.Value())
+	}
+}
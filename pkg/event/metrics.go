@@ -0,0 +1,73 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package event
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metrics are the Prometheus metrics of a Controller. They count the same
+// events as the expvar counters, labelled by the namespace of the involved
+// object and the event type.
+type metrics struct {
+	received      *prometheus.CounterVec
+	sent          *prometheus.CounterVec
+	failed        *prometheus.CounterVec
+	convertFailed prometheus.Counter
+}
+
+func newMetrics(reg prometheus.Registerer) *metrics {
+	m := &metrics{
+		received: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "eventcontroller",
+			Name:      "forwarder_received_total",
+			Help:      "Events received from the informer, by namespace and type.",
+		}, []string{"namespace", "type"}),
+		sent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "eventcontroller",
+			Name:      "forwarder_sent_total",
+			Help:      "Records forwarded, by namespace and type.",
+		}, []string{"namespace", "type"}),
+		failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "eventcontroller",
+			Name:      "forwarder_failed_total",
+			Help:      "Records that failed to forward, by namespace and type.",
+		}, []string{"namespace", "type"}),
+		convertFailed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "eventcontroller",
+			Name:      "convert_failed_total",
+			Help:      "Objects received from the informer that were not events.",
+		}),
+	}
+
+	reg.MustRegister(m.received, m.sent, m.failed, m.convertFailed)
+	return m
+}
+
+// WithMetrics registers the controller metrics with reg instead of a
+// private registry.
+func WithMetrics(reg prometheus.Registerer) ControllerOpt {
+	return func(c *Controller) {
+		c.metrics = newMetrics(reg)
+	}
+}
+
+func eventLabels(r Record) prometheus.Labels {
+	return prometheus.Labels{
+		"namespace": r.Kubernetes.NamespaceName,
+		"type":      r.Event.Type,
+	}
+}
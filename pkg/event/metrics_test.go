@@ -0,0 +1,64 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package event_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/knative/observability/pkg/event"
+	"github.com/knative/observability/pkg/metrictest"
+)
+
+func TestMetrics(t *testing.T) {
+	ResetForwarderMetrics()
+	reg := prometheus.NewRegistry()
+	c := event.NewController(&spyFlogger{t: t}, event.WithMetrics(reg))
+	c.OnAdd(warningEvent)
+	c.OnAdd(warningEvent)
+	c.OnAdd("not an event")
+
+	failingReg := prometheus.NewRegistry()
+	failing := event.NewController(&spyFlogger{t: t, err: errors.New("some error")}, event.WithMetrics(failingReg))
+	failing.OnAdd(warningEvent)
+
+	labels := map[string]string{"namespace": "some-namespace", "type": "Warning"}
+	tests := []struct {
+		reg    *prometheus.Registry
+		name   string
+		labels map[string]string
+		value  float64
+	}{
+		{reg, "eventcontroller_forwarder_received_total", labels, 2},
+		{reg, "eventcontroller_forwarder_sent_total", labels, 2},
+		{reg, "eventcontroller_forwarder_failed_total", labels, 0},
+		{reg, "eventcontroller_convert_failed_total", nil, 1},
+		{failingReg, "eventcontroller_forwarder_failed_total", labels, 1},
+	}
+	for _, test := range tests {
+		if got := metrictest.Value(t, test.reg, test.name, test.labels); got != test.value {
+			t.Errorf("Expected %s%v to be %v, got %v", test.name, test.labels, test.value, got)
+		}
+	}
+
+	if event.ForwarderSent.Value() != 2 || event.ForwarderConvertFailed.Value() != 1 {
+		t.Errorf("Expected the expvar counters to be kept, got sent %d, convert failed %d",
+			event.ForwarderSent.Value(), event.ForwarderConvertFailed.Value())
+	}
+}
+
@@ -0,0 +1,270 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package event
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/api/core/v1"
+)
+
+// Record is the schema of a forwarded Kubernetes event. It has two forms:
+//
+// The syslog-compatible form is Log together with the Kubernetes fields, the
+// same fields fluent-bit sets on container logs. Syslog sinks only send
+// these, so Log is the message of the event as it always has been. Summary
+// describes the event on one line for readers that want more than the
+// message:
+//
+//   Warning BackOff Pod/web-7d4b9 (x200): Back-off restarting failed container
+//
+// The structured form is the Event field, which has every field needed to
+// alert on events without parsing Log or Summary. Sinks that send whole
+// records, such as webhooks, include it.
+//
+// Timestamps are RFC 3339 in UTC and empty values are omitted. Events of
+// the core and events.k8s.io APIs have the same schema; Action, Related and
+// Series are only set by the events.k8s.io API.
+//
+// During event storms, Aggregated is the number of occurrences of the event
+// collapsed into the record, and summary records of events dropped by rate
+// limits have the EventsSuppressed reason and count them by reason in
+// Suppressed. See StormGuard.
+type Record struct {
+	Log        string           `json:"log"`
+	Summary    string           `json:"summary"`
+	Stream     string           `json:"stream"`
+	Kubernetes KubernetesRecord `json:"kubernetes"`
+	Event      EventRecord      `json:"event"`
+	Aggregated int32            `json:"aggregated,omitempty"`
+	Suppressed map[string]int32 `json:"suppressed,omitempty"`
+}
+
+// KubernetesRecord holds the fields fluent-bit uses to route and label
+// records. PodName is only set for events about pods.
+type KubernetesRecord struct {
+	Host          string `json:"host"`
+	NamespaceName string `json:"namespace_name"`
+	PodName       string `json:"pod_name,omitempty"`
+	SourceType    string `json:"source_type"`
+}
+
+// EventRecord is the structured form of an event.
+type EventRecord struct {
+	Name                string           `json:"name"`
+	Namespace           string           `json:"namespace"`
+	UID                 string           `json:"uid,omitempty"`
+	ResourceVersion     string           `json:"resource_version,omitempty"`
+	Type                string           `json:"type,omitempty"`
+	Reason              string           `json:"reason,omitempty"`
+	Action              string           `json:"action,omitempty"`
+	Message             string           `json:"message,omitempty"`
+	Count               int32            `json:"count"`
+	Series              *SeriesRecord    `json:"series,omitempty"`
+	FirstTimestamp      string           `json:"first_timestamp,omitempty"`
+	LastTimestamp       string           `json:"last_timestamp,omitempty"`
+	EventTime           string           `json:"event_time,omitempty"`
+	SourceComponent     string           `json:"source_component,omitempty"`
+	ReportingController string           `json:"reporting_controller,omitempty"`
+	ReportingInstance   string           `json:"reporting_instance,omitempty"`
+	InvolvedObject      ObjectReference  `json:"involved_object"`
+	Related             *ObjectReference `json:"related,omitempty"`
+}
+
+// SeriesRecord describes a series of events.k8s.io events. Count is also
+// the count of the event.
+type SeriesRecord struct {
+	Count            int32  `json:"count"`
+	LastObservedTime string `json:"last_observed_time,omitempty"`
+	State            string `json:"state,omitempty"`
+}
+
+// ObjectReference identifies the object an event is about.
+type ObjectReference struct {
+	Kind       string `json:"kind,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name,omitempty"`
+	UID        string `json:"uid,omitempty"`
+	APIVersion string `json:"api_version,omitempty"`
+	FieldPath  string `json:"field_path,omitempty"`
+}
+
+// NewRecord converts a core/v1 event.
+func NewRecord(e *v1.Event) Record {
+	r := Record{
+		Log:    e.Message,
+		Stream: "stdout",
+		Kubernetes: KubernetesRecord{
+			Host:          e.Source.Host,
+			NamespaceName: e.InvolvedObject.Namespace,
+			SourceType:    "k8s.event",
+		},
+		Event: EventRecord{
+			Name:                e.Name,
+			Namespace:           e.Namespace,
+			UID:                 string(e.UID),
+			ResourceVersion:     e.ResourceVersion,
+			Type:                e.Type,
+			Reason:              e.Reason,
+			Message:             e.Message,
+			Count:               e.Count,
+			FirstTimestamp:      formatTime(e.FirstTimestamp.Time),
+			LastTimestamp:       formatTime(e.LastTimestamp.Time),
+			EventTime:           formatTime(e.EventTime.Time),
+			SourceComponent:     e.Source.Component,
+			ReportingController: e.ReportingController,
+			ReportingInstance:   e.ReportingInstance,
+			InvolvedObject:      newObjectReference(e.InvolvedObject),
+		},
+	}
+	if e.InvolvedObject.Kind == "Pod" {
+		r.Kubernetes.PodName = e.InvolvedObject.Name
+	}
+	r.Summary = r.summary()
+
+	return r
+}
+
+func newObjectReference(o v1.ObjectReference) ObjectReference {
+	return ObjectReference{
+		Kind:       o.Kind,
+		Namespace:  o.Namespace,
+		Name:       o.Name,
+		UID:        string(o.UID),
+		APIVersion: o.APIVersion,
+		FieldPath:  o.FieldPath,
+	}
+}
+
+// summary is the one line form of the event.
+func (r Record) summary() string {
+	e := r.Event
+	s := ""
+	if e.Type != "" {
+		s += e.Type + " "
+	}
+	if e.Reason != "" {
+		s += e.Reason + " "
+	}
+
+	o := e.InvolvedObject
+	if o.Kind != "" {
+		s += o.Kind + "/"
+	}
+	s += o.Name
+	if o.FieldPath != "" {
+		s += "[" + o.FieldPath + "]"
+	}
+	if e.Count > 1 {
+		s += fmt.Sprintf(" (x%d)", e.Count)
+	}
+
+	return s + ": " + e.Message
+}
+
+// Tag is the fluent tag of the record. Like container logs, it holds the
+// namespace so namespaced sinks receive the events of their namespace.
+func (r Record) Tag() string {
+	return fmt.Sprintf("k8s.event._%s_", r.Kubernetes.NamespaceName)
+}
+
+// Fluent returns the record as sent with the fluent forward protocol.
+// Strings are sent as bytes, the way fluent-bit receives container logs.
+func (r Record) Fluent() map[string]interface{} {
+	k := r.Kubernetes
+	kubernetes := map[string]interface{}{
+		"host":           []byte(k.Host),
+		"namespace_name": []byte(k.NamespaceName),
+		"source_type":    []byte(k.SourceType),
+	}
+	setBytes(kubernetes, "pod_name", k.PodName)
+
+	e := r.Event
+	event := map[string]interface{}{
+		"name":            []byte(e.Name),
+		"namespace":       []byte(e.Namespace),
+		"count":           e.Count,
+		"involved_object": e.InvolvedObject.fluent(),
+	}
+	setBytes(event, "uid", e.UID)
+	setBytes(event, "resource_version", e.ResourceVersion)
+	setBytes(event, "type", e.Type)
+	setBytes(event, "reason", e.Reason)
+	setBytes(event, "action", e.Action)
+	setBytes(event, "message", e.Message)
+	setBytes(event, "first_timestamp", e.FirstTimestamp)
+	setBytes(event, "last_timestamp", e.LastTimestamp)
+	setBytes(event, "event_time", e.EventTime)
+	setBytes(event, "source_component", e.SourceComponent)
+	setBytes(event, "reporting_controller", e.ReportingController)
+	setBytes(event, "reporting_instance", e.ReportingInstance)
+	if e.Related != nil {
+		event["related"] = e.Related.fluent()
+	}
+	if e.Series != nil {
+		series := map[string]interface{}{
+			"count": e.Series.Count,
+		}
+		setBytes(series, "last_observed_time", e.Series.LastObservedTime)
+		setBytes(series, "state", e.Series.State)
+		event["series"] = series
+	}
+
+	m := map[string]interface{}{
+		"log":        []byte(r.Log),
+		"summary":    []byte(r.Summary),
+		"stream":     []byte(r.Stream),
+		"kubernetes": kubernetes,
+		"event":      event,
+	}
+	if r.Aggregated != 0 {
+		m["aggregated"] = r.Aggregated
+	}
+	if len(r.Suppressed) != 0 {
+		suppressed := make(map[string]interface{}, len(r.Suppressed))
+		for reason, n := range r.Suppressed {
+			suppressed[reason] = n
+		}
+		m["suppressed"] = suppressed
+	}
+
+	return m
+}
+
+func (o ObjectReference) fluent() map[string]interface{} {
+	m := map[string]interface{}{}
+	setBytes(m, "kind", o.Kind)
+	setBytes(m, "namespace", o.Namespace)
+	setBytes(m, "name", o.Name)
+	setBytes(m, "uid", o.UID)
+	setBytes(m, "api_version", o.APIVersion)
+	setBytes(m, "field_path", o.FieldPath)
+	return m
+}
+
+func setBytes(m map[string]interface{}, k, v string) {
+	if v != "" {
+		m[k] = []byte(v)
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
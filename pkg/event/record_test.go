@@ -0,0 +1,74 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package event_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"k8s.io/api/core/v1"
+
+	"github.com/knative/observability/pkg/event"
+)
+
+func TestRecordOfNonPodObject(t *testing.T) {
+	r := event.NewRecord(&v1.Event{
+		InvolvedObject: v1.ObjectReference{
+			Kind:      "Deployment",
+			Name:      "some-deployment",
+			Namespace: "some-namespace",
+		},
+		Reason:  "ScalingReplicaSet",
+		Type:    "Normal",
+		Message: "Scaled up replica set some-deployment-7d4b9 to 1",
+		Count:   1,
+	})
+
+	if r.Kubernetes.PodName != "" {
+		t.Errorf("Expected no pod name for a Deployment, was %s", r.Kubernetes.PodName)
+	}
+	if _, ok := r.Fluent()["kubernetes"].(map[string]interface{})["pod_name"]; ok {
+		t.Errorf("Expected the fluent record to have no pod_name")
+	}
+
+	expectedLog := "Scaled up replica set some-deployment-7d4b9 to 1"
+	if r.Log != expectedLog {
+		t.Errorf("Expected log to be %q, was %q", expectedLog, r.Log)
+	}
+	expectedSummary := "Normal ScalingReplicaSet Deployment/some-deployment: Scaled up replica set some-deployment-7d4b9 to 1"
+	if r.Summary != expectedSummary {
+		t.Errorf("Expected summary to be %q, was %q", expectedSummary, r.Summary)
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var structured struct {
+		Event struct {
+			Reason         string `json:"reason"`
+			InvolvedObject struct {
+				Kind string `json:"kind"`
+			} `json:"involved_object"`
+		} `json:"event"`
+	}
+	if err := json.Unmarshal(b, &structured); err != nil {
+		t.Fatal(err)
+	}
+	if structured.Event.Reason != "ScalingReplicaSet" || structured.Event.InvolvedObject.Kind != "Deployment" {
+		t.Errorf("Expected structured reason and kind, got %s", b)
+	}
+}
@@ -0,0 +1,239 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package event
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/api/core/v1"
+)
+
+// SuppressedReason is the reason of summary records of events dropped by
+// rate limits.
+const SuppressedReason = "EventsSuppressed"
+
+// StormConfig configures a StormGuard. Rates are in events per second and
+// a zero rate or window disables that protection.
+type StormConfig struct {
+	// NamespaceRate and NamespaceBurst limit the events of each namespace.
+	NamespaceRate  float64
+	NamespaceBurst int
+	// ObjectRate and ObjectBurst limit the events of each involved object.
+	ObjectRate  float64
+	ObjectBurst int
+	// Window collapses the occurrences of the same reason for the same
+	// involved object into one record. The first occurrence is forwarded
+	// and the rest are counted until the window ends.
+	Window time.Duration
+}
+
+// StormAction is what a StormGuard decided for an event.
+type StormAction int
+
+const (
+	// StormForward forwards the event.
+	StormForward StormAction = iota
+	// StormAggregate collapses the event into the record of its window.
+	StormAggregate
+	// StormSuppress drops the event because of a rate limit. It is
+	// counted in the summary record of its namespace.
+	StormSuppress
+)
+
+// StormGuard protects forwarders from event storms, such as a crash
+// looping pod in every namespace. Unlike a full send buffer, which drops
+// events at random, it keeps forwarding the events of quiet namespaces and
+// objects, and notes what it dropped.
+//
+// Events collapsed by a window and summaries of suppressed events are
+// returned by Flush.
+type StormGuard struct {
+	cfg StormConfig
+
+	mu         sync.Mutex
+	namespaces map[string]*limiter
+	objects    map[string]*limiter
+	windows    map[string]*window
+	suppressed map[string]map[string]int32
+}
+
+type limiter struct {
+	*rate.Limiter
+	idle     time.Duration
+	lastSeen time.Time
+}
+
+type window struct {
+	start time.Time
+	count int32
+	last  Record
+}
+
+func NewStormGuard(cfg StormConfig) *StormGuard {
+	return &StormGuard{
+		cfg:        cfg,
+		namespaces: make(map[string]*limiter),
+		objects:    make(map[string]*limiter),
+		windows:    make(map[string]*window),
+		suppressed: make(map[string]map[string]int32),
+	}
+}
+
+// Admit decides what to do with the record of an event received at now.
+func (g *StormGuard) Admit(r Record, now time.Time) StormAction {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ns := r.Kubernetes.NamespaceName
+	o := r.Event.InvolvedObject
+	object := ns + "/" + o.Kind + "/" + o.Name
+
+	key := object + "/" + r.Event.Reason
+	if w, ok := g.windows[key]; ok && now.Sub(w.start) < g.cfg.Window {
+		w.count++
+		w.last = r
+		return StormAggregate
+	}
+
+	// Objects are limited first, so a noisy object does not use up the rate
+	// of its namespace.
+	if !g.allow(g.objects, object, g.cfg.ObjectRate, g.cfg.ObjectBurst, now) ||
+		!g.allow(g.namespaces, ns, g.cfg.NamespaceRate, g.cfg.NamespaceBurst, now) {
+		reasons, ok := g.suppressed[ns]
+		if !ok {
+			reasons = make(map[string]int32)
+			g.suppressed[ns] = reasons
+		}
+		reasons[r.Event.Reason]++
+		return StormSuppress
+	}
+
+	if g.cfg.Window > 0 {
+		g.windows[key] = &window{start: now}
+	}
+	return StormForward
+}
+
+// allow takes a token from the limiter of key.
+func (g *StormGuard) allow(limiters map[string]*limiter, key string, r float64, burst int, now time.Time) bool {
+	if r <= 0 {
+		return true
+	}
+
+	l, ok := limiters[key]
+	if !ok {
+		if burst < 1 {
+			burst = 1
+		}
+		l = &limiter{
+			Limiter: rate.NewLimiter(rate.Limit(r), burst),
+			idle:    time.Duration(float64(burst) / r * float64(time.Second)),
+		}
+		limiters[key] = l
+	}
+	l.lastSeen = now
+
+	return l.AllowN(now, 1)
+}
+
+// Flush returns a record for each window that ended by now with collapsed
+// events, and a summary record for each namespace with suppressed events.
+// It should be called periodically, at most every Window.
+func (g *StormGuard) Flush(now time.Time) []Record {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var records []Record
+	for key, w := range g.windows {
+		if now.Sub(w.start) < g.cfg.Window {
+			continue
+		}
+		delete(g.windows, key)
+		if w.count == 0 {
+			continue
+		}
+
+		r := w.last
+		r.Aggregated = w.count
+		r.Summary += fmt.Sprintf(" (aggregated %d in %s)", w.count, g.cfg.Window)
+		records = append(records, r)
+	}
+
+	for ns, reasons := range g.suppressed {
+		records = append(records, suppressedRecord(ns, reasons, now))
+	}
+	g.suppressed = make(map[string]map[string]int32)
+
+	// A limiter that has been idle long enough to refill is the same as a
+	// new one.
+	for _, limiters := range []map[string]*limiter{g.namespaces, g.objects} {
+		for key, l := range limiters {
+			if now.Sub(l.lastSeen) >= l.idle {
+				delete(limiters, key)
+			}
+		}
+	}
+
+	return records
+}
+
+// suppressedRecord summarizes the events suppressed in a namespace. It is
+// a warning about the namespace, reported by the event controller.
+func suppressedRecord(ns string, reasons map[string]int32, now time.Time) Record {
+	var total int32
+	counts := make([]string, 0, len(reasons))
+	for reason, n := range reasons {
+		total += n
+		if reason == "" {
+			reason = "<none>"
+		}
+		counts = append(counts, fmt.Sprintf("%s=%d", reason, n))
+	}
+	sort.Strings(counts)
+
+	r := Record{
+		Stream: "stdout",
+		Kubernetes: KubernetesRecord{
+			NamespaceName: ns,
+			SourceType:    "k8s.event",
+		},
+		Event: EventRecord{
+			Name:                fmt.Sprintf("%s.%x", ns, now.UnixNano()),
+			Namespace:           ns,
+			Type:                v1.EventTypeWarning,
+			Reason:              SuppressedReason,
+			Message:             fmt.Sprintf("Suppressed %d events by rate limits: %s", total, strings.Join(counts, ", ")),
+			Count:               total,
+			LastTimestamp:       formatTime(now),
+			ReportingController: "event-controller",
+			InvolvedObject: ObjectReference{
+				Kind:       "Namespace",
+				Name:       ns,
+				APIVersion: "v1",
+			},
+		},
+		Suppressed: reasons,
+	}
+	r.Log = r.Event.Message
+	r.Summary = r.summary()
+
+	return r
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package event_test
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+
+	"github.com/knative/observability/pkg/event"
+)
+
+var stormStart = time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestStormGuardAggregates(t *testing.T) {
+	g := event.NewStormGuard(event.StormConfig{Window: time.Minute})
+	r := stormRecord("some-namespace", "some-pod", "BackOff")
+
+	if a := g.Admit(r, stormStart); a != event.StormForward {
+		t.Fatalf("Expected the first occurrence to be forwarded, got %d", a)
+	}
+	for i := 1; i <= 3; i++ {
+		if a := g.Admit(r, stormStart.Add(time.Duration(i)*time.Second)); a != event.StormAggregate {
+			t.Fatalf("Expected occurrence %d to be aggregated, got %d", i, a)
+		}
+	}
+	if a := g.Admit(stormRecord("some-namespace", "some-pod", "Failed"), stormStart); a != event.StormForward {
+		t.Errorf("Expected other reasons to be forwarded, got %d", a)
+	}
+
+	if records := g.Flush(stormStart.Add(30 * time.Second)); len(records) != 0 {
+		t.Errorf("Expected no records before the window ends, got %d", len(records))
+	}
+
+	records := g.Flush(stormStart.Add(time.Minute))
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 aggregated record, got %d", len(records))
+	}
+	if records[0].Aggregated != 3 {
+		t.Errorf("Expected 3 aggregated events, got %d", records[0].Aggregated)
+	}
+	if records[0].Log != "some message" {
+		t.Errorf("Expected the message as log, got %q", records[0].Log)
+	}
+	expectedSummary := "Warning BackOff Pod/some-pod: some message (aggregated 3 in 1m0s)"
+	if records[0].Summary != expectedSummary {
+		t.Errorf("Expected summary %q, got %q", expectedSummary, records[0].Summary)
+	}
+	if records[0].Fluent()["aggregated"] != int32(3) {
+		t.Errorf("Expected the fluent record to be aggregated, got %v", records[0].Fluent()["aggregated"])
+	}
+
+	if a := g.Admit(r, stormStart.Add(time.Minute)); a != event.StormForward {
+		t.Errorf("Expected occurrences after the window to be forwarded, got %d", a)
+	}
+}
+
+func TestStormGuardRateLimits(t *testing.T) {
+	g := event.NewStormGuard(event.StormConfig{
+		NamespaceRate:  1,
+		NamespaceBurst: 3,
+		ObjectRate:     1,
+		ObjectBurst:    2,
+	})
+
+	var actions []event.StormAction
+	for i := 0; i < 3; i++ {
+		actions = append(actions, g.Admit(stormRecord("some-namespace", "noisy-pod", "BackOff"), stormStart))
+	}
+	expected := []event.StormAction{event.StormForward, event.StormForward, event.StormSuppress}
+	for i := range expected {
+		if actions[i] != expected[i] {
+			t.Errorf("Expected action %d to be %d, got %d", i, expected[i], actions[i])
+		}
+	}
+
+	if a := g.Admit(stormRecord("some-namespace", "quiet-pod", "Killing"), stormStart); a != event.StormForward {
+		t.Errorf("Expected a suppressed object not to use up the namespace rate, got %d", a)
+	}
+	if a := g.Admit(stormRecord("some-namespace", "other-pod", "Killing"), stormStart); a != event.StormSuppress {
+		t.Errorf("Expected the namespace to be limited, got %d", a)
+	}
+	if a := g.Admit(stormRecord("other-namespace", "other-pod", "Killing"), stormStart); a != event.StormForward {
+		t.Errorf("Expected other namespaces to be forwarded, got %d", a)
+	}
+	if a := g.Admit(stormRecord("some-namespace", "noisy-pod", "BackOff"), stormStart.Add(time.Second)); a != event.StormForward {
+		t.Errorf("Expected the limits to refill, got %d", a)
+	}
+
+	records := g.Flush(stormStart.Add(time.Second))
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 summary record, got %d", len(records))
+	}
+	r := records[0]
+	if r.Event.Reason != event.SuppressedReason || r.Event.Type != "Warning" || r.Event.Count != 2 {
+		t.Errorf("Expected a warning about 2 suppressed events, got %+v", r.Event)
+	}
+	if r.Tag() != "k8s.event._some-namespace_" {
+		t.Errorf("Expected the summary in the namespace, got tag %s", r.Tag())
+	}
+	if r.Suppressed["BackOff"] != 1 || r.Suppressed["Killing"] != 1 {
+		t.Errorf("Expected suppressed events by reason, got %v", r.Suppressed)
+	}
+	expectedLog := "Suppressed 2 events by rate limits: BackOff=1, Killing=1"
+	if r.Log != expectedLog {
+		t.Errorf("Expected log %q, got %q", expectedLog, r.Log)
+	}
+	expectedSummary := "Warning EventsSuppressed Namespace/some-namespace (x2): " + expectedLog
+	if r.Summary != expectedSummary {
+		t.Errorf("Expected summary %q, got %q", expectedSummary, r.Summary)
+	}
+
+	if records := g.Flush(stormStart.Add(2 * time.Second)); len(records) != 0 {
+		t.Errorf("Expected suppressed events to be reported once, got %d records", len(records))
+	}
+}
+
+func TestControllerStormGuard(t *testing.T) {
+	ResetForwarderMetrics()
+	g := event.NewStormGuard(event.StormConfig{
+		ObjectRate:  0.001,
+		ObjectBurst: 1,
+	})
+	cp := event.NewCheckpoint(&spyConfigMapClient{}, "event-controller-checkpoint")
+	spyFl := &spyFlogger{t: t}
+	c := event.NewController(spyFl, event.WithStormGuard(g), event.WithCheckpoint(cp))
+
+	c.OnAdd(checkpointEvent("some-uid", "1"))
+	if !spyFl.called {
+		t.Fatalf("Expected the first event to be forwarded")
+	}
+	spyFl.called = false
+
+	c.OnAdd(checkpointEvent("other-uid", "1"))
+	if spyFl.called {
+		t.Errorf("Expected the event to be suppressed")
+	}
+	if event.ForwarderSuppressed.Value() != 1 {
+		t.Errorf("Expected events suppressed to be 1, was %d", event.ForwarderSuppressed.Value())
+	}
+	if !cp.Forwarded("other-uid", "1") {
+		t.Errorf("Expected suppressed events to be checkpointed")
+	}
+
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		c.Run(time.Millisecond, stopCh)
+		close(done)
+	}()
+	defer func() {
+		close(stopCh)
+		<-done
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for event.ForwarderSent.Value() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the summary record to be forwarded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func stormRecord(namespace, pod, reason string) event.Record {
+	return event.NewRecord(&v1.Event{
+		InvolvedObject: v1.ObjectReference{
+			Kind:      "Pod",
+			Name:      pod,
+			Namespace: namespace,
+		},
+		Type:    "Warning",
+		Reason:  reason,
+		Message: "some message",
+		Count:   1,
+	})
+}
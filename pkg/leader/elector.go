@@ -0,0 +1,393 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package leader
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	coordinationv1beta1 "k8s.io/api/coordination/v1beta1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ErrLeadershipLost is returned by Run when the lease could not be renewed
+// in time. The process should exit, so it restarts as a candidate with
+// fresh informers.
+var ErrLeadershipLost = errors.New("leadership lost")
+
+// ErrLeasesUnavailable is returned by Run when the lease can not be created
+// because the coordination.k8s.io/v1 API or the namespace does not exist.
+// Retrying does not help.
+var ErrLeasesUnavailable = errors.New("unable to create lease: the coordination.k8s.io/v1 API or the namespace does not exist")
+
+// LeaseClient reads and writes the Lease of an election. It is satisfied
+// by the typed Lease client of a namespace.
+type LeaseClient interface {
+	Get(name string, options metav1.GetOptions) (*coordinationv1beta1.Lease, error)
+	Create(*coordinationv1beta1.Lease) (*coordinationv1beta1.Lease, error)
+	Update(*coordinationv1beta1.Lease) (*coordinationv1beta1.Lease, error)
+}
+
+type ElectorOpt func(*Elector)
+
+// Elector elects one leader among the replicas of a controller with a
+// coordination.k8s.io Lease. The leader renews the lease every retry
+// period. Other candidates take it over once it has not been renewed for
+// the lease duration, measured on their own clock so clock skew between
+// nodes does not matter.
+//
+// A nil Elector leads without an election.
+type Elector struct {
+	client   LeaseClient
+	name     string
+	identity string
+
+	leaseDuration time.Duration
+	renewDeadline time.Duration
+	retryPeriod   time.Duration
+
+	mu           sync.Mutex
+	leading      bool
+	holder       string
+	observed     coordinationv1beta1.LeaseSpec
+	observedTime time.Time
+}
+
+func NewElector(client LeaseClient, name, identity string, opts ...ElectorOpt) *Elector {
+	e := &Elector{
+		client:        client,
+		name:          name,
+		identity:      identity,
+		leaseDuration: 15 * time.Second,
+		renewDeadline: 10 * time.Second,
+		retryPeriod:   2 * time.Second,
+	}
+
+	for _, o := range opts {
+		o(e)
+	}
+
+	return e
+}
+
+// WithLeaseDuration sets how long candidates wait for the leader to renew
+// the lease before taking it over, and how long the leader keeps trying to
+// renew it before stepping down. The renew deadline must be shorter than
+// the lease duration.
+func WithLeaseDuration(leaseDuration, renewDeadline time.Duration) ElectorOpt {
+	return func(e *Elector) {
+		e.leaseDuration = leaseDuration
+		e.renewDeadline = renewDeadline
+	}
+}
+
+// WithRetryPeriod sets how often the lease is acquired or renewed.
+func WithRetryPeriod(d time.Duration) ElectorOpt {
+	return func(e *Elector) {
+		e.retryPeriod = d
+	}
+}
+
+// Leading reports whether the elector holds the lease.
+func (e *Elector) Leading() bool {
+	if e == nil {
+		return true
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leading
+}
+
+// Leader returns the identity of the candidate last seen holding the lease,
+// or an empty string if it is not known.
+func (e *Elector) Leader() string {
+	if e == nil {
+		return ""
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.leading {
+		return e.identity
+	}
+	return e.holder
+}
+
+// ServeHTTP is a readiness check that only succeeds on the leader.
+func (e *Elector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !e.Leading() {
+		http.Error(w, "not the leader", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+// Wrap serves h on the leader only, since other candidates do not sync
+// any state. They respond with 503 Service Unavailable naming the leader.
+func (e *Elector) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !e.Leading() {
+			msg := "not the leader"
+			if l := e.Leader(); l != "" {
+				msg = fmt.Sprintf("not the leader, the leader is %s", l)
+			}
+			http.Error(w, msg, http.StatusServiceUnavailable)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Run waits until the lease is acquired and then runs f until stopCh is
+// closed or the lease is lost. It returns ErrLeasesUnavailable without
+// running f if the lease can not be created. The stop channel given to f is closed in
+// both cases and Run returns once f has returned. The lease is released
+// when stopCh is closed, so another replica takes over without waiting
+// for it to expire.
+func (e *Elector) Run(stopCh <-chan struct{}, f func(stopCh <-chan struct{})) error {
+	if e == nil {
+		f(stopCh)
+		return nil
+	}
+
+	ok, err := e.acquire(stopCh)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	log.Printf("acquired lease %s as %s\n", e.name, e.identity)
+
+	leaderStopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f(leaderStopCh)
+	}()
+
+	err = e.renew(stopCh, done)
+	close(leaderStopCh)
+	<-done
+
+	if err == nil {
+		e.release()
+	}
+	return err
+}
+
+// acquire tries to acquire the lease every retry period. It returns false
+// if stopCh is closed first, and ErrLeasesUnavailable without retrying.
+func (e *Elector) acquire(stopCh <-chan struct{}) (bool, error) {
+	ticker := time.NewTicker(e.retryPeriod)
+	defer ticker.Stop()
+
+	for {
+		ok, err := e.TryAcquireOrRenew()
+		if err == ErrLeasesUnavailable {
+			return false, err
+		}
+		if err != nil {
+			log.Printf("unable to acquire lease %s: %s\n", e.name, err)
+		}
+		if ok {
+			return true, nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return false, nil
+		}
+	}
+}
+
+// renew renews the lease every retry period until stopCh is closed or done
+// is closed. It returns ErrLeadershipLost if the lease was not renewed
+// within the renew deadline.
+func (e *Elector) renew(stopCh, done <-chan struct{}) error {
+	ticker := time.NewTicker(e.retryPeriod)
+	defer ticker.Stop()
+
+	renewed := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return nil
+		case <-done:
+			return nil
+		}
+
+		ok, err := e.TryAcquireOrRenew()
+		if ok {
+			renewed = time.Now()
+			continue
+		}
+		if err != nil {
+			log.Printf("unable to renew lease %s: %s\n", e.name, err)
+		}
+		// Without an error, another candidate holds the lease.
+		if err == nil || time.Since(renewed) > e.renewDeadline {
+			e.setLeading(false)
+			log.Printf("lost lease %s\n", e.name)
+			return ErrLeadershipLost
+		}
+	}
+}
+
+// TryAcquireOrRenew acquires the lease if it is free or expired, or renews
+// it if it is held by this elector. It reports whether the elector holds
+// the lease. Errors leave Leading unchanged, so the leader stays ready
+// while it retries. If the lease is missing and creating it is not found
+// either, it returns ErrLeasesUnavailable.
+func (e *Elector) TryAcquireOrRenew() (bool, error) {
+	now := time.Now()
+	lease, err := e.client.Get(e.name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		lease = &coordinationv1beta1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: e.name},
+		}
+		e.hold(lease, now)
+		if _, err := e.client.Create(lease); err != nil {
+			if k8serrors.IsAlreadyExists(err) {
+				// Another candidate created the lease first.
+				e.setLeading(false)
+				return false, nil
+			}
+			if k8serrors.IsNotFound(err) {
+				log.Printf("unable to create lease %s: %s\n", e.name, err)
+				return false, ErrLeasesUnavailable
+			}
+			return false, err
+		}
+		e.setLeading(true)
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	holder := stringValue(lease.Spec.HolderIdentity)
+	e.setHolder(holder)
+	if holder != "" && holder != e.identity && !e.expired(lease.Spec, now) {
+		e.setLeading(false)
+		return false, nil
+	}
+
+	e.hold(lease, now)
+	if _, err := e.client.Update(lease); err != nil {
+		if k8serrors.IsConflict(err) {
+			// Another candidate updated the lease first.
+			e.setLeading(false)
+			return false, nil
+		}
+		return false, err
+	}
+	e.setLeading(true)
+	return true, nil
+}
+
+// expired reports whether the lease held by another candidate has not
+// been renewed for its duration since it was last seen to change.
+func (e *Elector) expired(spec coordinationv1beta1.LeaseSpec, now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if stringValue(spec.HolderIdentity) != stringValue(e.observed.HolderIdentity) ||
+		!microTimeValue(spec.RenewTime).Equal(microTimeValue(e.observed.RenewTime)) {
+		e.observed = *spec.DeepCopy()
+		e.observedTime = now
+	}
+
+	duration := e.leaseDuration
+	if spec.LeaseDurationSeconds != nil {
+		duration = time.Duration(*spec.LeaseDurationSeconds) * time.Second
+	}
+	return now.Sub(e.observedTime) > duration
+}
+
+// hold sets this elector as the holder of the lease.
+func (e *Elector) hold(lease *coordinationv1beta1.Lease, now time.Time) {
+	spec := &lease.Spec
+	renewTime := metav1.NewMicroTime(now)
+	if stringValue(spec.HolderIdentity) != e.identity {
+		var transitions int32
+		if spec.LeaseTransitions != nil {
+			transitions = *spec.LeaseTransitions
+		}
+		if spec.AcquireTime != nil {
+			transitions++
+		}
+		spec.LeaseTransitions = &transitions
+		spec.AcquireTime = &renewTime
+	}
+
+	identity := e.identity
+	seconds := int32((e.leaseDuration + time.Second - 1) / time.Second)
+	spec.HolderIdentity = &identity
+	spec.LeaseDurationSeconds = &seconds
+	spec.RenewTime = &renewTime
+}
+
+// release gives up the lease so other candidates acquire it immediately.
+func (e *Elector) release() {
+	e.setLeading(false)
+
+	lease, err := e.client.Get(e.name, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("unable to release lease %s: %s\n", e.name, err)
+		return
+	}
+	if stringValue(lease.Spec.HolderIdentity) != e.identity {
+		return
+	}
+
+	lease.Spec.HolderIdentity = nil
+	if _, err := e.client.Update(lease); err != nil {
+		log.Printf("unable to release lease %s: %s\n", e.name, err)
+	}
+}
+
+func (e *Elector) setLeading(leading bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leading = leading
+}
+
+func (e *Elector) setHolder(holder string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.holder = holder
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func microTimeValue(t *metav1.MicroTime) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return t.Time
+}
@@ -0,0 +1,260 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package leader_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	coordinationv1beta1 "k8s.io/api/coordination/v1beta1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/knative/observability/pkg/leader"
+)
+
+func TestElectorAcquiresOnce(t *testing.T) {
+	leases := &spyLeaseClient{}
+	a := leader.NewElector(leases, "some-controller", "replica-a")
+	b := leader.NewElector(leases, "some-controller", "replica-b")
+
+	if ok, err := a.TryAcquireOrRenew(); !ok || err != nil {
+		t.Fatalf("Expected the first replica to acquire the lease, got %t, %v", ok, err)
+	}
+	if ok, err := b.TryAcquireOrRenew(); ok || err != nil {
+		t.Fatalf("Expected the second replica not to acquire the lease, got %t, %v", ok, err)
+	}
+	if ok, err := a.TryAcquireOrRenew(); !ok || err != nil {
+		t.Fatalf("Expected the leader to renew the lease, got %t, %v", ok, err)
+	}
+
+	if code := ready(a); code != http.StatusOK {
+		t.Errorf("Expected the leader to be ready, got %d", code)
+	}
+	if code := ready(b); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the candidate not to be ready, got %d", code)
+	}
+
+	lease := leases.lease()
+	if *lease.Spec.HolderIdentity != "replica-a" || *lease.Spec.LeaseDurationSeconds != 15 {
+		t.Errorf("Unexpected lease %+v", lease.Spec)
+	}
+}
+
+func TestElectorTakesOverExpiredLeases(t *testing.T) {
+	leases := &spyLeaseClient{}
+	a := leader.NewElector(leases, "some-controller", "replica-a", leader.WithLeaseDuration(time.Second, 500*time.Millisecond))
+	b := leader.NewElector(leases, "some-controller", "replica-b", leader.WithLeaseDuration(time.Second, 500*time.Millisecond))
+
+	a.TryAcquireOrRenew()
+	if ok, _ := b.TryAcquireOrRenew(); ok {
+		t.Fatalf("Expected the lease to be held")
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	if ok, err := b.TryAcquireOrRenew(); !ok || err != nil {
+		t.Fatalf("Expected the expired lease to be taken over, got %t, %v", ok, err)
+	}
+	if *leases.lease().Spec.LeaseTransitions != 1 {
+		t.Errorf("Expected 1 lease transition, got %d", *leases.lease().Spec.LeaseTransitions)
+	}
+
+	if ok, _ := a.TryAcquireOrRenew(); ok {
+		t.Errorf("Expected the old leader not to renew the lease")
+	}
+	if a.Leading() {
+		t.Errorf("Expected the old leader to step down")
+	}
+}
+
+func TestElectorRun(t *testing.T) {
+	leases := &spyLeaseClient{}
+	a := leader.NewElector(leases, "some-controller", "replica-a", leader.WithRetryPeriod(10*time.Millisecond))
+
+	stopCh := make(chan struct{})
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		errs <- a.Run(stopCh, func(stopCh <-chan struct{}) {
+			close(started)
+			<-stopCh
+			close(stopped)
+		})
+	}()
+
+	<-started
+	if !a.Leading() {
+		t.Errorf("Expected the leader to be leading while running")
+	}
+
+	close(stopCh)
+	if err := <-errs; err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Errorf("Expected the leader to be stopped")
+	}
+
+	if leases.lease().Spec.HolderIdentity != nil {
+		t.Errorf("Expected the lease to be released")
+	}
+	b := leader.NewElector(leases, "some-controller", "replica-b")
+	if ok, _ := b.TryAcquireOrRenew(); !ok {
+		t.Errorf("Expected a released lease to be acquired immediately")
+	}
+}
+
+func TestElectorRunLosesLeadership(t *testing.T) {
+	leases := &spyLeaseClient{}
+	a := leader.NewElector(leases, "some-controller", "replica-a", leader.WithRetryPeriod(10*time.Millisecond))
+
+	errs := make(chan error, 1)
+	stopped := make(chan struct{})
+	go func() {
+		errs <- a.Run(make(chan struct{}), func(stopCh <-chan struct{}) {
+			lease := leases.lease()
+			other := "replica-b"
+			lease.Spec.HolderIdentity = &other
+			leases.Update(lease)
+
+			<-stopCh
+			close(stopped)
+		})
+	}()
+
+	if err := <-errs; err != leader.ErrLeadershipLost {
+		t.Errorf("Expected leadership to be lost, got %v", err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Errorf("Expected the old leader to be stopped")
+	}
+	if ready(a) != http.StatusServiceUnavailable {
+		t.Errorf("Expected the old leader not to be ready")
+	}
+}
+
+func TestNilElector(t *testing.T) {
+	var e *leader.Elector
+	called := false
+	if err := e.Run(make(chan struct{}), func(<-chan struct{}) { called = true }); err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Errorf("Expected a nil elector to run without an election")
+	}
+	if ready(e) != http.StatusOK {
+		t.Errorf("Expected a nil elector to be ready")
+	}
+}
+
+func TestElectorWrap(t *testing.T) {
+	leases := &spyLeaseClient{}
+	a := leader.NewElector(leases, "some-controller", "replica-a")
+	b := leader.NewElector(leases, "some-controller", "replica-b")
+	a.TryAcquireOrRenew()
+	b.TryAcquireOrRenew()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("config"))
+	})
+	serve := func(e *leader.Elector) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.Wrap(h).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+		return rec
+	}
+
+	if rec := serve(a); rec.Code != http.StatusOK || rec.Body.String() != "config" {
+		t.Errorf("Expected the leader to serve, got %d %q", rec.Code, rec.Body.String())
+	}
+	rec := serve(b)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected a candidate not to serve, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "the leader is replica-a") {
+		t.Errorf("Expected a candidate to name the leader, got %q", rec.Body.String())
+	}
+
+	var nilElector *leader.Elector
+	if rec := serve(nilElector); rec.Code != http.StatusOK {
+		t.Errorf("Expected a nil elector to serve, got %d", rec.Code)
+	}
+}
+
+func ready(e *leader.Elector) int {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	return rec.Code
+}
+
+var leasesResource = schema.GroupResource{Group: "coordination.k8s.io", Resource: "leases"}
+
+type spyLeaseClient struct {
+	mu      sync.Mutex
+	current *coordinationv1beta1.Lease
+	version int
+}
+
+func (s *spyLeaseClient) lease() *coordinationv1beta1.Lease {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current.DeepCopy()
+}
+
+func (s *spyLeaseClient) Get(name string, _ metav1.GetOptions) (*coordinationv1beta1.Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current == nil {
+		return nil, k8serrors.NewNotFound(leasesResource, name)
+	}
+	return s.current.DeepCopy(), nil
+}
+
+func (s *spyLeaseClient) Create(lease *coordinationv1beta1.Lease) (*coordinationv1beta1.Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current != nil {
+		return nil, k8serrors.NewAlreadyExists(leasesResource, lease.Name)
+	}
+	s.store(lease)
+	return s.current.DeepCopy(), nil
+}
+
+func (s *spyLeaseClient) Update(lease *coordinationv1beta1.Lease) (*coordinationv1beta1.Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if lease.ResourceVersion != s.current.ResourceVersion {
+		return nil, k8serrors.NewConflict(leasesResource, lease.Name, nil)
+	}
+	s.store(lease)
+	return s.current.DeepCopy(), nil
+}
+
+func (s *spyLeaseClient) store(lease *coordinationv1beta1.Lease) {
+	s.version++
+	s.current = lease.DeepCopy()
+	s.current.ResourceVersion = strconv.Itoa(s.version)
+}
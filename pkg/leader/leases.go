@@ -0,0 +1,97 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package leader
+
+import (
+	coordinationv1beta1 "k8s.io/api/coordination/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/rest"
+)
+
+// CoordinationV1 is the coordination.k8s.io/v1 API. coordination.k8s.io/v1beta1
+// is not served since Kubernetes 1.22. Its Lease has the same schema, so
+// leases are decoded into the v1beta1 types.
+var CoordinationV1 = schema.GroupVersion{Group: "coordination.k8s.io", Version: "v1"}
+
+type leaseClient struct {
+	client    rest.Interface
+	params    runtime.ParameterCodec
+	namespace string
+}
+
+// NewLeaseClient returns a LeaseClient for the coordination.k8s.io/v1
+// Leases of a namespace.
+func NewLeaseClient(cfg *rest.Config, namespace string) (LeaseClient, error) {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypes(CoordinationV1, &coordinationv1beta1.Lease{}, &coordinationv1beta1.LeaseList{})
+	metav1.AddToGroupVersion(scheme, CoordinationV1)
+
+	c := rest.CopyConfig(cfg)
+	c.GroupVersion = &CoordinationV1
+	c.APIPath = "/apis"
+	c.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: serializer.NewCodecFactory(scheme)}
+	if c.UserAgent == "" {
+		c.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+
+	client, err := rest.RESTClientFor(c)
+	if err != nil {
+		return nil, err
+	}
+	return &leaseClient{
+		client:    client,
+		params:    runtime.NewParameterCodec(scheme),
+		namespace: namespace,
+	}, nil
+}
+
+func (c *leaseClient) Get(name string, options metav1.GetOptions) (*coordinationv1beta1.Lease, error) {
+	result := &coordinationv1beta1.Lease{}
+	err := c.client.Get().
+		Namespace(c.namespace).
+		Resource("leases").
+		Name(name).
+		VersionedParams(&options, c.params).
+		Do().
+		Into(result)
+	return result, err
+}
+
+func (c *leaseClient) Create(lease *coordinationv1beta1.Lease) (*coordinationv1beta1.Lease, error) {
+	result := &coordinationv1beta1.Lease{}
+	err := c.client.Post().
+		Namespace(c.namespace).
+		Resource("leases").
+		Body(lease).
+		Do().
+		Into(result)
+	return result, err
+}
+
+func (c *leaseClient) Update(lease *coordinationv1beta1.Lease) (*coordinationv1beta1.Lease, error) {
+	result := &coordinationv1beta1.Lease{}
+	err := c.client.Put().
+		Namespace(c.namespace).
+		Resource("leases").
+		Name(lease.Name).
+		Body(lease).
+		Do().
+		Into(result)
+	return result, err
+}
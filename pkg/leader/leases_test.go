@@ -0,0 +1,119 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package leader_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+
+	"github.com/knative/observability/pkg/leader"
+)
+
+func TestLeaseClientUsesCoordinationV1(t *testing.T) {
+	var mu sync.Mutex
+	var lease []byte
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.Method {
+		case http.MethodGet:
+			if lease == nil {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "NotFound", "code": 404}`))
+				return
+			}
+		case http.MethodPost, http.MethodPut:
+			body, _ := ioutil.ReadAll(r.Body)
+			var m map[string]interface{}
+			if err := json.Unmarshal(body, &m); err != nil {
+				t.Errorf("Unable to decode %s: %s", body, err)
+			}
+			if m["apiVersion"] != "coordination.k8s.io/v1" || m["kind"] != "Lease" {
+				t.Errorf("Expected a coordination.k8s.io/v1 Lease, got %s", body)
+			}
+			lease = body
+		}
+		w.Write(lease)
+	}))
+	defer server.Close()
+
+	client, err := leader.NewLeaseClient(&rest.Config{Host: server.URL}, "some-namespace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := leader.NewElector(client, "some-controller", "replica-a")
+	for i := 0; i < 2; i++ {
+		if ok, err := e.TryAcquireOrRenew(); !ok || err != nil {
+			t.Fatalf("Expected the lease to be acquired, got %t, %v", ok, err)
+		}
+	}
+
+	path := "/apis/coordination.k8s.io/v1/namespaces/some-namespace/leases"
+	expected := []string{
+		"GET " + path + "/some-controller",
+		"POST " + path,
+		"GET " + path + "/some-controller",
+		"PUT " + path + "/some-controller",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != len(expected) {
+		t.Fatalf("Expected requests %v, got %v", expected, requests)
+	}
+	for i := range expected {
+		if requests[i] != expected[i] {
+			t.Errorf("Expected request %d to be %s, got %s", i, expected[i], requests[i])
+		}
+	}
+}
+
+func TestElectorRunWithoutLeases(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	client, err := leader.NewLeaseClient(&rest.Config{Host: server.URL}, "some-namespace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := leader.NewElector(client, "some-controller", "replica-a", leader.WithRetryPeriod(10*time.Millisecond))
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- e.Run(make(chan struct{}), func(<-chan struct{}) {
+			t.Errorf("Expected not to run without a lease")
+		})
+	}()
+
+	select {
+	case err := <-errs:
+		if err != leader.ErrLeasesUnavailable {
+			t.Errorf("Expected leases to be unavailable, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Run not to retry creating the lease")
+	}
+}
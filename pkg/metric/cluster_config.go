@@ -44,6 +44,10 @@ func (t telegrafConfig) String() string {
 		return emptyConfig
 	}
 
+	return t.encode()
+}
+
+func (t telegrafConfig) encode() string {
 	buf := &bytes.Buffer{}
 	encoder := toml.NewEncoder(buf)
 	err := encoder.Encode(t)
@@ -60,6 +64,7 @@ type ClusterConfig struct {
 	defaultInputs map[string][]map[string]interface{}
 	clusterName   string
 	clusterSinks  map[string]v1alpha1.ClusterMetricSink
+	lastPatch     *PatchResult
 }
 
 type ModifierFunc func(*ClusterConfig)
@@ -76,33 +76,7 @@ func (c *ClusterController) OnAdd(o interface{}) {
 
 	c.sc.UpsertSink(*cmc)
 
-	patches := []patch{
-		{
-			Op:    "replace",
-			Path:  "/data/cluster-metric-sinks.conf",
-			Value: c.sc.String(),
-		},
-	}
-
-	data, err := json.Marshal(patches)
-	if err != nil {
-		log.Println(err.Error())
-	}
-
-	_, err = c.cmp.Patch(ConfigMapName, types.JSONPatchType, []byte(data))
-	if err != nil {
-		log.Println(err.Error())
-	}
-
-	err = c.dpd.DeleteCollection(
-		nil,
-		metav1.ListOptions{
-			LabelSelector: "app=telegraf",
-		},
-	)
-	if err != nil {
-		log.Println(err.Error())
-	}
+	c.sc.recordPatch(c.patchConfig())
 }
 
 func (c *ClusterController) OnDelete(o interface{}) {
@@ -113,6 +87,12 @@ func (c *ClusterController) OnDelete(o interface{}) {
 
 	c.sc.DeleteSink(*cmc)
 
+	c.sc.recordPatch(c.patchConfig())
+}
+
+// patchConfig returns the error from patching the ConfigMap, if any.
+// Errors restarting telegraf are only logged.
+func (c *ClusterController) patchConfig() error {
 	patches := []patch{
 		{
 			Op:    "replace",
@@ -126,9 +106,9 @@ func (c *ClusterController) OnDelete(o interface{}) {
 		log.Println(err.Error())
 	}
 
-	_, err = c.cmp.Patch(ConfigMapName, types.JSONPatchType, []byte(data))
-	if err != nil {
-		log.Println(err.Error())
+	_, patchErr := c.cmp.Patch(ConfigMapName, types.JSONPatchType, []byte(data))
+	if patchErr != nil {
+		log.Println(patchErr.Error())
 	}
 
 	err = c.dpd.DeleteCollection(
@@ -140,6 +120,8 @@ func (c *ClusterController) OnDelete(o interface{}) {
 	if err != nil {
 		log.Println(err.Error())
 	}
+
+	return patchErr
 }
 
 func (c *ClusterController) OnUpdate(old, new interface{}) {
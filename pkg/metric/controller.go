@@ -19,6 +19,8 @@ import (
 	"fmt"
 	"log"
 	"reflect"
+	"sort"
+	"sync"
 
 	"github.com/knative/observability/pkg/apis/sink/v1alpha1"
 	appsv1 "k8s.io/api/apps/v1"
@@ -53,6 +55,9 @@ type Controller struct {
 	extensionsClient V1beta1ExtensionsClient
 	rbacV1Client     RBACV1Client
 	clusterName      string
+
+	mu       sync.Mutex
+	sections map[string]Section
 }
 
 func NewController(clusterName string, c V1CoreClient, d V1beta1ExtensionsClient, r RBACV1Client) *Controller {
@@ -62,6 +67,7 @@ func NewController(clusterName string, c V1CoreClient, d V1beta1ExtensionsClient
 		coreClient:       c,
 		extensionsClient: d,
 		rbacV1Client:     r,
+		sections:         make(map[string]Section),
 	}
 }
 
@@ -72,6 +78,7 @@ func (c *Controller) OnAdd(o interface{}) {
 	}
 
 	setDefaultTypeMeta(ms)
+	c.recordSection(ms)
 
 	_, err := c.rbacV1Client.Roles(ms.Namespace).Create(getTelegrafRole(ms))
 	if err != nil {
@@ -111,6 +118,8 @@ func (c *Controller) OnUpdate(o, n interface{}) {
 		return
 	}
 
+	c.recordSection(nms)
+
 	// TODO: Should we do a patch instead?
 	_, err := c.coreClient.ConfigMaps(nms.Namespace).Update(c.getTelegrafConfigMap(nms))
 	if err != nil {
@@ -136,6 +145,8 @@ func (c *Controller) OnDelete(o interface{}) {
 		return
 	}
 
+	c.deleteSection(ms)
+
 	name := getAppName(ms)
 	err := c.coreClient.ConfigMaps(ms.Namespace).Delete(name, nil)
 	if err != nil {
@@ -162,6 +173,43 @@ func (c *Controller) OnDelete(o interface{}) {
 	}
 }
 
+// Sections returns the config rendered for each MetricSink in the given
+// namespace.
+func (c *Controller) Sections(namespace string) []Section {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sections := []Section{}
+	for _, s := range c.sections {
+		if s.Namespace == namespace {
+			sections = append(sections, s)
+		}
+	}
+	sort.Slice(sections, func(i, j int) bool {
+		return sections[i].Sources[0] < sections[j].Sources[0]
+	})
+
+	return sections
+}
+
+func (c *Controller) recordSection(ms *v1alpha1.MetricSink) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sections[ms.Namespace+"/"+ms.Name] = Section{
+		Namespace: ms.Namespace,
+		Sources:   []string{fmt.Sprintf("MetricSink %s/%s", ms.Namespace, ms.Name)},
+		Config:    c.metricSinkConfig(ms),
+	}
+}
+
+func (c *Controller) deleteSection(ms *v1alpha1.MetricSink) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.sections, ms.Namespace+"/"+ms.Name)
+}
+
 func (c *Controller) getTelegrafConfigMap(ms *v1alpha1.MetricSink) *v1.ConfigMap {
 	name := getAppName(ms)
 	return &v1.ConfigMap{
@@ -299,13 +347,18 @@ func getTelegrafRole(ms *v1alpha1.MetricSink) *rbacv1.Role {
 }
 
 func (c *Controller) metricSinkConfig(ms *v1alpha1.MetricSink) string {
+	return MetricSinkConfig(c.clusterName, ms)
+}
+
+// MetricSinkConfig renders the telegraf config deployed for a MetricSink.
+func MetricSinkConfig(clusterName string, ms *v1alpha1.MetricSink) string {
 	config := telegrafConfig{
 		Inputs:  make(map[string][]map[string]interface{}),
 		Outputs: make(map[string][]map[string]interface{}),
 	}
 
-	if c.clusterName != "" {
-		config.GlobalTags = map[string]string{"cluster_name": c.clusterName}
+	if clusterName != "" {
+		config.GlobalTags = map[string]string{"cluster_name": clusterName}
 	}
 
 	config.Inputs["prometheus"] = []map[string]interface{}{{"monitor_kubernetes_pods": true, "monitor_kubernetes_pods_namespace": ms.Namespace}}
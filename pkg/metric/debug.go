@@ -0,0 +1,141 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package metric
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Section is a piece of the rendered telegraf config along with the sinks
+// that contributed to it. Namespace is empty for sections that apply to the
+// whole cluster.
+type Section struct {
+	Namespace string   `json:"namespace,omitempty"`
+	Sources   []string `json:"sources"`
+	Config    string   `json:"config"`
+}
+
+// PatchResult is the outcome of the most recent ConfigMap patch.
+type PatchResult struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error,omitempty"`
+}
+
+// LastPatch returns the result of the most recent patch made from this
+// config, or nil if it has not been patched yet.
+func (c *ClusterConfig) LastPatch() *PatchResult {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.lastPatch == nil {
+		return nil
+	}
+	p := *c.lastPatch
+	return &p
+}
+
+func (c *ClusterConfig) recordPatch(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastPatch = &PatchResult{Time: time.Now()}
+	if err != nil {
+		c.lastPatch.Error = err.Error()
+	}
+}
+
+// Sections returns the default inputs and the inputs and outputs of each
+// ClusterMetricSink rendered separately.
+func (c *ClusterConfig) Sections() []Section {
+	var sections []Section
+	if len(c.defaultInputs) > 0 {
+		sections = append(sections, Section{
+			Sources: []string{"default"},
+			Config: telegrafConfig{
+				Inputs: copyInputs(c.defaultInputs),
+			}.encode(),
+		})
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	names := make([]string, 0, len(c.clusterSinks))
+	for name := range c.clusterSinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cms := c.clusterSinks[name]
+		tConfig := telegrafConfig{
+			Inputs:  make(map[string][]map[string]interface{}),
+			Outputs: make(map[string][]map[string]interface{}),
+		}
+		appendInputsAndOutputs(&tConfig, cms.Spec.Inputs, cms.Spec.Outputs)
+
+		sections = append(sections, Section{
+			Sources: []string{fmt.Sprintf("ClusterMetricSink %s", name)},
+			Config:  tConfig.encode(),
+		})
+	}
+
+	return sections
+}
+
+type debugConfig struct {
+	ClusterMetricSinks string       `json:"cluster-metric-sinks.conf"`
+	Sections           []Section    `json:"sections"`
+	LastPatch          *PatchResult `json:"last_patch"`
+}
+
+type debugNamespaceConfig struct {
+	Namespace string    `json:"namespace"`
+	Sections  []Section `json:"sections"`
+}
+
+// NewDebugHandler serves the current render of the cluster config as JSON.
+// The namespace query parameter instead returns the config rendered for the
+// MetricSinks in that namespace. The config includes output credentials, so
+// the handler should be wrapped by a debug.Authorizer.
+func NewDebugHandler(cc *ClusterConfig, c *Controller) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp interface{}
+		if ns := r.URL.Query().Get("namespace"); ns != "" {
+			resp = debugNamespaceConfig{
+				Namespace: ns,
+				Sections:  c.Sections(ns),
+			}
+		} else {
+			resp = debugConfig{
+				ClusterMetricSinks: cc.String(),
+				Sections:           cc.Sections(),
+				LastPatch:          cc.LastPatch(),
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(resp)
+		if err != nil {
+			log.Printf("Unable to marshal debug config: %s", err)
+		}
+	})
+}
@@ -0,0 +1,158 @@
+package metric_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sinkv1alpha1 "github.com/knative/observability/pkg/apis/sink/v1alpha1"
+	"github.com/knative/observability/pkg/metric"
+)
+
+func TestDebugHandler(t *testing.T) {
+	t.Run("it serves the cluster config and the last patch result", func(t *testing.T) {
+		cc := metric.NewConfig("", metric.KubernetesDefault(false))
+		cmc := metric.NewClusterController(&spyConfigMapPatcher{}, &spyDeploymentPodDeleter{}, cc)
+		cmc.OnAdd(&sinkv1alpha1.ClusterMetricSink{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "some-sink",
+			},
+			Spec: sinkv1alpha1.MetricSinkSpec{
+				Outputs: []sinkv1alpha1.MetricSinkMap{
+					{"type": "datadog", "api_key": "some-key"},
+				},
+			},
+		})
+		h := metric.NewDebugHandler(cc, metric.NewController("", nil, nil, nil))
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+
+		var resp struct {
+			Config    string              `json:"cluster-metric-sinks.conf"`
+			Sections  []metric.Section    `json:"sections"`
+			LastPatch *metric.PatchResult `json:"last_patch"`
+		}
+		err := json.NewDecoder(rec.Body).Decode(&resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.Config != cc.String() {
+			t.Errorf("Expected config %s, got %s", cc.String(), resp.Config)
+		}
+		if resp.LastPatch == nil || resp.LastPatch.Error != "" {
+			t.Errorf("Expected successful last patch, got %v", resp.LastPatch)
+		}
+
+		expected := []metric.Section{
+			{
+				Sources: []string{"default"},
+				Config: `[inputs]
+
+  [[inputs.kubernetes]]
+    bearer_token = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+    insecure_skip_verify = true
+    url = "https://127.0.0.1:10250"
+`,
+			},
+			{
+				Sources: []string{"ClusterMetricSink some-sink"},
+				Config: `[inputs]
+
+[outputs]
+
+  [[outputs.datadog]]
+    api_key = "some-key"
+`,
+			},
+		}
+		if diff := cmp.Diff(expected, resp.Sections); diff != "" {
+			t.Errorf("Sections not equal (-want, +got) = %v", diff)
+		}
+	})
+
+	t.Run("it serves the metric sinks of a namespace", func(t *testing.T) {
+		spyCoreClient := &spyCoreV1Client{
+			spyConfigMapCUDer: spyConfigMapCUDer{
+				createFunc: func(cm *v1.ConfigMap) (*v1.ConfigMap, error) {
+					return cm, nil
+				},
+			},
+		}
+		spyExtensionsClient := &spyAppsV1Client{
+			spyTelegrafDeploymentCUDer: spyTelegrafDeploymentCUDer{
+				createFunc: func(d *appsv1.Deployment) (*appsv1.Deployment, error) {
+					return d, nil
+				},
+			},
+		}
+		spyRBACClient := &spyRBACV1Client{
+			spyRoleCUDer: spyRoleCUDer{
+				createFunc: func(r *rbacv1.Role) (*rbacv1.Role, error) {
+					return r, nil
+				},
+			},
+			spyRoleBindingCUDer: spyRoleBindingCUDer{
+				createFunc: func(rb *rbacv1.RoleBinding) (*rbacv1.RoleBinding, error) {
+					return rb, nil
+				},
+			},
+		}
+		c := metric.NewController("", spyCoreClient, spyExtensionsClient, spyRBACClient)
+		for _, ns := range []string{"ns1", "ns2"} {
+			c.OnAdd(&sinkv1alpha1.MetricSink{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "some-sink",
+					Namespace: ns,
+				},
+				Spec: sinkv1alpha1.MetricSinkSpec{
+					Outputs: []sinkv1alpha1.MetricSinkMap{
+						{"type": "datadog", "api_key": "some-key"},
+					},
+				},
+			})
+		}
+		h := metric.NewDebugHandler(metric.NewConfig(""), c)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/config?namespace=ns1", nil))
+
+		var resp struct {
+			Namespace string           `json:"namespace"`
+			Sections  []metric.Section `json:"sections"`
+		}
+		err := json.NewDecoder(rec.Body).Decode(&resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []metric.Section{
+			{
+				Namespace: "ns1",
+				Sources:   []string{"MetricSink ns1/some-sink"},
+				Config: `[inputs]
+
+  [[inputs.prometheus]]
+    monitor_kubernetes_pods = true
+    monitor_kubernetes_pods_namespace = "ns1"
+
+[outputs]
+
+  [[outputs.datadog]]
+    api_key = "some-key"
+`,
+			},
+		}
+		if diff := cmp.Diff(expected, resp.Sections); diff != "" {
+			t.Errorf("Sections not equal (-want, +got) = %v", diff)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrictest reads Prometheus metrics in tests.
+package metrictest
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// TB is the part of testing.TB that Value uses, so that this package does
+// not import testing into the binaries that link it.
+type TB interface {
+	Helper()
+	Fatal(args ...interface{})
+}
+
+// Value returns the value of the metric with exactly the given labels, or
+// 0 if it was not gathered. Histograms have the value of their sample
+// count.
+func Value(t TB, g prometheus.Gatherer, name string, labels map[string]string) float64 {
+	t.Helper()
+
+	families, err := g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		for _, m := range f.Metric {
+			if !hasLabels(m, labels) {
+				continue
+			}
+			switch {
+			case m.Counter != nil:
+				return m.Counter.GetValue()
+			case m.Gauge != nil:
+				return m.Gauge.GetValue()
+			case m.Histogram != nil:
+				return float64(m.Histogram.GetSampleCount())
+			}
+		}
+	}
+	return 0
+}
+
+func hasLabels(m *dto.Metric, labels map[string]string) bool {
+	if len(m.Label) != len(labels) {
+		return false
+	}
+	for _, l := range m.Label {
+		if v, ok := labels[l.GetName()]; !ok || v != l.GetValue() {
+			return false
+		}
+	}
+	return true
+}
@@ -43,14 +43,7 @@ func (c *ClusterController) OnAdd(o interface{}) {
 
 	c.sc.UpsertClusterSink(d)
 
-	patches := []patch{
-		{
-			Op:    "replace",
-			Path:  "/data/outputs.conf",
-			Value: c.sc.String(),
-		},
-	}
-	patchConfig(patches, c.cmp, c.dsp)
+	c.sc.recordPatch(patchConfig(configPatches(c.sc), c.cmp, c.dsp))
 }
 
 func (c *ClusterController) OnDelete(o interface{}) {
@@ -61,14 +54,7 @@ func (c *ClusterController) OnDelete(o interface{}) {
 
 	c.sc.DeleteClusterSink(d)
 
-	patches := []patch{
-		{
-			Op:    "replace",
-			Path:  "/data/outputs.conf",
-			Value: c.sc.String(),
-		},
-	}
-	patchConfig(patches, c.cmp, c.dsp)
+	c.sc.recordPatch(patchConfig(configPatches(c.sc), c.cmp, c.dsp))
 }
 
 func (c *ClusterController) OnUpdate(old, new interface{}) {
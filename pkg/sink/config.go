@@ -23,6 +23,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"unicode"
 
 	"github.com/knative/observability/pkg/apis/sink/v1alpha1"
 )
@@ -44,16 +45,62 @@ const httpOutputConfig = `
 %s
 `
 
+const multilineFilterConfig = `
+[FILTER]
+    Name multiline
+    Match kube.*_%s_*
+    multiline.key_content log
+    multiline.parser %s
+`
+
+const multilineParserConfig = `
+[MULTILINE_PARSER]
+    name %s
+    type regex
+    flush_timeout 1000
+    rule "start_state" "/%s/" "cont"
+    rule "cont" "/%s/" "cont"
+`
+
+// defaultContinueRegex treats indented lines as continuations of the
+// previous record when a LogSink only specifies a start regex.
+const defaultContinueRegex = `^\s+`
+
+const parserFilterConfig = `
+[FILTER]
+    Name parser
+    Match kube.*_%s_*
+    Key_Name log
+    Parser %s
+    Reserve_Data On
+`
+
+var multilinePresets = map[string]bool{
+	"go":     true,
+	"java":   true,
+	"python": true,
+	"ruby":   true,
+}
+
+// IsMultilinePreset reports whether name is a built-in fluent-bit multiline
+// parser that can be referenced from a LogSink.
+func IsMultilinePreset(name string) bool {
+	return multilinePresets[name]
+}
+
 type Config struct {
 	mu           sync.Mutex
 	sinks        map[string]*v1alpha1.LogSink
 	clusterSinks map[string]*v1alpha1.ClusterLogSink
+	parsers      map[string]*v1alpha1.LogParser
+	lastPatch    *PatchResult
 }
 
 func NewConfig() *Config {
 	return &Config{
 		sinks:        make(map[string]*v1alpha1.LogSink),
 		clusterSinks: make(map[string]*v1alpha1.ClusterLogSink),
+		parsers:      make(map[string]*v1alpha1.LogParser),
 	}
 }
 
@@ -81,15 +128,209 @@ func (sc *Config) DeleteClusterSink(s *v1alpha1.ClusterLogSink) {
 	delete(sc.clusterSinks, clusterKey(s))
 }
 
+// UpsertParser adds or replaces a LogParser. Parsers with fields that
+// would break out of their [PARSER] section are dropped, so they are neither
+// rendered nor referenced by filters.
+func (sc *Config) UpsertParser(p *v1alpha1.LogParser) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	name := ParserName(p.Namespace, p.Name)
+	if !ValidParserSpec(p.Spec) {
+		log.Printf("ignoring log parser %s with control characters", name)
+		delete(sc.parsers, name)
+		return
+	}
+	sc.parsers[name] = p
+}
+
+func (sc *Config) DeleteParser(p *v1alpha1.LogParser) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	delete(sc.parsers, ParserName(p.Namespace, p.Name))
+}
+
+// Snapshot is the fluent-bit config rendered from a single state of the
+// sinks and parsers.
+type Snapshot struct {
+	Outputs string
+	Filters string
+	Parsers string
+}
+
+// Snapshot renders the outputs, filters and parsers under one lock, so
+// filters never reference parsers missing from the same render.
+func (sc *Config) Snapshot() Snapshot {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return Snapshot{
+		Outputs: sc.outputs(),
+		Filters: sc.filters(),
+		Parsers: sc.parsersConfig(),
+	}
+}
+
 func (sc *Config) String() string {
 	sc.mu.Lock()
 	defer sc.mu.Unlock()
+	return sc.outputs()
+}
+
+func (sc *Config) outputs() string {
 	if len(sc.sinks)+len(sc.clusterSinks) == 0 {
 		return nullConfig
 	}
 	return sc.syslogConfig() + sc.webhookConfig()
 }
 
+// Filters returns the multiline and parser filters for every namespace that
+// has a LogSink configuring them.
+func (sc *Config) Filters() string {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.filters()
+}
+
+func (sc *Config) filters() string {
+	var namespaces []string
+	sinks := make(map[string][]*v1alpha1.LogSink)
+	for _, s := range sc.sortedSinks() {
+		ns := canonicalNamespace(s.Namespace)
+		if _, ok := sinks[ns]; !ok {
+			namespaces = append(namespaces, ns)
+		}
+		sinks[ns] = append(sinks[ns], s)
+	}
+	sort.Strings(namespaces)
+
+	var config string
+	for _, ns := range namespaces {
+		config += multilineFilter(ns, sinks[ns])
+		config += sc.parserFilters(ns, sinks[ns])
+	}
+
+	return config
+}
+
+// Parsers returns the LogParsers and a multiline parser for each LogSink
+// that specifies a start regex. fluent-bit loads them in addition to the
+// default parsers of the ConfigMap.
+func (sc *Config) Parsers() string {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.parsersConfig()
+}
+
+func (sc *Config) parsersConfig() string {
+	var config string
+
+	names := make([]string, 0, len(sc.parsers))
+	for name := range sc.parsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		config += parserConfig(name, sc.parsers[name].Spec)
+	}
+
+	for _, s := range sc.sortedSinks() {
+		config += multilineParser(s)
+	}
+
+	return config
+}
+
+// multilineParser returns the multiline parser of a LogSink that specifies
+// a start regex, or an empty string otherwise.
+func multilineParser(s *v1alpha1.LogSink) string {
+	if s.Spec.Multiline == nil || s.Spec.Multiline.StartRegex == "" {
+		return ""
+	}
+
+	cont := s.Spec.Multiline.ContinueRegex
+	if cont == "" {
+		cont = defaultContinueRegex
+	}
+	return fmt.Sprintf(
+		multilineParserConfig,
+		multilineParserName(s),
+		s.Spec.Multiline.StartRegex,
+		cont,
+	)
+}
+
+func multilineFilter(namespace string, sinks []*v1alpha1.LogSink) string {
+	var parsers []string
+	for _, s := range sinks {
+		if s.Spec.Multiline == nil {
+			continue
+		}
+
+		parsers = append(parsers, s.Spec.Multiline.Presets...)
+		if s.Spec.Multiline.StartRegex != "" {
+			parsers = append(parsers, multilineParserName(s))
+		}
+	}
+
+	parsers = uniqueStrings(parsers)
+	if len(parsers) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(multilineFilterConfig, namespace, strings.Join(parsers, ","))
+}
+
+// parserFilters only renders filters for parsers that exist since fluent-bit
+// refuses to start when a filter references an unknown parser.
+func (sc *Config) parserFilters(namespace string, sinks []*v1alpha1.LogSink) string {
+	var parsers []string
+	for _, s := range sinks {
+		if s.Spec.Parser == "" {
+			continue
+		}
+
+		name := ParserName(s.Namespace, s.Spec.Parser)
+		if _, ok := sc.parsers[name]; !ok {
+			continue
+		}
+		parsers = append(parsers, name)
+	}
+
+	var config string
+	for _, name := range uniqueStrings(parsers) {
+		config += fmt.Sprintf(parserFilterConfig, namespace, name)
+	}
+
+	return config
+}
+
+func parserConfig(name string, spec v1alpha1.LogParserSpec) string {
+	config := fmt.Sprintf("\n[PARSER]\n    Name %s\n    Format %s\n", name, spec.Format)
+	if spec.Format == "regex" {
+		config += fmt.Sprintf("    Regex %s\n", spec.Regex)
+	}
+	if spec.TimeKey != "" {
+		config += fmt.Sprintf("    Time_Key %s\n", spec.TimeKey)
+	}
+	if spec.TimeFormat != "" {
+		config += fmt.Sprintf("    Time_Format %s\n", spec.TimeFormat)
+	}
+	return config
+}
+
+func (sc *Config) sortedSinks() []*v1alpha1.LogSink {
+	sinks := make([]*v1alpha1.LogSink, 0, len(sc.sinks))
+	for _, s := range sc.sinks {
+		sinks = append(sinks, s)
+	}
+	sort.Slice(sinks, func(i, j int) bool {
+		if sinks[i].Namespace != sinks[j].Namespace {
+			return sinks[i].Namespace < sinks[j].Namespace
+		}
+		return sinks[i].Name < sinks[j].Name
+	})
+	return sinks
+}
+
 func (sc *Config) webhookConfig() string {
 	var config string
 	for _, s := range sc.sinks {
@@ -118,18 +359,7 @@ func (sc *Config) syslogConfig() string {
 			continue
 		}
 
-		var tlsConfig *tls
-		if s.Spec.EnableTLS {
-			tlsConfig = &tls{
-				InsecureSkipVerify: s.Spec.InsecureSkipVerify,
-			}
-		}
-		sinks = append(sinks, sink{
-			Addr:      fmt.Sprintf("%s:%d", s.Spec.Host, s.Spec.Port),
-			Namespace: canonicalNamespace(s.Namespace),
-			TLS:       tlsConfig,
-			Name:      s.Name,
-		})
+		sinks = append(sinks, newSyslogSink(s.Name, canonicalNamespace(s.Namespace), s.Spec))
 	}
 	sort.Slice(sinks, func(i, j int) bool {
 		if sinks[i].Namespace != sinks[j].Namespace {
@@ -144,17 +374,7 @@ func (sc *Config) syslogConfig() string {
 			continue
 		}
 
-		var tlsConfig *tls
-		if s.Spec.EnableTLS {
-			tlsConfig = &tls{
-				InsecureSkipVerify: s.Spec.InsecureSkipVerify,
-			}
-		}
-		clusterSinks = append(clusterSinks, sink{
-			Addr: fmt.Sprintf("%s:%d", s.Spec.Host, s.Spec.Port),
-			TLS:  tlsConfig,
-			Name: s.Name,
-		})
+		clusterSinks = append(clusterSinks, newSyslogSink(s.Name, "", s.Spec))
 	}
 	sort.Slice(clusterSinks, func(i, j int) bool {
 		return clusterSinks[i].Name < clusterSinks[j].Name
@@ -174,6 +394,21 @@ type sink struct {
 	Name      string `json:"name,omitempty"`
 }
 
+func newSyslogSink(name, namespace string, spec v1alpha1.SinkSpec) sink {
+	var tlsConfig *tls
+	if spec.EnableTLS {
+		tlsConfig = &tls{
+			InsecureSkipVerify: spec.InsecureSkipVerify,
+		}
+	}
+	return sink{
+		Addr:      fmt.Sprintf("%s:%d", spec.Host, spec.Port),
+		Namespace: namespace,
+		TLS:       tlsConfig,
+		Name:      name,
+	}
+}
+
 type sinkList []sink
 
 func (ss sinkList) String() string {
@@ -271,6 +506,47 @@ func buildHTTPConfig(namespace string, spec v1alpha1.SinkSpec, isCluster bool) s
 	)
 }
 
+// ValidParserSpec reports whether the fields rendered into the [PARSER]
+// section of a LogParser are free of control characters.
+func ValidParserSpec(spec v1alpha1.LogParserSpec) bool {
+	for _, f := range []string{spec.Format, spec.Regex, spec.TimeKey, spec.TimeFormat} {
+		if HasControlCharacter(f) {
+			return false
+		}
+	}
+	return true
+}
+
+// HasControlCharacter reports whether s contains a newline or another
+// control character, which would end or corrupt a line of fluent-bit
+// config.
+func HasControlCharacter(s string) bool {
+	return strings.IndexFunc(s, unicode.IsControl) >= 0
+}
+
+// ParserName is the name a LogParser is registered under in fluent-bit.
+// Namespaces cannot contain dots so the name is unique across namespaces.
+func ParserName(namespace, name string) string {
+	return fmt.Sprintf("%s.%s", canonicalNamespace(namespace), name)
+}
+
+func multilineParserName(s *v1alpha1.LogSink) string {
+	return fmt.Sprintf("multiline-%s-%s", canonicalNamespace(s.Namespace), s.Name)
+}
+
+func uniqueStrings(ss []string) []string {
+	seen := make(map[string]bool, len(ss))
+	result := make([]string, 0, len(ss))
+	for _, s := range ss {
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		result = append(result, s)
+	}
+	return result
+}
+
 func canonicalNamespace(ns string) string {
 	if ns == "" {
 		return "default"
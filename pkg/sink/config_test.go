@@ -1203,6 +1203,372 @@ func TestWebhookSinks(t *testing.T) {
 	}
 }
 
+func TestMultilineFilters(t *testing.T) {
+	t.Run("it generates no filters without multiline configuration", func(t *testing.T) {
+		sc := sink.NewConfig()
+		sc.UpsertSink(&v1alpha1.LogSink{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "some-name",
+				Namespace: "some-namespace",
+			},
+			Spec: v1alpha1.SinkSpec{
+				Type: "syslog",
+				SyslogSpec: v1alpha1.SyslogSpec{
+					Host: "example.com",
+					Port: 12345,
+				},
+			},
+		})
+
+		if sc.Filters() != "" {
+			t.Errorf("Expected no filters, got: %s", sc.Filters())
+		}
+	})
+
+	t.Run("it combines presets and custom parsers per namespace", func(t *testing.T) {
+		sc := sink.NewConfig()
+		sc.UpsertSink(&v1alpha1.LogSink{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "sink-a",
+				Namespace: "ns1",
+			},
+			Spec: v1alpha1.SinkSpec{
+				Type: "syslog",
+				Multiline: &v1alpha1.MultilineSpec{
+					Presets: []string{"java", "python"},
+				},
+			},
+		})
+		sc.UpsertSink(&v1alpha1.LogSink{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "sink-b",
+				Namespace: "ns1",
+			},
+			Spec: v1alpha1.SinkSpec{
+				Type: "webhook",
+				Multiline: &v1alpha1.MultilineSpec{
+					Presets:    []string{"java"},
+					StartRegex: `^\d{4}-\d{2}-\d{2}`,
+				},
+			},
+		})
+		sc.UpsertSink(&v1alpha1.LogSink{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "sink-c",
+				Namespace: "ns2",
+			},
+			Spec: v1alpha1.SinkSpec{
+				Type: "syslog",
+				Multiline: &v1alpha1.MultilineSpec{
+					Presets: []string{"go"},
+				},
+			},
+		})
+		sc.UpsertClusterSink(&v1alpha1.ClusterLogSink{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "cluster-sink",
+			},
+			Spec: v1alpha1.SinkSpec{
+				Type: "syslog",
+				Multiline: &v1alpha1.MultilineSpec{
+					Presets: []string{"ruby"},
+				},
+			},
+		})
+
+		f, err := flbconfig.Parse("", sc.Filters())
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := flbconfig.File{
+			Sections: []flbconfig.Section{
+				{},
+				multilineFilterSection("ns1", "java,python,multiline-ns1-sink-b"),
+				multilineFilterSection("ns2", "go"),
+			},
+		}
+		if !cmp.Equal(f, expected) {
+			t.Fatal(cmp.Diff(f, expected))
+		}
+	})
+
+	t.Run("it generates a multiline parser for custom regexes", func(t *testing.T) {
+		sc := sink.NewConfig()
+		sc.UpsertSink(&v1alpha1.LogSink{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "some-name",
+				Namespace: "some-namespace",
+			},
+			Spec: v1alpha1.SinkSpec{
+				Type: "syslog",
+				Multiline: &v1alpha1.MultilineSpec{
+					StartRegex:    `^Traceback`,
+					ContinueRegex: `^\s+File`,
+				},
+			},
+		})
+		sc.UpsertSink(&v1alpha1.LogSink{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "default-continue",
+			},
+			Spec: v1alpha1.SinkSpec{
+				Type: "syslog",
+				Multiline: &v1alpha1.MultilineSpec{
+					StartRegex: `^\[`,
+				},
+			},
+		})
+
+		f, err := flbconfig.Parse("", sc.Parsers())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(f.Sections) != 3 {
+			t.Fatalf("Expected 3 sections, got %d", len(f.Sections))
+		}
+
+		expected := []flbconfig.Section{
+			multilineParserSection("multiline-default-default-continue", `^\[`, `^\s+`),
+			multilineParserSection("multiline-some-namespace-some-name", `^Traceback`, `^\s+File`),
+		}
+		if !cmp.Equal(f.Sections[1:], expected) {
+			t.Fatal(cmp.Diff(f.Sections[1:], expected))
+		}
+	})
+}
+
+func TestLogParsers(t *testing.T) {
+	t.Run("it registers parsers under their namespaced name", func(t *testing.T) {
+		sc := sink.NewConfig()
+		sc.UpsertParser(&v1alpha1.LogParser{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "access",
+				Namespace: "ns1",
+			},
+			Spec: v1alpha1.LogParserSpec{
+				Format:     "regex",
+				Regex:      `^(?<host>[^ ]*) (?<message>.*)$`,
+				TimeKey:    "time",
+				TimeFormat: "%d/%b/%Y:%H:%M:%S %z",
+			},
+		})
+		sc.UpsertParser(&v1alpha1.LogParser{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "kv",
+			},
+			Spec: v1alpha1.LogParserSpec{
+				Format: "logfmt",
+			},
+		})
+
+		f, err := flbconfig.Parse("", sc.Parsers())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(f.Sections) != 3 {
+			t.Fatalf("Expected 3 sections, got %d", len(f.Sections))
+		}
+
+		expected := []flbconfig.Section{
+			{
+				Name: "PARSER",
+				KeyValues: []flbconfig.KeyValue{
+					{Key: "Name", Value: "default.kv"},
+					{Key: "Format", Value: "logfmt"},
+				},
+			},
+			{
+				Name: "PARSER",
+				KeyValues: []flbconfig.KeyValue{
+					{Key: "Name", Value: "ns1.access"},
+					{Key: "Format", Value: "regex"},
+					{Key: "Regex", Value: `^(?<host>[^ ]*) (?<message>.*)$`},
+					{Key: "Time_Key", Value: "time"},
+					{Key: "Time_Format", Value: "%d/%b/%Y:%H:%M:%S %z"},
+				},
+			},
+		}
+		if !cmp.Equal(f.Sections[1:], expected) {
+			t.Fatal(cmp.Diff(f.Sections[1:], expected))
+		}
+
+		sc.DeleteParser(&v1alpha1.LogParser{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "access",
+				Namespace: "ns1",
+			},
+		})
+		f, err = flbconfig.Parse("", sc.Parsers())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(f.Sections) != 2 {
+			t.Fatalf("Expected 2 sections, got %d", len(f.Sections))
+		}
+	})
+
+	t.Run("it ignores parsers with control characters", func(t *testing.T) {
+		sc := sink.NewConfig()
+		parser := &v1alpha1.LogParser{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "access",
+				Namespace: "ns1",
+			},
+			Spec: v1alpha1.LogParserSpec{
+				Format: "json",
+			},
+		}
+		sc.UpsertParser(parser)
+		sc.UpsertSink(&v1alpha1.LogSink{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "sink-a",
+				Namespace: "ns1",
+			},
+			Spec: v1alpha1.SinkSpec{
+				Type:   "syslog",
+				Parser: "access",
+			},
+		})
+
+		parser.Spec.TimeKey = "time\n[OUTPUT]\n    Name stdout"
+		sc.UpsertParser(parser)
+
+		if sc.Parsers() != "" {
+			t.Errorf("Expected no parsers, got: %s", sc.Parsers())
+		}
+		if sc.Filters() != "" {
+			t.Errorf("Expected no filters, got: %s", sc.Filters())
+		}
+	})
+
+	t.Run("it filters a namespace with the parser referenced by its log sinks", func(t *testing.T) {
+		sc := sink.NewConfig()
+		sc.UpsertParser(&v1alpha1.LogParser{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "access",
+				Namespace: "ns1",
+			},
+			Spec: v1alpha1.LogParserSpec{
+				Format: "json",
+			},
+		})
+		sc.UpsertSink(&v1alpha1.LogSink{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "sink-a",
+				Namespace: "ns1",
+			},
+			Spec: v1alpha1.SinkSpec{
+				Type:   "syslog",
+				Parser: "access",
+				Multiline: &v1alpha1.MultilineSpec{
+					Presets: []string{"java"},
+				},
+			},
+		})
+		sc.UpsertSink(&v1alpha1.LogSink{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "sink-b",
+				Namespace: "ns1",
+			},
+			Spec: v1alpha1.SinkSpec{
+				Type:   "webhook",
+				Parser: "access",
+			},
+		})
+		sc.UpsertSink(&v1alpha1.LogSink{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "sink-c",
+				Namespace: "ns2",
+			},
+			Spec: v1alpha1.SinkSpec{
+				Type:   "syslog",
+				Parser: "access",
+			},
+		})
+
+		f, err := flbconfig.Parse("", sc.Filters())
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := flbconfig.File{
+			Sections: []flbconfig.Section{
+				{},
+				multilineFilterSection("ns1", "java"),
+				{
+					Name: "FILTER",
+					KeyValues: []flbconfig.KeyValue{
+						{Key: "Name", Value: "parser"},
+						{Key: "Match", Value: "kube.*_ns1_*"},
+						{Key: "Key_Name", Value: "log"},
+						{Key: "Parser", Value: "ns1.access"},
+						{Key: "Reserve_Data", Value: "On"},
+					},
+				},
+			},
+		}
+		if !cmp.Equal(f, expected) {
+			t.Fatal(cmp.Diff(f, expected))
+		}
+	})
+
+	t.Run("it snapshots the outputs, filters and parsers together", func(t *testing.T) {
+		sc := sink.NewConfig()
+		sc.UpsertParser(&v1alpha1.LogParser{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "access",
+				Namespace: "ns1",
+			},
+			Spec: v1alpha1.LogParserSpec{
+				Format: "json",
+			},
+		})
+		sc.UpsertSink(&v1alpha1.LogSink{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "sink-a",
+				Namespace: "ns1",
+			},
+			Spec: v1alpha1.SinkSpec{
+				Type:   "syslog",
+				Parser: "access",
+			},
+		})
+
+		expected := sink.Snapshot{
+			Outputs: sc.String(),
+			Filters: sc.Filters(),
+			Parsers: sc.Parsers(),
+		}
+		if snap := sc.Snapshot(); !cmp.Equal(snap, expected) {
+			t.Fatal(cmp.Diff(snap, expected))
+		}
+	})
+}
+
+func multilineFilterSection(namespace, parsers string) flbconfig.Section {
+	return flbconfig.Section{
+		Name: "FILTER",
+		KeyValues: []flbconfig.KeyValue{
+			{Key: "Name", Value: "multiline"},
+			{Key: "Match", Value: fmt.Sprintf("kube.*_%s_*", namespace)},
+			{Key: "multiline.key_content", Value: "log"},
+			{Key: "multiline.parser", Value: parsers},
+		},
+	}
+}
+
+func multilineParserSection(name, start, cont string) flbconfig.Section {
+	return flbconfig.Section{
+		Name: "MULTILINE_PARSER",
+		KeyValues: []flbconfig.KeyValue{
+			{Key: "name", Value: name},
+			{Key: "type", Value: "regex"},
+			{Key: "flush_timeout", Value: "1000"},
+			{Key: "rule", Value: fmt.Sprintf(`"start_state" "/%s/" "cont"`, start)},
+			{Key: "rule", Value: fmt.Sprintf(`"cont" "/%s/" "cont"`, cont)},
+		},
+	}
+}
+
 type clusterSink struct {
 	Addr string     `json:"addr,omitempty"`
 	TLS  *tlsConfig `json:"tls,omitempty"`
@@ -47,14 +47,7 @@ func (c *Controller) OnAdd(o interface{}) {
 
 	c.sc.UpsertSink(d)
 
-	patches := []patch{
-		{
-			Op:    "replace",
-			Path:  "/data/outputs.conf",
-			Value: c.sc.String(),
-		},
-	}
-	patchConfig(patches, c.cmp, c.dsp)
+	c.sc.recordPatch(patchConfig(configPatches(c.sc), c.cmp, c.dsp))
 }
 
 func (c *Controller) OnDelete(o interface{}) {
@@ -65,25 +58,45 @@ func (c *Controller) OnDelete(o interface{}) {
 
 	c.sc.DeleteSink(d)
 
-	patches := []patch{
+	c.sc.recordPatch(patchConfig(configPatches(c.sc), c.cmp, c.dsp))
+}
+
+// configPatches replaces every section of the fluent-bit ConfigMap that is
+// rendered from log sinks. The sections come from one snapshot so a patch
+// never mixes sinks and parsers from different updates.
+func configPatches(sc *Config) []patch {
+	snap := sc.Snapshot()
+	return []patch{
 		{
 			Op:    "replace",
 			Path:  "/data/outputs.conf",
-			Value: c.sc.String(),
+			Value: snap.Outputs,
+		},
+		{
+			Op:    "replace",
+			Path:  "/data/namespace-filters.conf",
+			Value: snap.Filters,
+		},
+		{
+			Op:    "replace",
+			Path:  "/data/namespace-parsers.conf",
+			Value: snap.Parsers,
 		},
 	}
-	patchConfig(patches, c.cmp, c.dsp)
 }
 
-func patchConfig(patches []patch, cmp ConfigMapPatcher, dsp DaemonSetPodDeleter) {
+// patchConfig returns the error from patching the ConfigMap, if any.
+// Errors restarting fluent-bit are only logged.
+func patchConfig(patches []patch, cmp ConfigMapPatcher, dsp DaemonSetPodDeleter) error {
 	data, err := json.Marshal(patches)
 	if err != nil {
 		log.Println(err.Error())
+		return err
 	}
 
-	_, err = cmp.Patch(ConfigMapName, types.JSONPatchType, data)
-	if err != nil {
-		log.Println(err.Error())
+	_, patchErr := cmp.Patch(ConfigMapName, types.JSONPatchType, data)
+	if patchErr != nil {
+		log.Println(patchErr.Error())
 	}
 
 	err = dsp.DeleteCollection(
@@ -96,6 +109,7 @@ func patchConfig(patches []patch, cmp ConfigMapPatcher, dsp DaemonSetPodDeleter)
 		log.Println(err.Error())
 	}
 
+	return patchErr
 }
 
 func (c *Controller) OnUpdate(old, new interface{}) {
@@ -340,6 +340,51 @@ func TestLogSinkController(t *testing.T) {
 		}
 	})
 
+	t.Run("it patches multiline filters for the log sink namespace", func(t *testing.T) {
+		spyPatcher := &spyConfigMapPatcher{}
+		c := sink.NewController(
+			spyPatcher,
+			&spyDaemonSetPodDeleter{},
+			sink.NewConfig(),
+		)
+
+		s := &v1alpha1.LogSink{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "sink",
+				Namespace: "test-ns",
+			},
+			Spec: v1alpha1.SinkSpec{
+				Type: "syslog",
+				SyslogSpec: v1alpha1.SyslogSpec{
+					Host: "example.com",
+					Port: 12345,
+				},
+				Multiline: &v1alpha1.MultilineSpec{
+					Presets: []string{"java"},
+				},
+			},
+		}
+		c.OnAdd(s)
+		c.OnDelete(s)
+
+		spyPatcher.expectPatches([]spyPatch{
+			{
+				Path: "/data/namespace-filters.conf",
+				Value: `
+[FILTER]
+    Name multiline
+    Match kube.*_test-ns_*
+    multiline.key_content log
+    multiline.parser java
+`,
+			},
+			{
+				Path:  "/data/namespace-filters.conf",
+				Value: "",
+			},
+		}, t)
+	})
+
 	t.Run("it should not panic if it receives a non log sink type", func(t *testing.T) {
 		c := sink.NewController(
 			&spyConfigMapPatcher{},
@@ -400,12 +445,10 @@ func (s *spyConfigMapPatcher) expectPatches(patches []spyPatch, t *testing.T) {
 			t.Errorf("Patch Type does not equal Got: %s, Expected %s", s.patches[i].pt, types.JSONPatchType)
 		}
 
-		jpExpected := []jsonPatch{
-			{
-				Op:    "replace",
-				Path:  p.Path,
-				Value: p.Value,
-			},
+		jpExpected := jsonPatch{
+			Op:    "replace",
+			Path:  p.Path,
+			Value: p.Value,
 		}
 		var jpActual []jsonPatch
 		err := json.Unmarshal(s.patches[i].data, &jpActual)
@@ -413,12 +456,27 @@ func (s *spyConfigMapPatcher) expectPatches(patches []spyPatch, t *testing.T) {
 			t.Errorf("Could not Unmarshal json patch: %s", err)
 		}
 
-		if diff := cmp.Diff(jpExpected, jpActual); diff != "" {
+		jp, ok := findPatch(jpActual, p.Path)
+		if !ok {
+			t.Errorf("Missing patch for path %s in patch %d", p.Path, i)
+			continue
+		}
+
+		if diff := cmp.Diff(jpExpected, jp); diff != "" {
 			t.Errorf("Patches not equal (-want, +got) = %v", diff)
 		}
 	}
 }
 
+func findPatch(patches []jsonPatch, path string) (jsonPatch, bool) {
+	for _, p := range patches {
+		if p.Path == path {
+			return p, true
+		}
+	}
+	return jsonPatch{}, false
+}
+
 type spyPatch struct {
 	Path  string
 	Value string
@@ -0,0 +1,258 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/knative/observability/pkg/apis/sink/v1alpha1"
+)
+
+// Section is a piece of the rendered fluent-bit config along with the
+// resources that contributed to it. Namespace is empty for sections that
+// apply to the whole cluster.
+type Section struct {
+	Kind      string   `json:"kind"`
+	Namespace string   `json:"namespace,omitempty"`
+	Sources   []string `json:"sources"`
+	Config    string   `json:"config"`
+}
+
+// PatchResult is the outcome of the most recent ConfigMap patch.
+type PatchResult struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error,omitempty"`
+}
+
+// LastPatch returns the result of the most recent patch made from this
+// config, or nil if it has not been patched yet.
+func (sc *Config) LastPatch() *PatchResult {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.lastPatch == nil {
+		return nil
+	}
+	p := *sc.lastPatch
+	return &p
+}
+
+func (sc *Config) recordPatch(err error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.lastPatch = &PatchResult{Time: time.Now()}
+	if err != nil {
+		sc.lastPatch.Error = err.Error()
+	}
+}
+
+// Sections returns every output, filter and parser rendered from the
+// current sinks and parsers.
+func (sc *Config) Sections() []Section {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	var sections []Section
+	sinks := sc.sortedSinks()
+	for _, s := range sinks {
+		sections = append(sections, Section{
+			Kind:      "output",
+			Namespace: canonicalNamespace(s.Namespace),
+			Sources:   []string{logSinkSource(s)},
+			Config:    outputConfig(s.Name, canonicalNamespace(s.Namespace), s.Spec),
+		})
+	}
+
+	clusterSinks := make([]*v1alpha1.ClusterLogSink, 0, len(sc.clusterSinks))
+	for _, s := range sc.clusterSinks {
+		clusterSinks = append(clusterSinks, s)
+	}
+	sort.Slice(clusterSinks, func(i, j int) bool {
+		return clusterSinks[i].Name < clusterSinks[j].Name
+	})
+	for _, s := range clusterSinks {
+		sections = append(sections, Section{
+			Kind:    "output",
+			Sources: []string{fmt.Sprintf("ClusterLogSink %s", s.Name)},
+			Config:  outputConfig(s.Name, "", s.Spec),
+		})
+	}
+
+	namespaces := make(map[string][]*v1alpha1.LogSink)
+	for _, s := range sinks {
+		ns := canonicalNamespace(s.Namespace)
+		namespaces[ns] = append(namespaces[ns], s)
+	}
+	var names []string
+	for ns := range namespaces {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+	for _, ns := range names {
+		sections = append(sections, sc.filterSections(ns, namespaces[ns])...)
+	}
+
+	parsers := make([]string, 0, len(sc.parsers))
+	for name := range sc.parsers {
+		parsers = append(parsers, name)
+	}
+	sort.Strings(parsers)
+	for _, name := range parsers {
+		p := sc.parsers[name]
+		sections = append(sections, Section{
+			Kind:      "parser",
+			Namespace: canonicalNamespace(p.Namespace),
+			Sources:   []string{fmt.Sprintf("LogParser %s/%s", canonicalNamespace(p.Namespace), p.Name)},
+			Config:    parserConfig(name, p.Spec),
+		})
+	}
+
+	for _, s := range sinks {
+		config := multilineParser(s)
+		if config == "" {
+			continue
+		}
+		sections = append(sections, Section{
+			Kind:      "parser",
+			Namespace: canonicalNamespace(s.Namespace),
+			Sources:   []string{logSinkSource(s)},
+			Config:    config,
+		})
+	}
+
+	return sections
+}
+
+func (sc *Config) filterSections(namespace string, sinks []*v1alpha1.LogSink) []Section {
+	var (
+		sections  []Section
+		multiline []*v1alpha1.LogSink
+		sources   []string
+	)
+	for _, s := range sinks {
+		if s.Spec.Multiline != nil {
+			multiline = append(multiline, s)
+			sources = append(sources, logSinkSource(s))
+		}
+	}
+	if config := multilineFilter(namespace, multiline); config != "" {
+		sections = append(sections, Section{
+			Kind:      "filter",
+			Namespace: namespace,
+			Sources:   sources,
+			Config:    config,
+		})
+	}
+
+	var parsers []string
+	parserSources := make(map[string][]string)
+	for _, s := range sinks {
+		if s.Spec.Parser == "" {
+			continue
+		}
+
+		name := ParserName(s.Namespace, s.Spec.Parser)
+		if _, ok := sc.parsers[name]; !ok {
+			continue
+		}
+		if _, ok := parserSources[name]; !ok {
+			parsers = append(parsers, name)
+		}
+		parserSources[name] = append(parserSources[name], logSinkSource(s))
+	}
+	for _, name := range parsers {
+		sections = append(sections, Section{
+			Kind:      "filter",
+			Namespace: namespace,
+			Sources:   parserSources[name],
+			Config:    fmt.Sprintf(parserFilterConfig, namespace, name),
+		})
+	}
+
+	return sections
+}
+
+func outputConfig(name, namespace string, spec v1alpha1.SinkSpec) string {
+	switch spec.Type {
+	case "syslog":
+		s := newSyslogSink(name, namespace, spec)
+		return s.String()
+	case "webhook":
+		return buildHTTPConfig(namespace, spec, namespace == "")
+	default:
+		return ""
+	}
+}
+
+func logSinkSource(s *v1alpha1.LogSink) string {
+	return fmt.Sprintf("LogSink %s/%s", canonicalNamespace(s.Namespace), s.Name)
+}
+
+type debugConfig struct {
+	Outputs   string       `json:"outputs.conf"`
+	Filters   string       `json:"namespace-filters.conf"`
+	Parsers   string       `json:"namespace-parsers.conf"`
+	Sections  []Section    `json:"sections"`
+	LastPatch *PatchResult `json:"last_patch"`
+}
+
+type debugNamespaceConfig struct {
+	Namespace string    `json:"namespace"`
+	Sections  []Section `json:"sections"`
+}
+
+// NewDebugHandler serves the current render of the config as JSON. The
+// namespace query parameter limits the response to the sections rendered
+// from that namespace. The config includes sink destinations, so the
+// handler should be wrapped by a debug.Authorizer.
+func NewDebugHandler(sc *Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp interface{}
+		if ns := r.URL.Query().Get("namespace"); ns != "" {
+			sections := []Section{}
+			for _, s := range sc.Sections() {
+				if s.Namespace == ns {
+					sections = append(sections, s)
+				}
+			}
+			resp = debugNamespaceConfig{
+				Namespace: ns,
+				Sections:  sections,
+			}
+		} else {
+			snap := sc.Snapshot()
+			resp = debugConfig{
+				Outputs:   snap.Outputs,
+				Filters:   snap.Filters,
+				Parsers:   snap.Parsers,
+				Sections:  sc.Sections(),
+				LastPatch: sc.LastPatch(),
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(resp)
+		if err != nil {
+			log.Printf("Unable to marshal debug config: %s", err)
+		}
+	})
+}
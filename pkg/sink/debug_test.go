@@ -0,0 +1,212 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sink_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	coreV1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/knative/observability/pkg/apis/sink/v1alpha1"
+	"github.com/knative/observability/pkg/sink"
+)
+
+func TestDebugHandler(t *testing.T) {
+	sc := sink.NewConfig()
+	sc.UpsertSink(&v1alpha1.LogSink{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "sink-a",
+			Namespace: "ns1",
+		},
+		Spec: v1alpha1.SinkSpec{
+			Type: "syslog",
+			SyslogSpec: v1alpha1.SyslogSpec{
+				Host: "example.com",
+				Port: 12345,
+			},
+			Multiline: &v1alpha1.MultilineSpec{
+				Presets: []string{"java"},
+			},
+		},
+	})
+	sc.UpsertSink(&v1alpha1.LogSink{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "sink-b",
+			Namespace: "ns2",
+		},
+		Spec: v1alpha1.SinkSpec{
+			Type: "webhook",
+			WebhookSpec: v1alpha1.WebhookSpec{
+				URL: "https://example.com/some/path",
+			},
+		},
+	})
+	sc.UpsertClusterSink(&v1alpha1.ClusterLogSink{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster-sink",
+		},
+		Spec: v1alpha1.SinkSpec{
+			Type: "syslog",
+			SyslogSpec: v1alpha1.SyslogSpec{
+				Host: "example.com",
+				Port: 23456,
+			},
+		},
+	})
+
+	t.Run("it serves the rendered config, its sources and the last patch", func(t *testing.T) {
+		c := sink.NewParserController(
+			&errConfigMapPatcher{},
+			&spyDaemonSetPodDeleter{},
+			sc,
+		)
+		c.OnAdd(&v1alpha1.LogParser{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "unused",
+				Namespace: "ns3",
+			},
+			Spec: v1alpha1.LogParserSpec{
+				Format: "json",
+			},
+		})
+
+		rec := httptest.NewRecorder()
+		sink.NewDebugHandler(sc).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+
+		var resp struct {
+			Outputs   string            `json:"outputs.conf"`
+			Filters   string            `json:"namespace-filters.conf"`
+			Parsers   string            `json:"namespace-parsers.conf"`
+			Sections  []sink.Section    `json:"sections"`
+			LastPatch *sink.PatchResult `json:"last_patch"`
+		}
+		err := json.NewDecoder(rec.Body).Decode(&resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.Outputs != sc.String() || resp.Filters != sc.Filters() || resp.Parsers != sc.Parsers() {
+			t.Errorf("Expected rendered config to match, got %+v", resp)
+		}
+		if resp.LastPatch == nil || resp.LastPatch.Error != "patch failed" {
+			t.Errorf("Expected failed last patch, got %+v", resp.LastPatch)
+		}
+
+		var sources [][]string
+		for _, s := range resp.Sections {
+			sources = append(sources, s.Sources)
+		}
+		expected := [][]string{
+			{"LogSink ns1/sink-a"},
+			{"LogSink ns2/sink-b"},
+			{"ClusterLogSink cluster-sink"},
+			{"LogSink ns1/sink-a"},
+			{"LogParser ns3/unused"},
+		}
+		if diff := cmp.Diff(expected, sources); diff != "" {
+			t.Errorf("Sources not equal (-want, +got) = %v", diff)
+		}
+	})
+
+	t.Run("it only serves sections from the requested namespace", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		sink.NewDebugHandler(sc).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/config?namespace=ns2", nil))
+
+		var resp struct {
+			Namespace string         `json:"namespace"`
+			Sections  []sink.Section `json:"sections"`
+		}
+		err := json.NewDecoder(rec.Body).Decode(&resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []sink.Section{
+			{
+				Kind:      "output",
+				Namespace: "ns2",
+				Sources:   []string{"LogSink ns2/sink-b"},
+				Config: `
+[OUTPUT]
+    Name http
+    Match *_ns2_*
+    Format json
+    Host example.com
+    Port 443
+    URI /some/path
+    tls On
+
+`,
+			},
+		}
+		if diff := cmp.Diff(expected, resp.Sections); diff != "" {
+			t.Errorf("Sections not equal (-want, +got) = %v", diff)
+		}
+	})
+
+	t.Run("it serves the parser sections rendered into the parsers", func(t *testing.T) {
+		sc := sink.NewConfig()
+		sc.UpsertParser(&v1alpha1.LogParser{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "access",
+				Namespace: "ns1",
+			},
+			Spec: v1alpha1.LogParserSpec{
+				Format: "json",
+			},
+		})
+		sc.UpsertSink(&v1alpha1.LogSink{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "sink-a",
+				Namespace: "ns1",
+			},
+			Spec: v1alpha1.SinkSpec{
+				Type: "syslog",
+				Multiline: &v1alpha1.MultilineSpec{
+					StartRegex: `/^\d{4}-\d{2}-\d{2}/`,
+				},
+			},
+		})
+
+		var parsers string
+		for _, s := range sc.Sections() {
+			if s.Kind == "parser" {
+				parsers += s.Config
+			}
+		}
+		if diff := cmp.Diff(sc.Parsers(), parsers); diff != "" {
+			t.Errorf("Parsers not equal (-want, +got) = %v", diff)
+		}
+	})
+}
+
+type errConfigMapPatcher struct{}
+
+func (s *errConfigMapPatcher) Patch(
+	name string,
+	pt types.PatchType,
+	data []byte,
+	subresources ...string,
+) (*coreV1.ConfigMap, error) {
+	return nil, errors.New("patch failed")
+}
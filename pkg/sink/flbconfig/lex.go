@@ -167,7 +167,7 @@ func LexSection(l *Lexer) StateFunc {
 		}
 
 		next := l.PeekNext()
-		if !unicode.IsLetter(next) && !unicode.IsNumber(next) {
+		if !unicode.IsLetter(next) && !unicode.IsNumber(next) && next != '_' {
 			switch next {
 			case RuneRightBracket:
 				l.Emit(TokenSection)
@@ -194,7 +194,7 @@ func LexKey(l *Lexer) StateFunc {
 		}
 
 		next := l.PeekNext()
-		if !unicode.IsLetter(next) && !unicode.IsNumber(next) && next != '.' {
+		if !unicode.IsLetter(next) && !unicode.IsNumber(next) && next != '.' && next != '_' {
 			switch next {
 			case RuneTab, RuneSpace:
 				l.Emit(TokenKey)
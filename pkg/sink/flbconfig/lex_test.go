@@ -79,6 +79,49 @@ key [{"some": "json"}]
 				},
 			},
 		},
+		"underscores": {
+			input: `
+[MULTILINE_PARSER]
+flush_timeout 1000
+`,
+			expectedTokens: []flbconfig.Token{
+				{
+					Type:  flbconfig.TokenNewLine,
+					Value: "\n",
+				},
+				{
+					Type:  flbconfig.TokenLeftBracket,
+					Value: "[",
+				},
+				{
+					Type:  flbconfig.TokenSection,
+					Value: "MULTILINE_PARSER",
+				},
+				{
+					Type:  flbconfig.TokenRightBracket,
+					Value: "]",
+				},
+				{
+					Type:  flbconfig.TokenNewLine,
+					Value: "\n",
+				},
+				{
+					Type:  flbconfig.TokenKey,
+					Value: "flush_timeout",
+				},
+				{
+					Type:  flbconfig.TokenValue,
+					Value: "1000",
+				},
+				{
+					Type:  flbconfig.TokenNewLine,
+					Value: "\n",
+				},
+				{
+					Type: flbconfig.TokenEOF,
+				},
+			},
+		},
 		"extra whitespace": {
 			input: `
 				[section]
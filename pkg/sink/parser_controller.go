@@ -0,0 +1,72 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sink
+
+import (
+	"reflect"
+
+	"github.com/knative/observability/pkg/apis/sink/v1alpha1"
+)
+
+type ParserController struct {
+	cmp ConfigMapPatcher
+	dsp DaemonSetPodDeleter
+	sc  *Config
+}
+
+func NewParserController(cmp ConfigMapPatcher, dsp DaemonSetPodDeleter, sc *Config) *ParserController {
+	return &ParserController{
+		cmp: cmp,
+		dsp: dsp,
+		sc:  sc,
+	}
+}
+
+func (c *ParserController) OnAdd(o interface{}) {
+	p, ok := o.(*v1alpha1.LogParser)
+	if !ok {
+		return
+	}
+
+	c.sc.UpsertParser(p)
+
+	c.sc.recordPatch(patchConfig(configPatches(c.sc), c.cmp, c.dsp))
+}
+
+func (c *ParserController) OnDelete(o interface{}) {
+	p, ok := o.(*v1alpha1.LogParser)
+	if !ok {
+		return
+	}
+
+	c.sc.DeleteParser(p)
+
+	c.sc.recordPatch(patchConfig(configPatches(c.sc), c.cmp, c.dsp))
+}
+
+func (c *ParserController) OnUpdate(old, new interface{}) {
+	o, ok := old.(*v1alpha1.LogParser)
+	if !ok {
+		return
+	}
+	n, ok := new.(*v1alpha1.LogParser)
+	if !ok {
+		return
+	}
+	if !reflect.DeepEqual(o.Spec, n.Spec) {
+		c.OnAdd(new)
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sink_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/knative/observability/pkg/apis/sink/v1alpha1"
+	"github.com/knative/observability/pkg/sink"
+)
+
+func TestLogParserController(t *testing.T) {
+	parser := &v1alpha1.LogParser{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "test-ns",
+			Name:      "access",
+		},
+		Spec: v1alpha1.LogParserSpec{
+			Format: "json",
+		},
+	}
+	logSink := &v1alpha1.LogSink{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "test-ns",
+			Name:      "some-sink",
+		},
+		Spec: v1alpha1.SinkSpec{
+			Type:   "syslog",
+			Parser: "access",
+			SyslogSpec: v1alpha1.SyslogSpec{
+				Host: "example.com",
+				Port: 12345,
+			},
+		},
+	}
+	parserFilter := `
+[FILTER]
+    Name parser
+    Match kube.*_test-ns_*
+    Key_Name log
+    Parser test-ns.access
+    Reserve_Data On
+`
+
+	t.Run("it patches the parser and filters for referencing log sinks", func(t *testing.T) {
+		spyConfigMapPatcher := &spyConfigMapPatcher{}
+		spyDaemonSetPodDeleter := &spyDaemonSetPodDeleter{}
+		sc := sink.NewConfig()
+		sc.UpsertSink(logSink)
+		c := sink.NewParserController(
+			spyConfigMapPatcher,
+			spyDaemonSetPodDeleter,
+			sc,
+		)
+
+		c.OnAdd(parser)
+		c.OnDelete(parser)
+
+		spyConfigMapPatcher.expectPatches([]spyPatch{
+			{
+				Path:  "/data/namespace-filters.conf",
+				Value: parserFilter,
+			},
+			{
+				Path:  "/data/namespace-filters.conf",
+				Value: "",
+			},
+		}, t)
+
+		var patches []jsonPatch
+		err := json.Unmarshal(spyConfigMapPatcher.patches[0].data, &patches)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, _ := findPatch(patches, "/data/namespace-parsers.conf")
+		if !strings.Contains(p.Value, "Name test-ns.access") {
+			t.Errorf("Expected parsers to contain test-ns.access, got: %s", p.Value)
+		}
+
+		if spyDaemonSetPodDeleter.Selector != "app=fluent-bit" {
+			t.Errorf("DaemonSet PodDeleter not equal: Expected: %s, Actual: %s", spyDaemonSetPodDeleter.Selector, "app=fluent-bit")
+		}
+	})
+
+	t.Run("it does not patch when the parser spec has not changed", func(t *testing.T) {
+		spyConfigMapPatcher := &spyConfigMapPatcher{}
+		c := sink.NewParserController(
+			spyConfigMapPatcher,
+			&spyDaemonSetPodDeleter{},
+			sink.NewConfig(),
+		)
+
+		n := parser.DeepCopy()
+		n.Labels = map[string]string{"some": "label"}
+		c.OnUpdate(parser, n)
+
+		if spyConfigMapPatcher.patchCalled {
+			t.Error("Expected patch to not be called")
+		}
+	})
+
+	t.Run("it should not panic if it receives a non log parser type", func(t *testing.T) {
+		c := sink.NewParserController(
+			&spyConfigMapPatcher{},
+			&spyDaemonSetPodDeleter{},
+			sink.NewConfig(),
+		)
+
+		//Shouldn't Panic
+		c.OnAdd("")
+		c.OnDelete(1)
+		c.OnUpdate(nil, nil)
+	})
+}
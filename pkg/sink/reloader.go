@@ -0,0 +1,387 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sink
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	coreV1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ConfigHashAnnotation is set on each fluent-bit pod to the hash of the
+// ConfigMap data it has loaded.
+const ConfigHashAnnotation = "observability.knative.dev/config-hash"
+
+type ConfigMapGetter interface {
+	Get(name string, options metav1.GetOptions) (*coreV1.ConfigMap, error)
+}
+
+type DaemonSetPodClient interface {
+	List(opts metav1.ListOptions) (*coreV1.PodList, error)
+	Patch(
+		name string,
+		pt types.PatchType,
+		data []byte,
+		subresources ...string,
+	) (*coreV1.Pod, error)
+	Delete(name string, options *metav1.DeleteOptions) error
+}
+
+type PodReloaderOpt func(*PodReloader)
+
+// PodReloader is a DaemonSetPodDeleter that reloads fluent-bit in place
+// through its HTTP API instead of deleting the pods. Each pod is reloaded
+// once the config-hash sidecar reports that the kubelet has synced the
+// ConfigMap into the pod. Pods that fail to reload are restarted one at a
+// time.
+type PodReloader struct {
+	cmg  ConfigMapGetter
+	pods DaemonSetPodClient
+
+	client         *http.Client
+	port           int
+	hashPort       int
+	syncDelay      time.Duration
+	syncTimeout    time.Duration
+	restartTimeout time.Duration
+
+	mu    sync.Mutex
+	timer *time.Timer
+
+	reloadMu sync.Mutex
+}
+
+func NewPodReloader(cmg ConfigMapGetter, pods DaemonSetPodClient, opts ...PodReloaderOpt) *PodReloader {
+	r := &PodReloader{
+		cmg:            cmg,
+		pods:           pods,
+		client:         &http.Client{Timeout: 10 * time.Second},
+		port:           2020,
+		hashPort:       2021,
+		syncDelay:      5 * time.Second,
+		syncTimeout:    2 * time.Minute,
+		restartTimeout: 2 * time.Minute,
+	}
+
+	for _, o := range opts {
+		o(r)
+	}
+
+	return r
+}
+
+// WithReloadPort sets the port of the fluent-bit HTTP server.
+func WithReloadPort(port int) PodReloaderOpt {
+	return func(r *PodReloader) {
+		r.port = port
+	}
+}
+
+// WithHashPort sets the port of the config-hash sidecar.
+func WithHashPort(port int) PodReloaderOpt {
+	return func(r *PodReloader) {
+		r.hashPort = port
+	}
+}
+
+// WithSyncDelay sets how long to wait after a ConfigMap patch before
+// reloading, so patches arriving together are reloaded once.
+func WithSyncDelay(d time.Duration) PodReloaderOpt {
+	return func(r *PodReloader) {
+		r.syncDelay = d
+	}
+}
+
+// WithSyncTimeout sets how long to wait for the kubelet to sync the
+// ConfigMap into a pod. Pods are reloaded with the config they have
+// mounted once it expires.
+func WithSyncTimeout(d time.Duration) PodReloaderOpt {
+	return func(r *PodReloader) {
+		r.syncTimeout = d
+	}
+}
+
+// WithRestartTimeout sets how long to wait for a restarted pod to become
+// ready before restarting the next one.
+func WithRestartTimeout(d time.Duration) PodReloaderOpt {
+	return func(r *PodReloader) {
+		r.restartTimeout = d
+	}
+}
+
+// DeleteCollection schedules a reload of the pods matching the label
+// selector. Patches arriving within the sync delay are coalesced into a
+// single reload.
+func (r *PodReloader) DeleteCollection(
+	_ *metav1.DeleteOptions,
+	listOptions metav1.ListOptions,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	r.timer = time.AfterFunc(r.syncDelay, func() {
+		r.reload(listOptions.LabelSelector)
+	})
+
+	return nil
+}
+
+func (r *PodReloader) reload(selector string) {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+
+	cm, err := r.cmg.Get(ConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("Unable to get config map: %s", err)
+		return
+	}
+	hash := configHash(cm.Data)
+
+	pods, err := r.pods.List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		log.Printf("Unable to list pods: %s", err)
+		return
+	}
+
+	var failed []coreV1.Pod
+	for _, p := range pods.Items {
+		if p.Status.Phase != coreV1.PodRunning || p.Status.PodIP == "" {
+			// Pods that are not running yet will load the latest config
+			// when they start.
+			continue
+		}
+
+		mounted, err := r.waitForSync(p, hash)
+		if err != nil {
+			log.Printf("Unable to get mounted config hash of pod %s, restarting: %s", p.Name, err)
+			failed = append(failed, p)
+			continue
+		}
+		if mounted != hash {
+			log.Printf("Timed out waiting for pod %s to sync config, reloading the mounted config", p.Name)
+		}
+
+		err = r.reloadPod(p)
+		if err != nil {
+			log.Printf("Unable to reload pod %s, restarting: %s", p.Name, err)
+			failed = append(failed, p)
+			continue
+		}
+		r.reportHash(p.Name, mounted)
+	}
+
+	for _, p := range failed {
+		r.restartPod(p, selector)
+	}
+}
+
+// waitForSync polls the config-hash sidecar of a pod until the mounted
+// config has the given hash or the sync timeout expires. It returns the
+// hash of the mounted config.
+func (r *PodReloader) waitForSync(p coreV1.Pod, hash string) (string, error) {
+	deadline := time.Now().Add(r.syncTimeout)
+	for {
+		mounted, err := r.mountedHash(p)
+		if err != nil || mounted == hash || !time.Now().Before(deadline) {
+			return mounted, err
+		}
+
+		time.Sleep(time.Second)
+	}
+}
+
+func (r *PodReloader) mountedHash(p coreV1.Pod) (string, error) {
+	resp, err := r.client.Get(fmt.Sprintf("http://%s:%d/", p.Status.PodIP, r.hashPort))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+type reloadResponse struct {
+	Reload string `json:"reload"`
+	Status int    `json:"status"`
+}
+
+func (r *PodReloader) reloadPod(p coreV1.Pod) error {
+	resp, err := r.client.Post(
+		fmt.Sprintf("http://%s:%d/api/v2/reload", p.Status.PodIP, r.port),
+		"application/json",
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	var rr reloadResponse
+	err = json.NewDecoder(resp.Body).Decode(&rr)
+	if err != nil {
+		return err
+	}
+	if rr.Status != 0 {
+		return fmt.Errorf("reload failed with status %d", rr.Status)
+	}
+
+	return nil
+}
+
+// restartPod deletes a pod and reports the config hash loaded by its
+// replacement, which loads the config mounted when it starts.
+func (r *PodReloader) restartPod(p coreV1.Pod, selector string) {
+	err := r.pods.Delete(p.Name, &metav1.DeleteOptions{})
+	if err != nil {
+		log.Printf("Unable to delete pod %s: %s", p.Name, err)
+		return
+	}
+
+	deadline := time.Now().Add(r.restartTimeout)
+	for time.Now().Before(deadline) {
+		pods, err := r.pods.List(metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			log.Printf("Unable to list pods: %s", err)
+			return
+		}
+
+		for _, np := range pods.Items {
+			if np.Spec.NodeName == p.Spec.NodeName && np.UID != p.UID && podReady(np) {
+				mounted, err := r.mountedHash(np)
+				if err != nil {
+					log.Printf("Unable to get mounted config hash of pod %s: %s", np.Name, err)
+					return
+				}
+				r.reportHash(np.Name, mounted)
+				return
+			}
+		}
+
+		time.Sleep(time.Second)
+	}
+
+	log.Printf("Timed out waiting for pod on node %s to restart", p.Spec.NodeName)
+}
+
+func (r *PodReloader) reportHash(name, hash string) {
+	data, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				ConfigHashAnnotation: hash,
+			},
+		},
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+
+	_, err = r.pods.Patch(name, types.MergePatchType, data)
+	if err != nil {
+		log.Printf("Unable to annotate pod %s: %s", name, err)
+	}
+}
+
+// NewConfigHashHandler serves the hash of the ConfigMap mounted at dir.
+// It runs in a sidecar of each fluent-bit pod so the sink-controller knows
+// when the kubelet has synced a patched ConfigMap into the pod.
+func NewConfigHashHandler(dir string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hash, err := mountedConfigHash(dir)
+		if err != nil {
+			log.Printf("Unable to hash config: %s", err)
+			http.Error(w, "unable to hash config", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintln(w, hash)
+	})
+}
+
+// mountedConfigHash hashes the keys of a ConfigMap volume the same way as
+// the ConfigMap data. The kubelet keeps the data in hidden directories
+// starting with .. and links each key to them.
+func mountedConfigHash(dir string) (string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	data := make(map[string]string, len(files))
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), "..") {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return "", err
+		}
+		data[f.Name()] = string(b)
+	}
+
+	return configHash(data), nil
+}
+
+func podReady(p coreV1.Pod) bool {
+	for _, c := range p.Status.Conditions {
+		if c.Type == coreV1.PodReady {
+			return c.Status == coreV1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func configHash(data map[string]string) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s\x00%s\x00", k, data[k])
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
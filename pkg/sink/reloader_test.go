@@ -0,0 +1,387 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sink_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	coreV1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/knative/observability/pkg/sink"
+)
+
+func TestPodReloader(t *testing.T) {
+	t.Run("it reloads running pods and reports the config hash", func(t *testing.T) {
+		port, reloads := startFluentBit(t, `{"reload":"done","status":0}`)
+		dir := configDir(t, map[string]string{"outputs.conf": "a"})
+		hashPort, mountedHash := startConfigHash(t, dir)
+		pods := &spyPodClient{
+			pods: []coreV1.Pod{
+				fluentBitPod("fluent-bit-a", "node-a", coreV1.PodRunning),
+				fluentBitPod("fluent-bit-b", "node-b", coreV1.PodPending),
+			},
+		}
+		r := sink.NewPodReloader(
+			&stubConfigMapGetter{data: map[string]string{"outputs.conf": "a"}},
+			pods,
+			sink.WithReloadPort(port),
+			sink.WithHashPort(hashPort),
+			sink.WithSyncDelay(time.Millisecond),
+		)
+
+		err := r.DeleteCollection(nil, metav1.ListOptions{LabelSelector: "app=fluent-bit"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		annotations := pods.waitForAnnotations(t, 1)
+		hash, ok := annotations["fluent-bit-a"]
+		if !ok || hash != mountedHash() {
+			t.Errorf("Expected fluent-bit-a to be annotated with %s, got %v", mountedHash(), annotations)
+		}
+		if pods.selector() != "app=fluent-bit" {
+			t.Errorf("Expected selector app=fluent-bit, got %s", pods.selector())
+		}
+		if n := reloads(); n != 1 {
+			t.Errorf("Expected 1 reload, got %d", n)
+		}
+		if len(pods.deletedPods()) != 0 {
+			t.Errorf("Expected no pods to be deleted, got %v", pods.deletedPods())
+		}
+	})
+
+	t.Run("it waits for the pod to sync the config before reloading", func(t *testing.T) {
+		port, reloads := startFluentBit(t, `{"reload":"done","status":0}`)
+		dir := configDir(t, map[string]string{"outputs.conf": "old"})
+		hashPort, mountedHash := startConfigHash(t, dir)
+		pods := &spyPodClient{
+			pods: []coreV1.Pod{
+				fluentBitPod("fluent-bit-a", "node-a", coreV1.PodRunning),
+			},
+		}
+		r := sink.NewPodReloader(
+			&stubConfigMapGetter{data: map[string]string{"outputs.conf": "new"}},
+			pods,
+			sink.WithReloadPort(port),
+			sink.WithHashPort(hashPort),
+			sink.WithSyncDelay(time.Millisecond),
+			sink.WithSyncTimeout(time.Minute),
+		)
+
+		_ = r.DeleteCollection(nil, metav1.ListOptions{LabelSelector: "app=fluent-bit"})
+
+		time.Sleep(200 * time.Millisecond)
+		if n := reloads(); n != 0 {
+			t.Fatalf("Expected no reload before the config is synced, got %d", n)
+		}
+
+		writeConfig(t, dir, map[string]string{"outputs.conf": "new"})
+		annotations := pods.waitForAnnotations(t, 1)
+		if annotations["fluent-bit-a"] != mountedHash() {
+			t.Errorf("Expected fluent-bit-a to be annotated with %s, got %v", mountedHash(), annotations)
+		}
+		if n := reloads(); n != 1 {
+			t.Errorf("Expected 1 reload, got %d", n)
+		}
+	})
+
+	t.Run("it reports the mounted config when the sync times out", func(t *testing.T) {
+		port, reloads := startFluentBit(t, `{"reload":"done","status":0}`)
+		dir := configDir(t, map[string]string{"outputs.conf": "old"})
+		hashPort, mountedHash := startConfigHash(t, dir)
+		pods := &spyPodClient{
+			pods: []coreV1.Pod{
+				fluentBitPod("fluent-bit-a", "node-a", coreV1.PodRunning),
+			},
+		}
+		r := sink.NewPodReloader(
+			&stubConfigMapGetter{data: map[string]string{"outputs.conf": "new"}},
+			pods,
+			sink.WithReloadPort(port),
+			sink.WithHashPort(hashPort),
+			sink.WithSyncDelay(time.Millisecond),
+			sink.WithSyncTimeout(time.Millisecond),
+		)
+
+		_ = r.DeleteCollection(nil, metav1.ListOptions{LabelSelector: "app=fluent-bit"})
+
+		annotations := pods.waitForAnnotations(t, 1)
+		if annotations["fluent-bit-a"] != mountedHash() {
+			t.Errorf("Expected fluent-bit-a to be annotated with the mounted hash %s, got %v", mountedHash(), annotations)
+		}
+		if n := reloads(); n != 1 {
+			t.Errorf("Expected 1 reload, got %d", n)
+		}
+	})
+
+	t.Run("it coalesces patches within the sync delay", func(t *testing.T) {
+		port, reloads := startFluentBit(t, `{"reload":"done","status":0}`)
+		hashPort, _ := startConfigHash(t, configDir(t, nil))
+		pods := &spyPodClient{
+			pods: []coreV1.Pod{
+				fluentBitPod("fluent-bit-a", "node-a", coreV1.PodRunning),
+			},
+		}
+		r := sink.NewPodReloader(
+			&stubConfigMapGetter{},
+			pods,
+			sink.WithReloadPort(port),
+			sink.WithHashPort(hashPort),
+			sink.WithSyncDelay(50*time.Millisecond),
+		)
+
+		for i := 0; i < 5; i++ {
+			_ = r.DeleteCollection(nil, metav1.ListOptions{LabelSelector: "app=fluent-bit"})
+		}
+
+		pods.waitForAnnotations(t, 1)
+		time.Sleep(100 * time.Millisecond)
+		if n := reloads(); n != 1 {
+			t.Errorf("Expected 1 reload, got %d", n)
+		}
+	})
+
+	t.Run("it restarts pods that fail to reload", func(t *testing.T) {
+		port, _ := startFluentBit(t, `{"reload":"failed","status":-1}`)
+		hashPort, _ := startConfigHash(t, configDir(t, nil))
+		pods := &spyPodClient{
+			pods: []coreV1.Pod{
+				fluentBitPod("fluent-bit-a", "node-a", coreV1.PodRunning),
+			},
+			replacement: fluentBitPod("fluent-bit-c", "node-a", coreV1.PodRunning),
+		}
+		r := sink.NewPodReloader(
+			&stubConfigMapGetter{},
+			pods,
+			sink.WithReloadPort(port),
+			sink.WithHashPort(hashPort),
+			sink.WithSyncDelay(time.Millisecond),
+			sink.WithRestartTimeout(5*time.Second),
+		)
+
+		_ = r.DeleteCollection(nil, metav1.ListOptions{LabelSelector: "app=fluent-bit"})
+
+		annotations := pods.waitForAnnotations(t, 1)
+		if _, ok := annotations["fluent-bit-c"]; !ok {
+			t.Errorf("Expected replacement pod to be annotated, got %v", annotations)
+		}
+		deleted := pods.deletedPods()
+		if len(deleted) != 1 || deleted[0] != "fluent-bit-a" {
+			t.Errorf("Expected fluent-bit-a to be deleted, got %v", deleted)
+		}
+	})
+}
+
+func startFluentBit(t *testing.T, body string) (int, func() int) {
+	var (
+		mu      sync.Mutex
+		reloads int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v2/reload" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		mu.Lock()
+		reloads++
+		mu.Unlock()
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+
+	_, p, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return port, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return reloads
+	}
+}
+
+// startConfigHash serves the hash of dir like the config-hash sidecar. It
+// returns the port and a function returning the current hash.
+func startConfigHash(t *testing.T, dir string) (int, func() string) {
+	h := sink.NewConfigHashHandler(dir)
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	_, p, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return port, func() string {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return strings.TrimSpace(rec.Body.String())
+	}
+}
+
+// configDir lays out data like a ConfigMap volume, with each key linked to
+// a hidden data directory.
+func configDir(t *testing.T, data map[string]string) string {
+	dir := t.TempDir()
+	writeConfig(t, dir, data)
+	return dir
+}
+
+func writeConfig(t *testing.T, dir string, data map[string]string) {
+	dataDir, err := ioutil.TempDir(dir, "..data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range data {
+		if err := ioutil.WriteFile(filepath.Join(dataDir, k), []byte(v), 0644); err != nil {
+			t.Fatal(err)
+		}
+		link := filepath.Join(dir, k)
+		os.Remove(link)
+		if err := os.Symlink(filepath.Join(dataDir, k), link); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func fluentBitPod(name, node string, phase coreV1.PodPhase) coreV1.Pod {
+	return coreV1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			UID:  types.UID(name),
+		},
+		Spec: coreV1.PodSpec{
+			NodeName: node,
+		},
+		Status: coreV1.PodStatus{
+			Phase: phase,
+			PodIP: "127.0.0.1",
+			Conditions: []coreV1.PodCondition{
+				{Type: coreV1.PodReady, Status: coreV1.ConditionTrue},
+			},
+		},
+	}
+}
+
+type stubConfigMapGetter struct {
+	data map[string]string
+}
+
+func (s *stubConfigMapGetter) Get(name string, options metav1.GetOptions) (*coreV1.ConfigMap, error) {
+	return &coreV1.ConfigMap{Data: s.data}, nil
+}
+
+type spyPodClient struct {
+	mu          sync.Mutex
+	pods        []coreV1.Pod
+	replacement coreV1.Pod
+	listOpts    metav1.ListOptions
+	deleted     []string
+	annotations map[string]string
+}
+
+func (s *spyPodClient) List(opts metav1.ListOptions) (*coreV1.PodList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listOpts = opts
+	return &coreV1.PodList{Items: append([]coreV1.Pod(nil), s.pods...)}, nil
+}
+
+func (s *spyPodClient) Patch(
+	name string,
+	pt types.PatchType,
+	data []byte,
+	subresources ...string,
+) (*coreV1.Pod, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var p coreV1.Pod
+	err := json.Unmarshal(data, &p)
+	if err != nil {
+		return nil, err
+	}
+	if s.annotations == nil {
+		s.annotations = make(map[string]string)
+	}
+	s.annotations[name] = p.Annotations[sink.ConfigHashAnnotation]
+	return &p, nil
+}
+
+func (s *spyPodClient) Delete(name string, options *metav1.DeleteOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleted = append(s.deleted, name)
+
+	var pods []coreV1.Pod
+	for _, p := range s.pods {
+		if p.Name != name {
+			pods = append(pods, p)
+		}
+	}
+	s.pods = append(pods, s.replacement)
+	return nil
+}
+
+func (s *spyPodClient) waitForAnnotations(t *testing.T, n int) map[string]string {
+	for i := 0; i < 200; i++ {
+		s.mu.Lock()
+		if len(s.annotations) >= n {
+			a := s.annotations
+			s.mu.Unlock()
+			return a
+		}
+		s.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %d annotations", n)
+	return nil
+}
+
+func (s *spyPodClient) selector() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listOpts.LabelSelector
+}
+
+func (s *spyPodClient) deletedPods() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deleted
+}
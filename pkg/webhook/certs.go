@@ -0,0 +1,558 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Keys of the serving certificate Secret. The CA bundle holds every CA that
+// replicas may serve a certificate from: the CA signing the current
+// certificate, the CA replacing it during a rotation and previous CAs that
+// have not expired. A new CA is published in the bundle before it signs the
+// serving certificate, and previous CAs stay in it, so clients trust
+// replicas that have not loaded the current certificate yet.
+const (
+	SecretCABundleKey  = "ca.crt"
+	SecretCAKeyKey     = "ca.key"
+	SecretNextCAKeyKey = "next-ca.key"
+	SecretCertKey      = corev1.TLSCertKey
+	SecretKeyKey       = corev1.TLSPrivateKeyKey
+)
+
+var errNoCertificate = errors.New("serving certificate not loaded")
+
+// SecretClient is the subset of the Secrets client used to store the serving
+// certificates.
+type SecretClient interface {
+	Get(name string, options metav1.GetOptions) (*corev1.Secret, error)
+	Create(*corev1.Secret) (*corev1.Secret, error)
+	Update(*corev1.Secret) (*corev1.Secret, error)
+}
+
+// WebhookConfigClient is a dynamic client for validating or mutating webhook
+// configurations.
+type WebhookConfigClient interface {
+	Get(name string, options metav1.GetOptions, subresources ...string) (*unstructured.Unstructured, error)
+	Patch(name string, pt types.PatchType, data []byte, options metav1.UpdateOptions, subresources ...string) (*unstructured.Unstructured, error)
+}
+
+// WebhookConfig names a webhook configuration whose caBundle is kept in sync
+// with the serving CA.
+type WebhookConfig struct {
+	Client WebhookConfigClient
+	Name   string
+}
+
+type CertManagerOpt func(*CertManager)
+
+// CertManager generates the serving CA and certificate of the validator,
+// keeps them in a Secret shared by all replicas, rotates them before they
+// expire and publishes the CA to the webhook configurations.
+type CertManager struct {
+	secrets    SecretClient
+	secretName string
+	dnsNames   []string
+	webhooks   []WebhookConfig
+
+	caValidity   time.Duration
+	certValidity time.Duration
+	rotateBefore time.Duration
+	now          func() time.Time
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// NewCertManager creates a CertManager for the certificate of the named
+// service. It serves nothing until the first successful Sync.
+func NewCertManager(secrets SecretClient, secretName, service, namespace string, opts ...CertManagerOpt) *CertManager {
+	m := &CertManager{
+		secrets:    secrets,
+		secretName: secretName,
+		dnsNames: []string{
+			service,
+			fmt.Sprintf("%s.%s", service, namespace),
+			fmt.Sprintf("%s.%s.svc", service, namespace),
+			fmt.Sprintf("%s.%s.svc.cluster.local", service, namespace),
+		},
+		caValidity:   10 * 365 * 24 * time.Hour,
+		certValidity: 365 * 24 * time.Hour,
+		rotateBefore: 30 * 24 * time.Hour,
+		now:          time.Now,
+	}
+
+	for _, o := range opts {
+		o(m)
+	}
+
+	return m
+}
+
+// WithWebhookConfigs sets the webhook configurations to patch the caBundle
+// of.
+func WithWebhookConfigs(configs ...WebhookConfig) CertManagerOpt {
+	return func(m *CertManager) {
+		m.webhooks = configs
+	}
+}
+
+// WithCertValidity sets how long generated CAs and serving certificates are
+// valid for.
+func WithCertValidity(ca, cert time.Duration) CertManagerOpt {
+	return func(m *CertManager) {
+		m.caValidity = ca
+		m.certValidity = cert
+	}
+}
+
+// WithRotateBefore sets how long before expiry certificates are replaced.
+func WithRotateBefore(d time.Duration) CertManagerOpt {
+	return func(m *CertManager) {
+		m.rotateBefore = d
+	}
+}
+
+// WithClock overrides the time used to check expiry.
+func WithClock(now func() time.Time) CertManagerOpt {
+	return func(m *CertManager) {
+		m.now = now
+	}
+}
+
+// GetCertificate serves the current certificate. It is used as
+// tls.Config.GetCertificate so rotated certificates are served without a
+// restart.
+func (m *CertManager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.cert == nil {
+		return nil, errNoCertificate
+	}
+	return m.cert, nil
+}
+
+// Run syncs every interval until stopCh is closed.
+func (m *CertManager) Run(interval time.Duration, stopCh <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if err := m.Sync(); err != nil {
+				log.Printf("Unable to sync serving certificate: %s", err)
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// Sync loads the certificates from the Secret, replaces any that are
+// missing, invalid or about to expire, and patches the CA bundle into the
+// webhook configurations. Another replica writing the Secret at the same
+// time is resolved by reading its result.
+func (m *CertManager) Sync() error {
+	var err error
+	for i := 0; i < 3; i++ {
+		err = m.sync()
+		if !k8serrors.IsConflict(err) && !k8serrors.IsAlreadyExists(err) {
+			break
+		}
+	}
+	return err
+}
+
+func (m *CertManager) sync() error {
+	secret, err := m.secrets.Get(m.secretName, metav1.GetOptions{})
+	exists := true
+	if k8serrors.IsNotFound(err) {
+		exists = false
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: m.secretName},
+		}
+	} else if err != nil {
+		return err
+	}
+
+	published, err := m.published(secret.Data[SecretCABundleKey])
+	if err != nil {
+		return err
+	}
+
+	data, changed, err := m.ensureCerts(secret.Data, published)
+	if err != nil {
+		return err
+	}
+
+	if changed {
+		secret = secret.DeepCopy()
+		secret.Type = corev1.SecretTypeOpaque
+		secret.Data = data
+		if exists {
+			_, err = m.secrets.Update(secret)
+		} else {
+			_, err = m.secrets.Create(secret)
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("Stored new serving certificate in secret %s", m.secretName)
+	}
+
+	cert, err := tls.X509KeyPair(data[SecretCertKey], data[SecretKeyKey])
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.cert = &cert
+	m.mu.Unlock()
+
+	for _, wc := range m.webhooks {
+		if err := patchCABundle(wc, data[SecretCABundleKey]); err != nil {
+			return fmt.Errorf("patching %s: %s", wc.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// ensureCerts returns the Secret data with a valid CA and serving
+// certificate, and whether it differs from data. A CA about to expire is
+// rotated in two phases: a sync adds the next CA to the bundle, and a later
+// sync, once that bundle is published to the webhook configurations, signs
+// the serving certificate with it. Without any usable CA there is nothing
+// to keep trusted, so a new CA signs the certificate right away.
+func (m *CertManager) ensureCerts(data map[string][]byte, published bool) (map[string][]byte, bool, error) {
+	now := m.now()
+	renewBy := now.Add(m.rotateBefore)
+
+	bundle := data[SecretCABundleKey]
+	caKeyPEM := data[SecretCAKeyKey]
+	nextKeyPEM := data[SecretNextCAKeyKey]
+	ca, caKey, caErr := findCA(bundle, caKeyPEM, now)
+	next, nextKey, nextErr := findCA(bundle, nextKeyPEM, now)
+
+	changed := false
+	switch {
+	case nextErr == nil && (published || caErr != nil):
+		ca, caKey, caKeyPEM, nextKeyPEM = next, nextKey, nextKeyPEM, nil
+		changed = true
+	case caErr != nil:
+		var err error
+		ca, caKey, err = m.newCA(now)
+		if err != nil {
+			return nil, false, err
+		}
+		caKeyPEM, err = encodeKey(caKey)
+		if err != nil {
+			return nil, false, err
+		}
+		bundle = append(encodeCert(ca.Raw), unexpiredCerts(bundle, now)...)
+		nextKeyPEM = nil
+		changed = true
+	case nextErr != nil && ca.NotAfter.Before(renewBy):
+		next, nextKey, err := m.newCA(now)
+		if err != nil {
+			return nil, false, err
+		}
+		nextKeyPEM, err = encodeKey(nextKey)
+		if err != nil {
+			return nil, false, err
+		}
+		bundle = append(encodeCert(next.Raw), unexpiredCerts(bundle, now)...)
+		changed = true
+	}
+
+	certPEM, keyPEM := data[SecretCertKey], data[SecretKeyKey]
+	cert, _, certErr := parseKeyPair(certPEM, keyPEM)
+	if certErr != nil ||
+		cert.NotAfter.Before(renewBy) ||
+		cert.CheckSignatureFrom(ca) != nil ||
+		!sameNames(cert.DNSNames, m.dnsNames) {
+		var err error
+		certPEM, keyPEM, err = m.newServingCert(now, ca, caKey)
+		if err != nil {
+			return nil, false, err
+		}
+		changed = true
+	}
+	if !changed {
+		return data, false, nil
+	}
+
+	result := map[string][]byte{
+		SecretCABundleKey: bundle,
+		SecretCAKeyKey:    caKeyPEM,
+		SecretCertKey:     certPEM,
+		SecretKeyKey:      keyPEM,
+	}
+	if nextKeyPEM != nil {
+		result[SecretNextCAKeyKey] = nextKeyPEM
+	}
+	return result, true, nil
+}
+
+// published reports whether every webhook has bundle as its caBundle.
+func (m *CertManager) published(bundle []byte) (bool, error) {
+	if len(bundle) == 0 {
+		return false, nil
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(bundle)
+	for _, wc := range m.webhooks {
+		cfg, err := wc.Client.Get(wc.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		webhooks, _, err := unstructured.NestedSlice(cfg.Object, "webhooks")
+		if err != nil {
+			return false, err
+		}
+		for _, w := range webhooks {
+			wm, ok := w.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			current, _, _ := unstructured.NestedString(wm, "clientConfig", "caBundle")
+			if current != encoded {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+func (m *CertManager) newCA(now time.Time) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "observability-validator-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(m.caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ca, key, nil
+}
+
+func (m *CertManager) newServingCert(now time.Time, ca *x509.Certificate, caKey *ecdsa.PrivateKey) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	notAfter := now.Add(m.certValidity)
+	if notAfter.After(ca.NotAfter) {
+		notAfter = ca.NotAfter
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: m.dnsNames[2]},
+		DNSNames:     m.dnsNames,
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encodeCert(der), keyPEM, nil
+}
+
+// patchCABundle sets the caBundle of every webhook in the configuration if
+// it is not already the bundle.
+func patchCABundle(wc WebhookConfig, bundle []byte) error {
+	cfg, err := wc.Client.Get(wc.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	webhooks, _, err := unstructured.NestedSlice(cfg.Object, "webhooks")
+	if err != nil {
+		return err
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(bundle)
+	var ops []jsonPatchOp
+	for i, w := range webhooks {
+		wm, ok := w.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		current, _, _ := unstructured.NestedString(wm, "clientConfig", "caBundle")
+		if current == encoded {
+			continue
+		}
+		ops = append(ops, jsonPatchOp{
+			Op:    "add",
+			Path:  fmt.Sprintf("/webhooks/%d/clientConfig/caBundle", i),
+			Value: encoded,
+		})
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+
+	patch, err := json.Marshal(ops)
+	if err != nil {
+		return err
+	}
+	_, err = wc.Client.Patch(wc.Name, types.JSONPatchType, patch, metav1.UpdateOptions{})
+	return err
+}
+
+// parseKeyPair returns the first certificate in certPEM and its key.
+func parseKeyPair(certPEM, keyPEM []byte) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, nil, errors.New("no certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	block, _ = pem.Decode(keyPEM)
+	if block == nil {
+		return nil, nil, errors.New("no key")
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !bytes.Equal(cert.RawSubjectPublicKeyInfo, marshalPublicKey(&key.PublicKey)) {
+		return nil, nil, errors.New("key does not match certificate")
+	}
+	return cert, key, nil
+}
+
+// findCA returns the unexpired CA in bundle that belongs to keyPEM.
+func findCA(bundle, keyPEM []byte, now time.Time) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, nil, errors.New("no key")
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pub := marshalPublicKey(&key.PublicKey)
+	for {
+		block, bundle = pem.Decode(bundle)
+		if block == nil {
+			return nil, nil, errors.New("no certificate for key")
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil || !cert.IsCA || cert.NotAfter.Before(now) {
+			continue
+		}
+		if bytes.Equal(cert.RawSubjectPublicKeyInfo, pub) {
+			return cert, key, nil
+		}
+	}
+}
+
+// unexpiredCerts returns the PEM certificates in bundle that are still valid.
+func unexpiredCerts(bundle []byte, now time.Time) []byte {
+	var result []byte
+	for {
+		var block *pem.Block
+		block, bundle = pem.Decode(bundle)
+		if block == nil {
+			return result
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil || cert.NotAfter.Before(now) {
+			continue
+		}
+		result = append(result, pem.EncodeToMemory(block)...)
+	}
+}
+
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func newSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func encodeCert(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+func marshalPublicKey(pub *ecdsa.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil
+	}
+	return der
+}
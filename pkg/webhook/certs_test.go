@@ -0,0 +1,348 @@
+package webhook_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/knative/observability/pkg/webhook"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestCertManager(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	secrets := &spySecretClient{}
+	webhooks := newSpyWebhookConfigClient(2)
+	m := webhook.NewCertManager(
+		secrets,
+		"validator-certs",
+		"validator",
+		"knative-observability",
+		webhook.WithWebhookConfigs(webhook.WebhookConfig{Client: webhooks, Name: "validator.observability.knative.dev"}),
+		webhook.WithCertValidity(300*24*time.Hour, 90*24*time.Hour),
+		webhook.WithRotateBefore(30*24*time.Hour),
+		webhook.WithClock(clock),
+	)
+
+	if _, err := m.GetCertificate(nil); err == nil {
+		t.Error("expected an error before the first sync")
+	}
+
+	if err := m.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if secrets.creates != 1 || secrets.updates != 0 {
+		t.Errorf("expected secret to be created once, got %d creates and %d updates", secrets.creates, secrets.updates)
+	}
+	bundle := secrets.secret.Data[webhook.SecretCABundleKey]
+	first := verifyServingCert(t, m, bundle, now)
+	for i := 0; i < 2; i++ {
+		if got := webhooks.caBundle(i); got != base64.StdEncoding.EncodeToString(bundle) {
+			t.Errorf("expected webhook %d caBundle to be patched, got %q", i, got)
+		}
+	}
+
+	t.Run("it keeps valid certificates", func(t *testing.T) {
+		now = now.Add(30 * 24 * time.Hour)
+		patches := webhooks.patches
+		if err := m.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if secrets.updates != 0 {
+			t.Errorf("expected no secret updates, got %d", secrets.updates)
+		}
+		if webhooks.patches != patches {
+			t.Errorf("expected no webhook patches, got %d", webhooks.patches-patches)
+		}
+		if got := verifyServingCert(t, m, bundle, now); got.SerialNumber.Cmp(first.SerialNumber) != 0 {
+			t.Errorf("expected the same serving certificate")
+		}
+	})
+
+	t.Run("it rotates the serving certificate before it expires", func(t *testing.T) {
+		now = now.Add(31 * 24 * time.Hour)
+		patches := webhooks.patches
+		if err := m.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if secrets.updates != 1 {
+			t.Errorf("expected one secret update, got %d", secrets.updates)
+		}
+		if webhooks.patches != patches {
+			t.Errorf("expected the CA bundle to be unchanged")
+		}
+		if got := verifyServingCert(t, m, bundle, now); got.SerialNumber.Cmp(first.SerialNumber) == 0 {
+			t.Errorf("expected a new serving certificate")
+		}
+	})
+
+	var newBundle []byte
+	t.Run("it publishes a new CA before signing with it", func(t *testing.T) {
+		now = now.Add(210 * 24 * time.Hour)
+		if err := m.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		newBundle = secrets.secret.Data[webhook.SecretCABundleKey]
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(newBundle)
+		if n := len(pool.Subjects()); n != 2 {
+			t.Errorf("expected the bundle to have 2 CAs, got %d", n)
+		}
+		if got := webhooks.caBundle(0); got != base64.StdEncoding.EncodeToString(newBundle) {
+			t.Errorf("expected caBundle to be patched with the new bundle")
+		}
+		verifyServingCert(t, m, bundle, now)
+	})
+
+	t.Run("it signs with the new CA once the bundle is published", func(t *testing.T) {
+		webhooks.setCABundle(1, base64.StdEncoding.EncodeToString(bundle))
+		if err := m.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		verifyServingCert(t, m, bundle, now)
+
+		patches := webhooks.patches
+		if err := m.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if webhooks.patches != patches {
+			t.Errorf("expected the CA bundle to be unchanged")
+		}
+		if got := secrets.secret.Data[webhook.SecretCABundleKey]; string(got) != string(newBundle) {
+			t.Errorf("expected the bundle to keep the old CA")
+		}
+		leaf := verifyServingCert(t, m, newBundle, now)
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(bundle)
+		_, err := leaf.Verify(x509.VerifyOptions{
+			DNSName:     "validator.knative-observability.svc",
+			Roots:       pool,
+			CurrentTime: now,
+		})
+		if err == nil {
+			t.Errorf("expected serving certificate to be signed by the new CA")
+		}
+	})
+
+	t.Run("it uses certificates written by another replica", func(t *testing.T) {
+		other := webhook.NewCertManager(secrets, "validator-certs", "validator", "knative-observability", webhook.WithClock(clock))
+		updates := secrets.updates
+		if err := other.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if secrets.updates != updates {
+			t.Errorf("expected no secret updates, got %d", secrets.updates-updates)
+		}
+		a, _ := m.GetCertificate(nil)
+		b, _ := other.GetCertificate(nil)
+		if string(a.Certificate[0]) != string(b.Certificate[0]) {
+			t.Errorf("expected replicas to serve the same certificate")
+		}
+	})
+
+	t.Run("it retries when another replica wins a write", func(t *testing.T) {
+		secrets := &spySecretClient{conflicts: 1}
+		m := webhook.NewCertManager(secrets, "validator-certs", "validator", "knative-observability", webhook.WithClock(clock))
+		if err := m.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if secrets.creates != 2 {
+			t.Errorf("expected a second create, got %d", secrets.creates)
+		}
+	})
+}
+
+func TestServerServesRotatedCertificates(t *testing.T) {
+	// The first certificate is issued in the past so that both certificates
+	// are valid for the client.
+	now := time.Now().Add(-300 * 24 * time.Hour)
+	secrets := &spySecretClient{}
+	m := webhook.NewCertManager(
+		secrets,
+		"validator-certs",
+		"validator",
+		"knative-observability",
+		webhook.WithCertValidity(10*365*24*time.Hour, 320*24*time.Hour),
+		webhook.WithClock(func() time.Time { return now }),
+	)
+	if err := m.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	server := webhook.NewServer("127.0.0.1:0", webhook.WithTLSConfig(&tls.Config{
+		GetCertificate: m.GetCertificate,
+	}))
+	server.Run(false)
+	defer server.Close()
+
+	get := func() *x509.Certificate {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(secrets.secret.Data[webhook.SecretCABundleKey])
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:    pool,
+				ServerName: "validator.knative-observability.svc",
+			},
+		}}
+		var (
+			err  error
+			resp *http.Response
+		)
+		for i := 0; i < 100; i++ {
+			resp, err = client.Get("https://" + server.Addr() + "/health")
+			if err == nil {
+				break
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		return resp.TLS.PeerCertificates[0]
+	}
+
+	before := get()
+	now = time.Now()
+	if err := m.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	after := get()
+
+	if before.SerialNumber.Cmp(after.SerialNumber) == 0 {
+		t.Errorf("expected the rotated certificate to be served")
+	}
+}
+
+func verifyServingCert(t *testing.T, m *webhook.CertManager, bundle []byte, now time.Time) *x509.Certificate {
+	t.Helper()
+
+	cert, err := m.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(bundle)
+	_, err = leaf.Verify(x509.VerifyOptions{
+		DNSName:     "validator.knative-observability.svc",
+		Roots:       pool,
+		CurrentTime: now,
+	})
+	if err != nil {
+		t.Errorf("expected serving certificate to verify: %s", err)
+	}
+	return leaf
+}
+
+type spySecretClient struct {
+	secret    *corev1.Secret
+	creates   int
+	updates   int
+	conflicts int
+}
+
+var secretsResource = schema.GroupResource{Resource: "secrets"}
+
+func (s *spySecretClient) Get(name string, _ metav1.GetOptions) (*corev1.Secret, error) {
+	if s.secret == nil {
+		return nil, k8serrors.NewNotFound(secretsResource, name)
+	}
+	return s.secret.DeepCopy(), nil
+}
+
+func (s *spySecretClient) Create(secret *corev1.Secret) (*corev1.Secret, error) {
+	s.creates++
+	if s.conflicts > 0 {
+		s.conflicts--
+		return nil, k8serrors.NewAlreadyExists(secretsResource, secret.Name)
+	}
+	s.secret = secret.DeepCopy()
+	return secret, nil
+}
+
+func (s *spySecretClient) Update(secret *corev1.Secret) (*corev1.Secret, error) {
+	s.updates++
+	s.secret = secret.DeepCopy()
+	return secret, nil
+}
+
+type spyWebhookConfigClient struct {
+	mu      sync.Mutex
+	obj     *unstructured.Unstructured
+	patches int
+}
+
+func newSpyWebhookConfigClient(n int) *spyWebhookConfigClient {
+	var webhooks []interface{}
+	for i := 0; i < n; i++ {
+		webhooks = append(webhooks, map[string]interface{}{
+			"clientConfig": map[string]interface{}{"caBundle": ""},
+		})
+	}
+	return &spyWebhookConfigClient{
+		obj: &unstructured.Unstructured{Object: map[string]interface{}{
+			"webhooks": webhooks,
+		}},
+	}
+}
+
+func (s *spyWebhookConfigClient) Get(string, metav1.GetOptions, ...string) (*unstructured.Unstructured, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.obj.DeepCopy(), nil
+}
+
+func (s *spyWebhookConfigClient) Patch(_ string, _ types.PatchType, data []byte, _ metav1.UpdateOptions, _ ...string) (*unstructured.Unstructured, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.patches++
+	var ops []struct {
+		Path  string `json:"path"`
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return nil, err
+	}
+	webhooks := s.obj.Object["webhooks"].([]interface{})
+	for i, w := range webhooks {
+		for _, op := range ops {
+			if op.Path == fmt.Sprintf("/webhooks/%d/clientConfig/caBundle", i) {
+				w.(map[string]interface{})["clientConfig"].(map[string]interface{})["caBundle"] = op.Value
+			}
+		}
+	}
+	return s.obj.DeepCopy(), nil
+}
+
+func (s *spyWebhookConfigClient) setCABundle(i int, bundle string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	webhooks := s.obj.Object["webhooks"].([]interface{})
+	webhooks[i].(map[string]interface{})["clientConfig"].(map[string]interface{})["caBundle"] = bundle
+}
+
+func (s *spyWebhookConfigClient) caBundle(i int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	webhooks := s.obj.Object["webhooks"].([]interface{})
+	return webhooks[i].(map[string]interface{})["clientConfig"].(map[string]interface{})["caBundle"].(string)
+}
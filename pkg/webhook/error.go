@@ -9,6 +9,7 @@ var (
 	errUnableToDeserialize = newError("Unable to deserialize request object", http.StatusBadRequest)
 	errUnableToReadBody    = newError("Unable to read request body", http.StatusInternalServerError)
 	errUnableToWriteConfig = newError("Unable to write telegraf.conf", http.StatusInternalServerError)
+	errTelegrafBusy        = newError("Too many concurrent telegraf validations", http.StatusServiceUnavailable)
 	errUnsupportedMedia    = newError("Expected a Content-Type of application/json", http.StatusUnsupportedMediaType)
 )
 
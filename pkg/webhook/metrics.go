@@ -0,0 +1,233 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/api/admission/v1beta1"
+)
+
+// reasons maps each denial message to the name of its constant, which is
+// used as the reason label and in the audit log.
+var reasons = map[string]string{
+	ConfigTelegrafError:            "ConfigTelegrafError",
+	ConfigIncludesKubernetesError:  "ConfigIncludesKubernetesError",
+	ConfigLogNoTypeError:           "ConfigLogNoTypeError",
+	ConfigLogChangeTypeError:       "ConfigLogChangeTypeError",
+	ConfigSyslogBadPortError:       "ConfigSyslogBadPortError",
+	ConfigSyslogBadHostError:       "ConfigSyslogBadHostError",
+	ConfigSyslogInsecureError:      "ConfigSyslogInsecureError",
+	ConfigWebhookBadURLError:       "ConfigWebhookBadURLError",
+	ConfigWebhookInsecureError:     "ConfigWebhookInsecureError",
+	ConfigMetricNoTypeError:        "ConfigMetricNoTypeError",
+	ConfigMetricNonStringTypeError: "ConfigMetricNonStringTypeError",
+	ConfigMultilineClusterError:    "ConfigMultilineClusterError",
+	ConfigMultilineBadPresetError:  "ConfigMultilineBadPresetError",
+	ConfigMultilineBadRegexError:   "ConfigMultilineBadRegexError",
+	ConfigParserClusterError:       "ConfigParserClusterError",
+	ConfigParserBadNameError:       "ConfigParserBadNameError",
+	ConfigParserBadFormatError:     "ConfigParserBadFormatError",
+	ConfigParserBadRegexError:      "ConfigParserBadRegexError",
+	ConfigParserBadFieldError:      "ConfigParserBadFieldError",
+	ConfigPodParserNamespaceError:  "ConfigPodParserNamespaceError",
+	ConfigPolicyHostError:          "ConfigPolicyHostError",
+	ConfigPolicyPortError:          "ConfigPolicyPortError",
+	ConfigPolicySchemeError:        "ConfigPolicySchemeError",
+	ConfigPolicyPluginError:        "ConfigPolicyPluginError",
+	ConfigPolicyUnavailableError:   "ConfigPolicyUnavailableError",
+	ConfigPolicyResolveError:       "ConfigPolicyResolveError",
+	ConfigQuotaLogSinkError:        "ConfigQuotaLogSinkError",
+	ConfigQuotaMetricSinkError:     "ConfigQuotaMetricSinkError",
+	ConfigQuotaUnavailableError:    "ConfigQuotaUnavailableError",
+	ConfigProbeError:               "ConfigProbeError",
+	ConfigProbeBadModeError:        "ConfigProbeBadModeError",
+}
+
+// reasonFor returns the constant name of a denial message. Messages may
+// carry detail after the constant, separated by ": ".
+func reasonFor(resp *v1beta1.AdmissionResponse) string {
+	if resp.Allowed {
+		return ""
+	}
+	if resp.Result == nil {
+		return "Unknown"
+	}
+
+	msg := resp.Result.Message
+	if r, ok := reasons[msg]; ok {
+		return r
+	}
+	if i := strings.Index(msg, ": "); i >= 0 {
+		if r, ok := reasons[msg[:i]]; ok {
+			return r
+		}
+	}
+	return "Unknown"
+}
+
+// metrics are the Prometheus metrics of a Server.
+type metrics struct {
+	requests         *prometheus.CounterVec
+	decisions        *prometheus.CounterVec
+	duration         *prometheus.HistogramVec
+	telegrafDuration *prometheus.HistogramVec
+}
+
+func newMetrics(reg prometheus.Registerer) *metrics {
+	m := &metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "validator",
+			Name:      "admission_requests_total",
+			Help:      "Admission reviews answered, by path, kind and operation.",
+		}, []string{"path", "kind", "operation"}),
+		decisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "validator",
+			Name:      "admission_decisions_total",
+			Help:      "Admission decisions, by path, kind, decision and denial reason.",
+		}, []string{"path", "kind", "decision", "reason"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "validator",
+			Name:      "admission_request_duration_seconds",
+			Help:      "Time to handle admission requests, by path and HTTP status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"path", "code"}),
+		telegrafDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "validator",
+			Name:      "telegraf_validation_duration_seconds",
+			Help:      "Time to validate metric sinks with the telegraf binary, including waiting for a slot, by result.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"result"}),
+	}
+
+	reg.MustRegister(m.requests, m.decisions, m.duration, m.telegrafDuration)
+	return m
+}
+
+// WithMetrics registers the server metrics with reg instead of a private
+// registry.
+func WithMetrics(reg prometheus.Registerer) ServerOpt {
+	return func(s *Server) {
+		s.metrics = newMetrics(reg)
+	}
+}
+
+// WithAuditLog writes a JSON line for every admission decision to w.
+func WithAuditLog(w io.Writer) ServerOpt {
+	return func(s *Server) {
+		s.audit = &auditLog{enc: json.NewEncoder(w)}
+	}
+}
+
+// instrument records the duration and status code of every request to a
+// handler, including requests rejected before a decision is made.
+func (s *Server) instrument(path string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		h(sw, r)
+		s.metrics.duration.
+			WithLabelValues(path, strconv.Itoa(sw.code)).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// recordDecision counts a decision and writes it to the audit log.
+func (s *Server) recordDecision(r *http.Request, rar *v1beta1.AdmissionReview, resp *v1beta1.AdmissionResponse, warnings []string) {
+	req := rar.Request
+	reason := reasonFor(resp)
+	decision := "allowed"
+	if !resp.Allowed {
+		decision = "denied"
+	}
+
+	s.metrics.requests.WithLabelValues(r.URL.Path, req.Kind.Kind, string(req.Operation)).Inc()
+	s.metrics.decisions.WithLabelValues(r.URL.Path, req.Kind.Kind, decision, reason).Inc()
+
+	if s.audit == nil {
+		return
+	}
+
+	var message string
+	if resp.Result != nil {
+		message = resp.Result.Message
+	}
+	s.audit.write(auditRecord{
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		UID:       string(req.UID),
+		Path:      r.URL.Path,
+		Operation: string(req.Operation),
+		Kind:      req.Kind.Kind,
+		Namespace: req.Namespace,
+		Name:      objectName(req),
+		User:      req.UserInfo.Username,
+		Groups:    req.UserInfo.Groups,
+		Allowed:   resp.Allowed,
+		Reason:    reason,
+		Message:   message,
+		Warnings:  warnings,
+		Patched:   len(resp.Patch) > 0,
+	})
+}
+
+// objectName falls back to the name in the object, since the request name
+// is empty for some CREATE requests.
+func objectName(req *v1beta1.AdmissionRequest) string {
+	if req.Name != "" {
+		return req.Name
+	}
+	var obj struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+	}
+	_ = json.Unmarshal(req.Object.Raw, &obj)
+	return obj.Metadata.Name
+}
+
+type auditRecord struct {
+	Time      string   `json:"time"`
+	UID       string   `json:"uid"`
+	Path      string   `json:"path"`
+	Operation string   `json:"operation"`
+	Kind      string   `json:"kind"`
+	Namespace string   `json:"namespace,omitempty"`
+	Name      string   `json:"name"`
+	User      string   `json:"user"`
+	Groups    []string `json:"groups,omitempty"`
+	Allowed   bool     `json:"allowed"`
+	Reason    string   `json:"reason,omitempty"`
+	Message   string   `json:"message,omitempty"`
+	Warnings  []string `json:"warnings,omitempty"`
+	Patched   bool     `json:"patched,omitempty"`
+}
+
+type auditLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (a *auditLog) write(r auditRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.enc.Encode(r); err != nil {
+		log.Printf("Unable to write audit record: %s", err)
+	}
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,150 @@
+package webhook_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/knative/observability/pkg/metrictest"
+	"github.com/knative/observability/pkg/webhook"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	var audit bytes.Buffer
+	server := webhook.NewServer(
+		"127.0.0.1:0",
+		webhook.WithMetrics(reg),
+		webhook.WithAuditLog(&audit),
+		webhook.WithTelegrafBinary(fakeTelegraf(t, "exit 0")),
+	)
+	server.Run(false)
+	defer server.Close()
+
+	reviews := []struct {
+		endpoint string
+		body     string
+	}{
+		{"/logsink", fmt.Sprintf(userAdmissionTemplate, `{"type": "syslog", "host": "example.com", "port": 514}`)},
+		{"/logsink", fmt.Sprintf(logSinkAdmissionTemplate, `{"type": "syslog", "host": "example.com", "port": 514, "enable_tls": true}`)},
+		{"/logsink", fmt.Sprintf(clusterLogSinkAdmissionTemplate, `{"type": "webhook", "url": "https://example.com", "parser": "json"}`)},
+		{"/metricsink", fmt.Sprintf(clusterMetricAdmissionTemplate, `{"inputs": [{"type": "cpu"}], "outputs": [{"type": "discard"}]}`)},
+		{"/logparser", `not json`},
+	}
+	for _, r := range reviews {
+		resp := postReview(t, server, r.endpoint, r.body)
+		resp.Body.Close()
+	}
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		value  float64
+	}{
+		{
+			"validator_admission_requests_total",
+			map[string]string{"path": "/logsink", "kind": "LogSink", "operation": "CREATE"},
+			2,
+		},
+		{
+			"validator_admission_decisions_total",
+			map[string]string{"path": "/logsink", "kind": "LogSink", "decision": "denied", "reason": "ConfigSyslogInsecureError"},
+			1,
+		},
+		{
+			"validator_admission_decisions_total",
+			map[string]string{"path": "/logsink", "kind": "LogSink", "decision": "allowed", "reason": ""},
+			1,
+		},
+		{
+			"validator_admission_decisions_total",
+			map[string]string{"path": "/logsink", "kind": "ClusterLogSink", "decision": "denied", "reason": "ConfigParserClusterError"},
+			1,
+		},
+		{
+			"validator_admission_request_duration_seconds",
+			map[string]string{"path": "/logsink", "code": "200"},
+			3,
+		},
+		{
+			"validator_admission_request_duration_seconds",
+			map[string]string{"path": "/logparser", "code": "400"},
+			1,
+		},
+		{
+			"validator_telegraf_validation_duration_seconds",
+			map[string]string{"result": "valid"},
+			1,
+		},
+	}
+	for _, test := range tests {
+		if got := metrictest.Value(t, reg, test.name, test.labels); got != test.value {
+			t.Errorf("expected %s%v to be %v, got %v", test.name, test.labels, test.value, got)
+		}
+	}
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(audit.String()), "\n") {
+		var r map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("expected JSON audit line, got %q: %s", line, err)
+		}
+		records = append(records, r)
+	}
+	if len(records) != 4 {
+		t.Fatalf("expected 4 audit records, got %d", len(records))
+	}
+
+	denied := records[0]
+	expected := map[string]interface{}{
+		"uid":       testUID,
+		"path":      "/logsink",
+		"operation": "CREATE",
+		"kind":      "LogSink",
+		"namespace": "test-ns",
+		"name":      "sink",
+		"user":      "tenant",
+		"allowed":   false,
+		"reason":    "ConfigSyslogInsecureError",
+		"message":   webhook.ConfigSyslogInsecureError,
+	}
+	for k, v := range expected {
+		if denied[k] != v {
+			t.Errorf("expected audit %s to be %v, got %v", k, v, denied[k])
+		}
+	}
+	if _, ok := records[1]["reason"]; ok {
+		t.Errorf("expected allowed decisions to have no reason, got %v", records[1]["reason"])
+	}
+}
+
+var userAdmissionTemplate = `{
+	"kind": "AdmissionReview",
+	"apiVersion": "admission.k8s.io/v1",
+	"request": {
+		"uid": "f9bc53a0-266b-11e9-928e-42010a800feb",
+		"kind": {
+			"group": "observability.knative.dev",
+			"version": "v1alpha1",
+			"kind": "LogSink"
+		},
+		"resource": {
+			"group": "observability.knative.dev",
+			"version": "v1alpha1",
+			"resource": "logsinks"
+		},
+		"namespace": "test-ns",
+		"operation": "CREATE",
+		"userInfo": {
+			"username": "tenant",
+			"groups": ["system:authenticated"]
+		},
+		"object": {
+			"metadata": {"name": "sink", "namespace": "test-ns"},
+			"spec": %s
+		}
+	}
+}`
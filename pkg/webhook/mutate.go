@@ -0,0 +1,275 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"k8s.io/api/admission/v1beta1"
+)
+
+const (
+	// DefaultSyslogPort is the port given to syslog sinks that do not set
+	// one. It is the registered port for syslog over TLS.
+	DefaultSyslogPort = 6514
+
+	sinkAPIVersion = "observability.knative.dev/v1alpha1"
+)
+
+// jsonPatchOp is a single RFC 6902 operation.
+type jsonPatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// mutateHandler fills defaults into sinks so the stored object shows how it
+// will be rendered. It only fills in what is missing; anything set
+// explicitly is left for the validating webhooks to judge.
+func (s *Server) mutateHandler(w http.ResponseWriter, r *http.Request) {
+	requestedAdmissionReview, httpErr := deserializeReview(r)
+	if httpErr != nil {
+		httpErr.Write(w)
+		return
+	}
+	req := requestedAdmissionReview.Request
+
+	var obj map[string]interface{}
+	err := json.Unmarshal(req.Object.Raw, &obj)
+	if err != nil || obj == nil {
+		errUnableToDeserialize.Write(w)
+		return
+	}
+
+	var ops []jsonPatchOp
+	switch req.Kind.Kind {
+	case "LogSink":
+		ops = defaultTypeMeta(obj, "LogSink")
+		ops = append(ops, defaultNamespace(obj, req.Namespace)...)
+		ops = append(ops, defaultLogSinkSpec(obj)...)
+	case "ClusterLogSink":
+		ops = defaultTypeMeta(obj, "ClusterLogSink")
+		ops = append(ops, defaultLogSinkSpec(obj)...)
+	case "MetricSink":
+		ops = defaultTypeMeta(obj, "MetricSink")
+		ops = append(ops, defaultNamespace(obj, req.Namespace)...)
+		ops = append(ops, defaultMetricSinkSpec(obj)...)
+	case "ClusterMetricSink":
+		ops = defaultTypeMeta(obj, "ClusterMetricSink")
+		ops = append(ops, defaultMetricSinkSpec(obj)...)
+	default:
+		errInvalidRequest.Write(w)
+		return
+	}
+
+	resp := &v1beta1.AdmissionResponse{
+		Allowed: true,
+	}
+	if len(ops) > 0 {
+		patch, err := json.Marshal(ops)
+		if err != nil {
+			log.Printf("Unable to marshal patch: %s", err)
+			errUnableToDeserialize.Write(w)
+			return
+		}
+		pt := v1beta1.PatchTypeJSONPatch
+		resp.Patch = patch
+		resp.PatchType = &pt
+	}
+
+	s.writeReview(w, r, requestedAdmissionReview, resp)
+}
+
+func defaultTypeMeta(obj map[string]interface{}, kind string) []jsonPatchOp {
+	var ops []jsonPatchOp
+	if isEmpty(obj["kind"]) {
+		ops = append(ops, jsonPatchOp{Op: "add", Path: "/kind", Value: kind})
+	}
+	if isEmpty(obj["apiVersion"]) {
+		ops = append(ops, jsonPatchOp{Op: "add", Path: "/apiVersion", Value: sinkAPIVersion})
+	}
+	return ops
+}
+
+// defaultNamespace sets the namespace the renderers would otherwise assume.
+func defaultNamespace(obj map[string]interface{}, namespace string) []jsonPatchOp {
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	metadata, ok := obj["metadata"].(map[string]interface{})
+	if !ok {
+		return []jsonPatchOp{{
+			Op:    "add",
+			Path:  "/metadata",
+			Value: map[string]interface{}{"namespace": namespace},
+		}}
+	}
+	if !isEmpty(metadata["namespace"]) {
+		return nil
+	}
+	return []jsonPatchOp{{Op: "add", Path: "/metadata/namespace", Value: namespace}}
+}
+
+func defaultLogSinkSpec(obj map[string]interface{}) []jsonPatchOp {
+	spec, ok := obj["spec"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	var ops []jsonPatchOp
+	switch spec["type"] {
+	case "syslog":
+		if isEmpty(spec["port"]) {
+			ops = append(ops, jsonPatchOp{Op: "add", Path: "/spec/port", Value: DefaultSyslogPort})
+		}
+		if _, ok := spec["enable_tls"]; !ok {
+			ops = append(ops, jsonPatchOp{Op: "add", Path: "/spec/enable_tls", Value: true})
+		}
+	case "webhook":
+		u, ok := spec["url"].(string)
+		if !ok {
+			break
+		}
+		if withPort, ok := explicitPortURL(u); ok {
+			ops = append(ops, jsonPatchOp{Op: "replace", Path: "/spec/url", Value: withPort})
+		}
+	}
+	return ops
+}
+
+// explicitPortURL adds the port fluent-bit will connect to when the URL
+// relies on the scheme default. The port is spliced into the URL as given so
+// the rest of it is not re-encoded. It returns false when nothing changes.
+func explicitPortURL(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || u.Port() != "" {
+		return "", false
+	}
+
+	var port string
+	switch u.Scheme {
+	case "https":
+		port = "443"
+	case "http":
+		port = "80"
+	default:
+		return "", false
+	}
+
+	start := strings.Index(rawURL, "//")
+	if start < 0 {
+		return "", false
+	}
+	start += len("//")
+	end := strings.IndexAny(rawURL[start:], "/?#")
+	if end < 0 {
+		end = len(rawURL)
+	} else {
+		end += start
+	}
+
+	// A host with an empty port, as in https://example.com:/, already has
+	// the colon.
+	if !strings.HasSuffix(rawURL[:end], ":") {
+		port = ":" + port
+	}
+	return rawURL[:end] + port + rawURL[end:], true
+}
+
+// defaultMetricSinkSpec makes inputs and outputs explicit lists and names
+// the type of plugin maps that leave it out, when their options belong to
+// exactly one known plugin. Maps whose type cannot be inferred are rejected
+// by validation.
+func defaultMetricSinkSpec(obj map[string]interface{}) []jsonPatchOp {
+	spec, ok := obj["spec"].(map[string]interface{})
+	if !ok {
+		return []jsonPatchOp{{
+			Op:    "add",
+			Path:  "/spec",
+			Value: map[string]interface{}{"inputs": []interface{}{}, "outputs": []interface{}{}},
+		}}
+	}
+
+	var ops []jsonPatchOp
+	for _, f := range []struct {
+		field   string
+		schemas map[string]pluginSchema
+		common  pluginSchema
+	}{
+		{"inputs", inputSchemas, commonInputFields},
+		{"outputs", outputSchemas, commonOutputFields},
+	} {
+		if spec[f.field] == nil {
+			ops = append(ops, jsonPatchOp{Op: "add", Path: "/spec/" + f.field, Value: []interface{}{}})
+			continue
+		}
+		plugins, ok := spec[f.field].([]interface{})
+		if !ok {
+			continue
+		}
+		for i, p := range plugins {
+			plugin, ok := p.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if _, ok := plugin["type"]; ok {
+				continue
+			}
+			if t, ok := inferPluginType(f.schemas, f.common, plugin); ok {
+				ops = append(ops, jsonPatchOp{
+					Op:    "add",
+					Path:  fmt.Sprintf("/spec/%s/%d/type", f.field, i),
+					Value: t,
+				})
+			}
+		}
+	}
+	return ops
+}
+
+// inferPluginType finds the only plugin that has all of the options of the
+// map. Options common to every plugin do not tell plugins apart.
+func inferPluginType(schemas map[string]pluginSchema, common pluginSchema, plugin map[string]interface{}) (string, bool) {
+	var specific []string
+	for k := range plugin {
+		if _, ok := common[k]; !ok {
+			specific = append(specific, k)
+		}
+	}
+	if len(specific) == 0 {
+		return "", false
+	}
+
+	var match string
+	matches := 0
+	for name, ps := range schemas {
+		ok := true
+		for _, k := range specific {
+			if _, has := ps[k]; !has {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			match = name
+			matches++
+		}
+	}
+	return match, matches == 1
+}
+
+func isEmpty(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return true
+	case string:
+		return t == ""
+	case float64:
+		return t == 0
+	}
+	return false
+}
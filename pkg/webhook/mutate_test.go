@@ -0,0 +1,271 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/knative/observability/pkg/webhook"
+	"k8s.io/api/admission/v1beta1"
+)
+
+type patchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+func TestMutate(t *testing.T) {
+	tests := []struct {
+		name     string
+		kind     string
+		resource string
+		object   string
+		expected []patchOp
+	}{
+		{
+			name:     "syslog LogSink without port, TLS or namespace",
+			kind:     "LogSink",
+			resource: "logsinks",
+			object: `{
+				"metadata": {"name": "sink"},
+				"spec": {"type": "syslog", "host": "example.com"}
+			}`,
+			expected: []patchOp{
+				{Op: "add", Path: "/kind", Value: "LogSink"},
+				{Op: "add", Path: "/apiVersion", Value: "observability.knative.dev/v1alpha1"},
+				{Op: "add", Path: "/metadata/namespace", Value: "test-ns"},
+				{Op: "add", Path: "/spec/port", Value: float64(webhook.DefaultSyslogPort)},
+				{Op: "add", Path: "/spec/enable_tls", Value: true},
+			},
+		},
+		{
+			name:     "syslog LogSink with everything set",
+			kind:     "LogSink",
+			resource: "logsinks",
+			object: `{
+				"apiVersion": "observability.knative.dev/v1alpha1",
+				"kind": "LogSink",
+				"metadata": {"name": "sink", "namespace": "other-ns"},
+				"spec": {"type": "syslog", "host": "example.com", "port": 514, "enable_tls": false}
+			}`,
+		},
+		{
+			name:     "webhook ClusterLogSink without port",
+			kind:     "ClusterLogSink",
+			resource: "clusterlogsinks",
+			object: `{
+				"apiVersion": "observability.knative.dev/v1alpha1",
+				"kind": "ClusterLogSink",
+				"metadata": {"name": "sink"},
+				"spec": {"type": "webhook", "url": "https://example.com/path?q=1"}
+			}`,
+			expected: []patchOp{
+				{Op: "replace", Path: "/spec/url", Value: "https://example.com:443/path?q=1"},
+			},
+		},
+		{
+			name:     "webhook LogSink without port keeps the URL encoding",
+			kind:     "LogSink",
+			resource: "logsinks",
+			object: `{
+				"apiVersion": "observability.knative.dev/v1alpha1",
+				"kind": "LogSink",
+				"metadata": {"name": "sink", "namespace": "test-ns"},
+				"spec": {"type": "webhook", "url": "http://user:p%41ss@[::1]/a b?q=%7E#frag"}
+			}`,
+			expected: []patchOp{
+				{Op: "replace", Path: "/spec/url", Value: "http://user:p%41ss@[::1]:80/a b?q=%7E#frag"},
+			},
+		},
+		{
+			name:     "webhook LogSink with an empty port",
+			kind:     "LogSink",
+			resource: "logsinks",
+			object: `{
+				"apiVersion": "observability.knative.dev/v1alpha1",
+				"kind": "LogSink",
+				"metadata": {"name": "sink", "namespace": "test-ns"},
+				"spec": {"type": "webhook", "url": "https://example.com:"}
+			}`,
+			expected: []patchOp{
+				{Op: "replace", Path: "/spec/url", Value: "https://example.com:443"},
+			},
+		},
+		{
+			name:     "webhook LogSink without scheme",
+			kind:     "LogSink",
+			resource: "logsinks",
+			object: `{
+				"apiVersion": "observability.knative.dev/v1alpha1",
+				"kind": "LogSink",
+				"metadata": {"name": "sink", "namespace": "test-ns"},
+				"spec": {"type": "webhook", "url": "example.com/path"}
+			}`,
+		},
+		{
+			name:     "webhook LogSink with port",
+			kind:     "LogSink",
+			resource: "logsinks",
+			object: `{
+				"apiVersion": "observability.knative.dev/v1alpha1",
+				"kind": "LogSink",
+				"metadata": {"name": "sink", "namespace": "test-ns"},
+				"spec": {"type": "webhook", "url": "https://example.com:8443/"}
+			}`,
+		},
+		{
+			name:     "MetricSink without outputs",
+			kind:     "MetricSink",
+			resource: "metricsinks",
+			object: `{
+				"apiVersion": "observability.knative.dev/v1alpha1",
+				"kind": "MetricSink",
+				"metadata": {"name": "sink"},
+				"spec": {"inputs": [{"type": "cpu"}]}
+			}`,
+			expected: []patchOp{
+				{Op: "add", Path: "/metadata/namespace", Value: "test-ns"},
+				{Op: "add", Path: "/spec/outputs", Value: []interface{}{}},
+			},
+		},
+		{
+			name:     "MetricSink plugins without type",
+			kind:     "MetricSink",
+			resource: "metricsinks",
+			object: `{
+				"apiVersion": "observability.knative.dev/v1alpha1",
+				"kind": "MetricSink",
+				"metadata": {"name": "sink", "namespace": "test-ns"},
+				"spec": {
+					"inputs": [
+						{"type": "cpu"},
+						{"commands": ["echo 5"], "data_format": "value", "interval": "10s"},
+						{"urls": ["http://example.com/metrics"]},
+						{"interval": "10s"}
+					],
+					"outputs": [{"apikey": "some-key"}]
+				}
+			}`,
+			expected: []patchOp{
+				{Op: "add", Path: "/spec/inputs/1/type", Value: "exec"},
+				{Op: "add", Path: "/spec/outputs/0/type", Value: "datadog"},
+			},
+		},
+		{
+			name:     "ClusterMetricSink without spec",
+			kind:     "ClusterMetricSink",
+			resource: "clustermetricsinks",
+			object: `{
+				"apiVersion": "observability.knative.dev/v1alpha1",
+				"kind": "ClusterMetricSink",
+				"metadata": {"name": "sink"}
+			}`,
+			expected: []patchOp{
+				{Op: "add", Path: "/spec", Value: map[string]interface{}{
+					"inputs":  []interface{}{},
+					"outputs": []interface{}{},
+				}},
+			},
+		},
+	}
+
+	server := webhook.NewServer("127.0.0.1:0")
+	server.Run(false)
+	defer server.Close()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := postReview(t, server, "/mutate", fmt.Sprintf(mutateAdmissionTemplate, test.kind, test.resource, test.object))
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected http status 200, got %d", resp.StatusCode)
+			}
+			defer resp.Body.Close()
+
+			var review v1beta1.AdmissionReview
+			err := json.NewDecoder(resp.Body).Decode(&review)
+			if err != nil {
+				t.Fatalf("unable to decode resp body: %s", err)
+			}
+			if !review.Response.Allowed {
+				t.Errorf("expected response to be allowed, got false")
+			}
+			if review.Response.UID != testUID {
+				t.Errorf("expected response UID to match request, got %q", review.Response.UID)
+			}
+
+			if len(test.expected) == 0 {
+				if review.Response.Patch != nil || review.Response.PatchType != nil {
+					t.Errorf("expected no patch, got %s", review.Response.Patch)
+				}
+				return
+			}
+
+			if review.Response.PatchType == nil || *review.Response.PatchType != v1beta1.PatchTypeJSONPatch {
+				t.Errorf("expected patch type JSONPatch, got %v", review.Response.PatchType)
+			}
+			var ops []patchOp
+			err = json.Unmarshal(review.Response.Patch, &ops)
+			if err != nil {
+				t.Fatalf("unable to decode patch: %s", err)
+			}
+			if diff := cmp.Diff(test.expected, ops); diff != "" {
+				t.Errorf("As (-want, +got) = %v", diff)
+			}
+		})
+	}
+
+	t.Run("it rejects unknown kinds", func(t *testing.T) {
+		resp := postReview(t, server, "/mutate", fmt.Sprintf(mutateAdmissionTemplate, "LogParser", "logparsers", `{"spec": {}}`))
+		if resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("expected http status 422, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func postReview(t *testing.T, server *webhook.Server, path, body string) *http.Response {
+	var (
+		err  error
+		resp *http.Response
+	)
+	for i := 0; i < 100; i++ {
+		resp, err = http.Post(
+			"http://"+server.Addr()+path,
+			"application/json",
+			strings.NewReader(body),
+		)
+		if err == nil {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+var mutateAdmissionTemplate = `{
+	"kind": "AdmissionReview",
+	"apiVersion": "admission.k8s.io/v1beta1",
+	"request": {
+		"uid": "f9bc53a0-266b-11e9-928e-42010a800feb",
+		"kind": {
+			"group": "observability.knative.dev",
+			"version": "v1alpha1",
+			"kind": "%s"
+		},
+		"resource": {
+			"group": "observability.knative.dev",
+			"version": "v1alpha1",
+			"resource": "%s"
+		},
+		"namespace": "test-ns",
+		"operation": "CREATE",
+		"object": %s
+	}
+}`
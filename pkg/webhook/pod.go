@@ -0,0 +1,59 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	logsink "github.com/knative/observability/pkg/sink"
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// parserAnnotation prefixes the pod annotations the fluent-bit kubernetes
+// filter reads a parser name from. It is suffixed with the stream and
+// container, as in fluentbit.io/parser_stderr-some-container.
+const parserAnnotation = "fluentbit.io/parser"
+
+func (s *Server) podHandler(w http.ResponseWriter, r *http.Request) {
+	requestedAdmissionReview, httpErr := deserializeReview(r)
+	if httpErr != nil {
+		httpErr.Write(w)
+		return
+	}
+
+	var pod corev1.Pod
+	err := json.Unmarshal(requestedAdmissionReview.Request.Object.Raw, &pod)
+	if err != nil {
+		errUnableToDeserialize.Write(w)
+		return
+	}
+
+	resp := validatePodParser(*requestedAdmissionReview, pod)
+	s.writeReview(w, r, requestedAdmissionReview, resp)
+}
+
+// validatePodParser keeps pods from selecting the LogParser of another
+// namespace. fluent-bit looks parser annotations up among all parsers, and
+// LogParsers are registered as <namespace>.<name>. Built-in parsers have no
+// dot in their name.
+func validatePodParser(rar v1beta1.AdmissionReview, pod corev1.Pod) *v1beta1.AdmissionResponse {
+	namespace := rar.Request.Namespace
+	if namespace == "" {
+		namespace = pod.Namespace
+	}
+
+	for k, v := range pod.Annotations {
+		if !strings.HasPrefix(k, parserAnnotation) || !strings.Contains(v, ".") {
+			continue
+		}
+		if !strings.HasPrefix(v, logsink.ParserName(namespace, "")) {
+			return toAdmissionErrorResponse(ConfigPodParserNamespaceError)
+		}
+	}
+
+	return &v1beta1.AdmissionResponse{
+		UID:     rar.Request.UID,
+		Allowed: true,
+	}
+}
@@ -0,0 +1,65 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/knative/observability/pkg/webhook"
+	"k8s.io/api/admission/v1beta1"
+)
+
+func TestPodParserAnnotations(t *testing.T) {
+	tests := []struct {
+		name          string
+		annotations   string
+		errorResponse string
+	}{
+		{"no annotations", `{}`, ""},
+		{"built-in parser", `{"fluentbit.io/parser": "json"}`, ""},
+		{"parser of the pod namespace", `{"fluentbit.io/parser": "test-ns.access"}`, ""},
+		{"unrelated annotation", `{"example.com/parser": "other-ns.access"}`, ""},
+		{
+			"parser of another namespace",
+			`{"fluentbit.io/parser": "other-ns.access"}`,
+			webhook.ConfigPodParserNamespaceError,
+		},
+		{
+			"container parser of another namespace",
+			`{"fluentbit.io/parser_stderr-some-container": "other-ns.access"}`,
+			webhook.ConfigPodParserNamespaceError,
+		},
+		{
+			"parser of a namespace with the same prefix",
+			`{"fluentbit.io/parser": "test-ns-other.access"}`,
+			webhook.ConfigPodParserNamespaceError,
+		},
+	}
+
+	server := webhook.NewServer("127.0.0.1:0")
+	server.Run(false)
+	defer server.Close()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pod := fmt.Sprintf(`{"metadata": {"name": "some-pod", "annotations": %s}}`, test.annotations)
+			resp := postReview(t, server, "/pod", fmt.Sprintf(mutateAdmissionTemplate, "Pod", "pods", pod))
+			defer resp.Body.Close()
+
+			var review v1beta1.AdmissionReview
+			if err := json.NewDecoder(resp.Body).Decode(&review); err != nil {
+				t.Fatal(err)
+			}
+
+			if test.errorResponse == "" {
+				if !review.Response.Allowed {
+					t.Errorf("expected pod to be allowed, got %+v", review.Response.Result)
+				}
+				return
+			}
+			if review.Response.Allowed || review.Response.Result.Message != test.errorResponse {
+				t.Errorf("expected pod to be denied with %q, got %+v", test.errorResponse, review.Response)
+			}
+		})
+	}
+}
@@ -0,0 +1,594 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sink "github.com/knative/observability/pkg/apis/sink/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// PolicyConfigMapKey is the key of the destination policy in its ConfigMap.
+const PolicyConfigMapKey = "policy.yaml"
+
+// DestinationPolicy restricts where tenant LogSinks and MetricSinks may send
+// data. Cluster sinks are created by cluster admins and are not restricted.
+type DestinationPolicy struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+// PolicyRule applies to sinks in namespaces matched by NamespaceSelector, or
+// to every namespace when it is unset. A sink must satisfy every rule that
+// applies to its namespace. Empty allow lists allow anything.
+//
+// Hosts are matched as lowercase shell patterns, so "*.svc.cluster.local"
+// matches every in-cluster service. CIDRs are matched against the addresses
+// hosts resolve to when the sink is admitted. IP addresses in the shortened,
+// octal and hexadecimal forms libc accepts, such as 10.1 or 0x7f000001, are
+// normalized first.
+type PolicyRule struct {
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	AllowedHosts   []string `json:"allowedHosts,omitempty"`
+	DeniedHosts    []string `json:"deniedHosts,omitempty"`
+	AllowedCIDRs   []string `json:"allowedCIDRs,omitempty"`
+	DeniedCIDRs    []string `json:"deniedCIDRs,omitempty"`
+	AllowedPorts   []int    `json:"allowedPorts,omitempty"`
+	AllowedSchemes []string `json:"allowedSchemes,omitempty"`
+
+	AllowedInputs  []string `json:"allowedInputs,omitempty"`
+	AllowedOutputs []string `json:"allowedOutputs,omitempty"`
+
+	// Probe enables probing the destinations of sinks in matching
+	// namespaces before admitting them. It is warn or deny, and sinks can
+	// only make it stricter with the ProbeAnnotation.
+	Probe string `json:"probe,omitempty"`
+
+	selector    labels.Selector
+	allowedNets []*net.IPNet
+	deniedNets  []*net.IPNet
+}
+
+// ParseDestinationPolicy reads a policy from YAML or JSON.
+func ParseDestinationPolicy(data []byte) (*DestinationPolicy, error) {
+	var p DestinationPolicy
+	err := yaml.UnmarshalStrict(data, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range p.Rules {
+		r := &p.Rules[i]
+
+		r.selector = labels.Everything()
+		if r.NamespaceSelector != nil {
+			r.selector, err = metav1.LabelSelectorAsSelector(r.NamespaceSelector)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %s", i, err)
+			}
+		}
+		for _, hosts := range [][]string{r.AllowedHosts, r.DeniedHosts} {
+			for _, h := range hosts {
+				if _, err := path.Match(h, ""); err != nil {
+					return nil, fmt.Errorf("rule %d: bad host pattern %q", i, h)
+				}
+			}
+		}
+		if r.Probe != "" && !validProbeMode(r.Probe) {
+			return nil, fmt.Errorf("rule %d: bad probe mode %q", i, r.Probe)
+		}
+		r.allowedNets, err = parseCIDRs(r.AllowedCIDRs)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %s", i, err)
+		}
+		r.deniedNets, err = parseCIDRs(r.DeniedCIDRs)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %s", i, err)
+		}
+	}
+
+	return &p, nil
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// resolveTimeout bounds resolving a destination host for the policy.
+const resolveTimeout = 2 * time.Second
+
+// HostResolver resolves destination hosts to match them against CIDRs. It is
+// satisfied by a net.Resolver.
+type HostResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// WithHostResolver replaces the resolver used for the destination policy,
+// which defaults to net.DefaultResolver.
+func WithHostResolver(r HostResolver) ServerOpt {
+	return func(s *Server) {
+		s.resolver = r
+	}
+}
+
+// NamespaceGetter looks up namespaces to match them against rule selectors.
+// It is satisfied by a NamespaceLister.
+type NamespaceGetter interface {
+	Get(name string) (*corev1.Namespace, error)
+}
+
+// PolicyStore holds the current destination policy. It handles ConfigMap
+// informer events so the policy follows the named ConfigMap.
+type PolicyStore struct {
+	mu     sync.RWMutex
+	name   string
+	policy *DestinationPolicy
+}
+
+func NewPolicyStore(configMapName string) *PolicyStore {
+	return &PolicyStore{
+		name: configMapName,
+	}
+}
+
+// Policy returns the current policy or nil if there is none.
+func (s *PolicyStore) Policy() *DestinationPolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.policy
+}
+
+func (s *PolicyStore) Set(p *DestinationPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy = p
+}
+
+func (s *PolicyStore) OnAdd(obj interface{}) {
+	s.update(obj)
+}
+
+func (s *PolicyStore) OnUpdate(_, newObj interface{}) {
+	s.update(newObj)
+}
+
+func (s *PolicyStore) OnDelete(obj interface{}) {
+	cm, ok := obj.(*corev1.ConfigMap)
+	if !ok || cm.Name != s.name {
+		return
+	}
+	log.Printf("Destination policy %s removed", s.name)
+	s.Set(nil)
+}
+
+// update replaces the policy from the ConfigMap. An invalid policy is logged
+// and the previous one kept so a typo does not open up every destination.
+func (s *PolicyStore) update(obj interface{}) {
+	cm, ok := obj.(*corev1.ConfigMap)
+	if !ok || cm.Name != s.name {
+		return
+	}
+
+	p, err := ParseDestinationPolicy([]byte(cm.Data[PolicyConfigMapKey]))
+	if err != nil {
+		log.Printf("Invalid destination policy in %s, keeping previous policy: %s", s.name, err)
+		return
+	}
+	s.Set(p)
+}
+
+// destination is a host a sink sends to. Port is 0 and scheme empty when
+// they are not known.
+type destination struct {
+	scheme string
+	host   string
+	port   int
+}
+
+func (d destination) String() string {
+	s := d.host
+	if d.port != 0 {
+		s = net.JoinHostPort(d.host, strconv.Itoa(d.port))
+	}
+	if d.scheme != "" {
+		s = d.scheme + "://" + s
+	}
+	return s
+}
+
+// rulesFor returns the rules that apply to the namespace.
+func (s *Server) rulesFor(namespace string) ([]PolicyRule, string) {
+	if s.policy == nil {
+		return nil, ""
+	}
+	p := s.policy.Policy()
+	if p == nil || len(p.Rules) == 0 {
+		return nil, ""
+	}
+
+	ns, err := s.namespaces.Get(canonicalNamespace(namespace))
+	if err != nil {
+		log.Printf("Unable to get namespace %s for policy: %s", namespace, err)
+		return nil, ConfigPolicyUnavailableError
+	}
+
+	var rules []PolicyRule
+	for _, r := range p.Rules {
+		if r.selector.Matches(labels.Set(ns.Labels)) {
+			rules = append(rules, r)
+		}
+	}
+	return rules, ""
+}
+
+// checkLogSinkPolicy returns a denial message if the sink destination is not
+// allowed in its namespace.
+func (s *Server) checkLogSinkPolicy(namespace string, spec sink.SinkSpec) string {
+	rules, msg := s.rulesFor(namespace)
+	if msg != "" || len(rules) == 0 {
+		return msg
+	}
+
+	var d destination
+	switch spec.Type {
+	case "syslog":
+		d = destination{host: spec.Host, port: spec.Port}
+	case "webhook":
+		var ok bool
+		d, ok = parseDestination(spec.URL)
+		if !ok {
+			return ConfigWebhookBadURLError
+		}
+	}
+
+	return s.checkDestinations(rules, []destination{d})
+}
+
+// checkMetricSinkPolicy returns a denial message if a plugin type or an
+// output destination is not allowed in the namespace. Outputs without known
+// destination fields are denied since their destinations cannot be checked.
+func (s *Server) checkMetricSinkPolicy(namespace string, spec sink.MetricSinkSpec) string {
+	rules, msg := s.rulesFor(namespace)
+	if msg != "" || len(rules) == 0 {
+		return msg
+	}
+
+	var dests []destination
+	for _, output := range spec.Outputs {
+		t, _ := output["type"].(string)
+		if _, ok := outputDestinationFields[t]; !ok {
+			return fmt.Sprintf("%s: outputs.%s", ConfigPolicyPluginError, t)
+		}
+		dests = append(dests, outputDestinations(output)...)
+	}
+
+	for _, r := range rules {
+		for _, input := range spec.Inputs {
+			t, _ := input["type"].(string)
+			if !allowedName(r.AllowedInputs, t) {
+				return fmt.Sprintf("%s: inputs.%s", ConfigPolicyPluginError, t)
+			}
+		}
+		for _, output := range spec.Outputs {
+			t, _ := output["type"].(string)
+			if !allowedName(r.AllowedOutputs, t) {
+				return fmt.Sprintf("%s: outputs.%s", ConfigPolicyPluginError, t)
+			}
+		}
+	}
+	return s.checkDestinations(rules, dests)
+}
+
+// checkDestinations checks each destination against every rule. Hosts are
+// resolved at most once, and only when a rule has CIDRs.
+func (s *Server) checkDestinations(rules []PolicyRule, dests []destination) string {
+	for _, d := range dests {
+		lookup := s.ipLookup(d.host)
+		for _, r := range rules {
+			if msg := r.checkDestination(d, lookup); msg != "" {
+				return msg
+			}
+		}
+	}
+	return ""
+}
+
+// checkDestination denies destinations whose host matches a denied host or
+// resolves to any address in a denied CIDR, and, when the rule has allow
+// lists, destinations whose host matches no allowed host and does not
+// resolve only to addresses in allowed CIDRs. Hosts that cannot be resolved
+// are denied by rules with CIDRs.
+func (r PolicyRule) checkDestination(d destination, lookup func() ([]net.IP, error)) string {
+	host := normalizeHost(d.host)
+
+	if matchesHost(r.DeniedHosts, host) {
+		return fmt.Sprintf("%s: %s", ConfigPolicyHostError, d)
+	}
+	if len(r.deniedNets) > 0 {
+		ips, err := lookup()
+		if err != nil {
+			return fmt.Sprintf("%s: %s", ConfigPolicyResolveError, d)
+		}
+		for _, ip := range ips {
+			if containsIP(r.deniedNets, ip) {
+				return fmt.Sprintf("%s: %s", ConfigPolicyHostError, d)
+			}
+		}
+	}
+	if len(r.AllowedHosts) > 0 || len(r.allowedNets) > 0 {
+		allowed := matchesHost(r.AllowedHosts, host)
+		if !allowed && len(r.allowedNets) > 0 {
+			ips, err := lookup()
+			if err != nil {
+				return fmt.Sprintf("%s: %s", ConfigPolicyResolveError, d)
+			}
+			allowed = true
+			for _, ip := range ips {
+				allowed = allowed && containsIP(r.allowedNets, ip)
+			}
+		}
+		if !allowed {
+			return fmt.Sprintf("%s: %s", ConfigPolicyHostError, d)
+		}
+	}
+
+	if d.port != 0 && len(r.AllowedPorts) > 0 {
+		allowed := false
+		for _, p := range r.AllowedPorts {
+			if p == d.port {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return fmt.Sprintf("%s: %s", ConfigPolicyPortError, d)
+		}
+	}
+
+	if d.scheme != "" && !allowedName(r.AllowedSchemes, d.scheme) {
+		return fmt.Sprintf("%s: %s", ConfigPolicySchemeError, d)
+	}
+
+	return ""
+}
+
+// outputDestinationFields lists the fields holding the endpoints of each
+// telegraf output in outputSchemas. Outputs that only write locally or to a
+// fixed cloud API have none.
+var outputDestinationFields = map[string][]string{
+	"cloudwatch":        {"endpoint_url"},
+	"datadog":           {"url"},
+	"discard":           nil,
+	"file":              nil,
+	"graphite":          {"servers"},
+	"http":              {"url"},
+	"influxdb":          {"urls", "url", "http_proxy"},
+	"influxdb_v2":       {"urls", "http_proxy"},
+	"kafka":             {"brokers"},
+	"prometheus_client": nil,
+	"stackdriver":       nil,
+	"wavefront":         {"url", "host"},
+}
+
+// outputDestinations finds the endpoints in the destination fields of an
+// output. The wavefront host is joined with its port field.
+func outputDestinations(output sink.MetricSinkMap) []destination {
+	t, _ := output["type"].(string)
+
+	var values []string
+	for _, field := range outputDestinationFields[t] {
+		switch v := output[field].(type) {
+		case string:
+			if t == "wavefront" && field == "host" {
+				if port, ok := number(output["port"]); ok {
+					v = net.JoinHostPort(v, strconv.Itoa(int(port)))
+				}
+			}
+			values = append(values, v)
+		case []interface{}:
+			for _, e := range v {
+				if s, ok := e.(string); ok {
+					values = append(values, s)
+				}
+			}
+		}
+	}
+
+	var dests []destination
+	for _, v := range values {
+		d, ok := parseDestination(v)
+		if !ok {
+			d = destination{host: v}
+		}
+		dests = append(dests, d)
+	}
+	return dests
+}
+
+// parseDestination reads a URL or a host:port pair. Ports left to the
+// scheme are made explicit for http and https.
+func parseDestination(s string) (destination, bool) {
+	if !strings.Contains(s, "://") {
+		host, port, err := net.SplitHostPort(s)
+		if err != nil {
+			return destination{}, false
+		}
+		p, _ := strconv.Atoi(port)
+		return destination{host: host, port: p}, true
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.Hostname() == "" {
+		return destination{}, false
+	}
+	d := destination{scheme: u.Scheme, host: u.Hostname()}
+	d.port, _ = strconv.Atoi(u.Port())
+	if d.port == 0 {
+		switch u.Scheme {
+		case "https":
+			d.port = 443
+		case "http":
+			d.port = 80
+		}
+	}
+	return d, true
+}
+
+// normalizeHost lowercases the host and writes IP addresses in their
+// canonical form so host patterns see what will be connected to.
+func normalizeHost(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if ip := parseIPHost(host); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
+// parseIPHost parses an IP address, including the IPv4 forms accepted by
+// inet_aton: one to four dot separated parts in decimal, octal with a
+// leading 0 or hexadecimal with a leading 0x, where the last part fills the
+// remaining bytes. It returns nil for hostnames.
+func parseIPHost(host string) net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip
+	}
+
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil
+	}
+	var addr uint64
+	for i, p := range parts {
+		n, ok := parseInetAtonPart(p)
+		if !ok {
+			return nil
+		}
+		max := uint64(0xff)
+		if i == len(parts)-1 {
+			max = 1<<(8*uint(5-len(parts))) - 1
+		}
+		if n > max {
+			return nil
+		}
+		if i == len(parts)-1 {
+			addr = addr<<(8*uint(5-len(parts))) | n
+		} else {
+			addr = addr<<8 | n
+		}
+	}
+	return net.IPv4(byte(addr>>24), byte(addr>>16), byte(addr>>8), byte(addr))
+}
+
+func parseInetAtonPart(p string) (uint64, bool) {
+	base := 10
+	switch {
+	case strings.HasPrefix(p, "0x") || strings.HasPrefix(p, "0X"):
+		base = 16
+		p = p[2:]
+	case len(p) > 1 && p[0] == '0':
+		base = 8
+		p = p[1:]
+	}
+	if p == "" || strings.ContainsAny(p, "+-_") {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(p, base, 32)
+	return n, err == nil
+}
+
+// ipLookup returns a function resolving host at most once. IP addresses are
+// returned without a lookup.
+func (s *Server) ipLookup(host string) func() ([]net.IP, error) {
+	var (
+		once sync.Once
+		ips  []net.IP
+		err  error
+	)
+	return func() ([]net.IP, error) {
+		once.Do(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+			defer cancel()
+			ips, err = s.lookupIPs(ctx, host)
+		})
+		return ips, err
+	}
+}
+
+func (s *Server) lookupIPs(ctx context.Context, host string) ([]net.IP, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if ip := parseIPHost(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	if host == "" {
+		return nil, fmt.Errorf("no host")
+	}
+
+	addrs, err := s.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses for %s", host)
+	}
+
+	ips := make([]net.IP, 0, len(addrs))
+	for _, a := range addrs {
+		ips = append(ips, a.IP)
+	}
+	return ips, nil
+}
+
+func matchesHost(patterns []string, host string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToLower(p), host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func allowedName(allowed []string, name string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
+func canonicalNamespace(ns string) string {
+	if ns == "" {
+		return "default"
+	}
+	return ns
+}
@@ -0,0 +1,407 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/knative/observability/pkg/webhook"
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testPolicy = `
+rules:
+- deniedHosts: ["*.svc", "*.svc.cluster.local", "localhost"]
+  deniedCIDRs: ["10.0.0.0/8", "127.0.0.0/8"]
+- namespaceSelector:
+    matchLabels:
+      tier: restricted
+  allowedHosts: ["*.example.com"]
+  allowedCIDRs: ["192.0.2.0/24"]
+  allowedPorts: [443, 6514]
+  allowedSchemes: ["https"]
+  allowedInputs: ["cpu", "mem"]
+  allowedOutputs: ["http"]
+`
+
+func TestDestinationPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		kind      string
+		resource  string
+		endpoint  string
+		spec      string
+		denial    string
+	}{
+		{
+			name:      "syslog to a public host",
+			namespace: "open",
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			spec:      `{"type": "syslog", "host": "logs.other.com", "port": 514, "enable_tls": true}`,
+		},
+		{
+			name:      "syslog to an in-cluster service",
+			namespace: "open",
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			spec:      `{"type": "syslog", "host": "secrets.kube-system.svc.cluster.local", "port": 514, "enable_tls": true}`,
+			denial:    webhook.ConfigPolicyHostError + ": secrets.kube-system.svc.cluster.local:514",
+		},
+		{
+			name:      "syslog to a denied CIDR",
+			namespace: "open",
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			spec:      `{"type": "syslog", "host": "10.1.2.3", "port": 514, "enable_tls": true}`,
+			denial:    webhook.ConfigPolicyHostError + ": 10.1.2.3:514",
+		},
+		{
+			name:      "syslog to a shortened IP in a denied CIDR",
+			namespace: "open",
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			spec:      `{"type": "syslog", "host": "10.1", "port": 514, "enable_tls": true}`,
+			denial:    webhook.ConfigPolicyHostError + ": 10.1:514",
+		},
+		{
+			name:      "syslog to a decimal IP in a denied CIDR",
+			namespace: "open",
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			spec:      `{"type": "syslog", "host": "167772161", "port": 514, "enable_tls": true}`,
+			denial:    webhook.ConfigPolicyHostError + ": 167772161:514",
+		},
+		{
+			name:      "webhook to a hexadecimal IP in a denied CIDR",
+			namespace: "open",
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			spec:      `{"type": "webhook", "url": "https://0x7f.1/ingest"}`,
+			denial:    webhook.ConfigPolicyHostError + ": https://0x7f.1:443",
+		},
+		{
+			name:      "syslog to an octal IP in a denied CIDR",
+			namespace: "open",
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			spec:      `{"type": "syslog", "host": "0177.0.0.01", "port": 514, "enable_tls": true}`,
+			denial:    webhook.ConfigPolicyHostError + ": 0177.0.0.01:514",
+		},
+		{
+			name:      "syslog to a host resolving into a denied CIDR",
+			namespace: "open",
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			spec:      `{"type": "syslog", "host": "internal.example.net", "port": 514, "enable_tls": true}`,
+			denial:    webhook.ConfigPolicyHostError + ": internal.example.net:514",
+		},
+		{
+			name:      "syslog to a host that does not resolve",
+			namespace: "open",
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			spec:      `{"type": "syslog", "host": "missing.example.net", "port": 514, "enable_tls": true}`,
+			denial:    webhook.ConfigPolicyResolveError + ": missing.example.net:514",
+		},
+		{
+			name:      "ClusterLogSink to an in-cluster service",
+			namespace: "",
+			kind:      "ClusterLogSink",
+			resource:  "clusterlogsinks",
+			endpoint:  "/logsink",
+			spec:      `{"type": "syslog", "host": "collector.logging.svc", "port": 514, "enable_tls": true}`,
+		},
+		{
+			name:      "restricted webhook to an allowed host",
+			namespace: "restricted",
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			spec:      `{"type": "webhook", "url": "https://logs.example.com/ingest"}`,
+		},
+		{
+			name:      "restricted syslog to an allowed IP",
+			namespace: "restricted",
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			spec:      `{"type": "syslog", "host": "192.0.2.10", "port": 6514, "enable_tls": true}`,
+		},
+		{
+			name:      "restricted syslog to a host resolving into an allowed CIDR",
+			namespace: "restricted",
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			spec:      `{"type": "syslog", "host": "logs.partner.net", "port": 6514, "enable_tls": true}`,
+		},
+		{
+			name:      "restricted webhook to another host",
+			namespace: "restricted",
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			spec:      `{"type": "webhook", "url": "https://logs.other.com/ingest"}`,
+			denial:    webhook.ConfigPolicyHostError + ": https://logs.other.com:443",
+		},
+		{
+			name:      "restricted webhook to another port",
+			namespace: "restricted",
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			spec:      `{"type": "webhook", "url": "https://logs.example.com:8443/ingest"}`,
+			denial:    webhook.ConfigPolicyPortError + ": https://logs.example.com:8443",
+		},
+		{
+			name:      "restricted MetricSink with allowed plugins",
+			namespace: "restricted",
+			kind:      "MetricSink",
+			resource:  "metricsinks",
+			endpoint:  "/metricsink",
+			spec: `{
+				"inputs": [{"type": "cpu"}],
+				"outputs": [{"type": "http", "url": "https://metrics.example.com/write", "data_format": "influx"}]
+			}`,
+		},
+		{
+			name:      "restricted MetricSink with another input",
+			namespace: "restricted",
+			kind:      "MetricSink",
+			resource:  "metricsinks",
+			endpoint:  "/metricsink",
+			spec: `{
+				"inputs": [{"type": "disk"}],
+				"outputs": [{"type": "http", "url": "https://metrics.example.com/write", "data_format": "influx"}]
+			}`,
+			denial: webhook.ConfigPolicyPluginError + ": inputs.disk",
+		},
+		{
+			name:      "restricted MetricSink with an http output",
+			namespace: "restricted",
+			kind:      "MetricSink",
+			resource:  "metricsinks",
+			endpoint:  "/metricsink",
+			spec: `{
+				"inputs": [{"type": "cpu"}],
+				"outputs": [{"type": "http", "url": "http://metrics.example.com:443/write", "data_format": "influx"}]
+			}`,
+			denial: webhook.ConfigPolicySchemeError + ": http://metrics.example.com:443",
+		},
+		{
+			name:      "MetricSink output to a denied host",
+			namespace: "open",
+			kind:      "MetricSink",
+			resource:  "metricsinks",
+			endpoint:  "/metricsink",
+			spec: `{
+				"inputs": [{"type": "cpu"}],
+				"outputs": [{"type": "influxdb", "urls": ["http://influxdb.monitoring.svc:8086"]}]
+			}`,
+			denial: webhook.ConfigPolicyHostError + ": http://influxdb.monitoring.svc:8086",
+		},
+		{
+			name:      "MetricSink kafka output to a denied host",
+			namespace: "open",
+			kind:      "MetricSink",
+			resource:  "metricsinks",
+			endpoint:  "/metricsink",
+			spec: `{
+				"inputs": [{"type": "cpu"}],
+				"outputs": [{"type": "kafka", "brokers": ["logs.other.com:9092", "internal.example.net:9092"], "topic": "metrics"}]
+			}`,
+			denial: webhook.ConfigPolicyHostError + ": internal.example.net:9092",
+		},
+		{
+			name:      "MetricSink cloudwatch output to a denied endpoint",
+			namespace: "open",
+			kind:      "MetricSink",
+			resource:  "metricsinks",
+			endpoint:  "/metricsink",
+			spec: `{
+				"inputs": [{"type": "cpu"}],
+				"outputs": [{"type": "cloudwatch", "region": "us-east-1", "endpoint_url": "http://10.0.0.1"}]
+			}`,
+			denial: webhook.ConfigPolicyHostError + ": http://10.0.0.1:80",
+		},
+		{
+			name:      "MetricSink wavefront output to a denied proxy",
+			namespace: "open",
+			kind:      "MetricSink",
+			resource:  "metricsinks",
+			endpoint:  "/metricsink",
+			spec: `{
+				"inputs": [{"type": "cpu"}],
+				"outputs": [{"type": "wavefront", "host": "127.0.0.1", "port": 2878}]
+			}`,
+			denial: webhook.ConfigPolicyHostError + ": 127.0.0.1:2878",
+		},
+		{
+			name:      "MetricSink output without known destinations",
+			namespace: "open",
+			kind:      "MetricSink",
+			resource:  "metricsinks",
+			endpoint:  "/metricsink",
+			spec: `{
+				"inputs": [{"type": "cpu"}],
+				"outputs": [{"type": "opentsdb", "host": "tcp://10.0.0.1"}]
+			}`,
+			denial: webhook.ConfigPolicyPluginError + ": outputs.opentsdb",
+		},
+		{
+			name:      "sink in an unknown namespace",
+			namespace: "missing",
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			spec:      `{"type": "syslog", "host": "logs.other.com", "port": 514, "enable_tls": true}`,
+			denial:    webhook.ConfigPolicyUnavailableError,
+		},
+	}
+
+	p, err := webhook.ParseDestinationPolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := webhook.NewPolicyStore("destination-policy")
+	ps.Set(p)
+
+	server := webhook.NewServer(
+		"127.0.0.1:0",
+		webhook.WithDestinationPolicy(ps, spyNamespaces{
+			"open":       {},
+			"restricted": {"tier": "restricted"},
+		}),
+		webhook.WithHostResolver(spyResolver{
+			"logs.other.com":       {"203.0.113.5"},
+			"logs.example.com":     {"203.0.113.6"},
+			"metrics.example.com":  {"203.0.113.7"},
+			"logs.partner.net":     {"192.0.2.7"},
+			"internal.example.net": {"203.0.113.8", "10.0.0.5"},
+		}),
+	)
+	server.Run(false)
+	defer server.Close()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			object := fmt.Sprintf(`{
+				"metadata": {"name": "sink", "namespace": %q},
+				"spec": %s
+			}`, test.namespace, test.spec)
+			resp := postReview(t, server, test.endpoint, fmt.Sprintf(mutateAdmissionTemplate, test.kind, test.resource, object))
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected http status 200, got %d", resp.StatusCode)
+			}
+			defer resp.Body.Close()
+
+			var review v1beta1.AdmissionReview
+			err := json.NewDecoder(resp.Body).Decode(&review)
+			if err != nil {
+				t.Fatalf("unable to decode resp body: %s", err)
+			}
+
+			if test.denial == "" {
+				if !review.Response.Allowed {
+					t.Errorf("expected response to be allowed, got %v", review.Response.Result)
+				}
+				return
+			}
+			if review.Response.Allowed {
+				t.Fatalf("expected response to be disallowed, got allowed")
+			}
+			if review.Response.Result.Message != test.denial {
+				t.Errorf("expected message %q, got %q", test.denial, review.Response.Result.Message)
+			}
+		})
+	}
+}
+
+func TestParseDestinationPolicy(t *testing.T) {
+	for _, policy := range []string{
+		`rules: [{deniedCIDRs: ["10.0.0.0"]}]`,
+		`rules: [{allowedHosts: ["[a-"]}]`,
+		`rules: [{namespaceSelector: {matchExpressions: [{key: a, operator: Bad}]}}]`,
+		`rules: [{allowedHost: ["example.com"]}]`,
+		`rules: [{probe: always}]`,
+	} {
+		if _, err := webhook.ParseDestinationPolicy([]byte(policy)); err == nil {
+			t.Errorf("expected error for %s", policy)
+		}
+	}
+}
+
+func TestPolicyStore(t *testing.T) {
+	ps := webhook.NewPolicyStore("destination-policy")
+
+	ps.OnAdd(policyConfigMap("other", `rules: [{}]`))
+	if ps.Policy() != nil {
+		t.Errorf("expected other ConfigMaps to be ignored")
+	}
+
+	ps.OnAdd(policyConfigMap("destination-policy", `rules: [{deniedHosts: ["*.svc"]}]`))
+	p := ps.Policy()
+	if p == nil || len(p.Rules) != 1 {
+		t.Fatalf("expected policy with one rule, got %v", p)
+	}
+
+	ps.OnUpdate(nil, policyConfigMap("destination-policy", `rules: [{deniedCIDRs: ["bad"]}]`))
+	if ps.Policy() != p {
+		t.Errorf("expected invalid policy to keep the previous one")
+	}
+
+	ps.OnDelete(policyConfigMap("destination-policy", ""))
+	if ps.Policy() != nil {
+		t.Errorf("expected policy to be removed")
+	}
+}
+
+func policyConfigMap(name, policy string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Data:       map[string]string{webhook.PolicyConfigMapKey: policy},
+	}
+}
+
+type spyResolver map[string][]string
+
+func (s spyResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := s[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	var addrs []net.IPAddr
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+type spyNamespaces map[string]map[string]string
+
+func (s spyNamespaces) Get(name string) (*corev1.Namespace, error) {
+	labels, ok := s[name]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+	}, nil
+}
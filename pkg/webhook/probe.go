@@ -0,0 +1,348 @@
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	sink "github.com/knative/observability/pkg/apis/sink/v1alpha1"
+	"k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ProbeAnnotation asks the validator to probe the destinations of a sink
+// before admitting it. With warn, unreachable destinations are admitted with
+// a warning; with deny, they are rejected. On LogSinks and MetricSinks it
+// only makes probing stricter where the destination policy enables it.
+const ProbeAnnotation = "observability.knative.dev/probe"
+
+const (
+	ProbeWarn = "warn"
+	ProbeDeny = "deny"
+)
+
+// ProbeIgnoredWarning is returned for namespaced sinks with the
+// ProbeAnnotation in namespaces the destination policy does not probe.
+const ProbeIgnoredWarning = "Probe annotation ignored, probing is not enabled by cluster policy for the namespace"
+
+func validProbeMode(mode string) bool {
+	return mode == ProbeWarn || mode == ProbeDeny
+}
+
+// WithDestinationProbe allows sinks to have their destinations probed. Cluster
+// admins enable probing with the probe field of policy rules, or with the
+// ProbeAnnotation on cluster sinks. Syslog destinations get a TCP connection
+// and TLS handshake and webhooks an HTTP HEAD request. Probes never connect
+// to addresses in the denied CIDRs of any policy rule, or without a policy,
+// to the loopback, link-local and private addresses. All probes of a sink
+// share the timeout, which should be well below the timeout of the webhook
+// configuration.
+func WithDestinationProbe(timeout time.Duration) ServerOpt {
+	return func(s *Server) {
+		s.probeTimeout = timeout
+	}
+}
+
+// errProbeDenied is returned when a probe would connect to a denied address.
+var errProbeDenied = errors.New("address denied by cluster policy")
+
+// defaultProbeDeniedNets are denied to probes when no destination policy is
+// loaded. Besides loopback and link-local addresses, they hold the private
+// ranges that pod and service CIDRs are allocated from on most clusters.
+var defaultProbeDeniedNets, _ = parseCIDRs([]string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+})
+
+// probeTarget is a destination to probe. HTTP targets have a URL, others
+// are dialed at the destination host and port.
+type probeTarget struct {
+	dest     destination
+	url      string
+	tls      bool
+	insecure bool
+}
+
+// probeDestinations probes the destinations of an admitted sink when it asks
+// for it. Unreachable destinations deny the sink or are returned as warnings.
+func (s *Server) probeDestinations(rar *v1beta1.AdmissionReview, resp *v1beta1.AdmissionResponse) (*v1beta1.AdmissionResponse, []string) {
+	if s.probeTimeout <= 0 || !resp.Allowed {
+		return resp, nil
+	}
+
+	var obj struct {
+		metav1.ObjectMeta `json:"metadata"`
+		Spec              json.RawMessage `json:"spec"`
+	}
+	if err := json.Unmarshal(rar.Request.Object.Raw, &obj); err != nil {
+		return resp, nil
+	}
+	namespace := obj.Namespace
+	if namespace == "" {
+		namespace = rar.Request.Namespace
+	}
+
+	mode, warning, msg := s.probeMode(rar.Request.Kind.Kind, namespace, obj.Annotations)
+	if msg != "" {
+		return toAdmissionErrorResponse(msg), nil
+	}
+	if warning != "" {
+		return resp, []string{warning}
+	}
+	if mode == "" {
+		return resp, nil
+	}
+
+	var targets []probeTarget
+	switch rar.Request.Kind.Kind {
+	case "LogSink", "ClusterLogSink":
+		var spec sink.SinkSpec
+		if err := json.Unmarshal(obj.Spec, &spec); err != nil {
+			return resp, nil
+		}
+		targets = logSinkTargets(spec)
+	case "MetricSink", "ClusterMetricSink":
+		var spec sink.MetricSinkSpec
+		if err := json.Unmarshal(obj.Spec, &spec); err != nil {
+			return resp, nil
+		}
+		targets = metricSinkTargets(spec)
+	}
+
+	failures := s.probe(targets)
+	if len(failures) == 0 {
+		return resp, nil
+	}
+	if mode == ProbeDeny {
+		return toAdmissionErrorResponse(failures[0]), nil
+	}
+	return resp, failures
+}
+
+// probeMode returns the mode to probe the sink with. Namespaced sinks are
+// probed with the strictest mode of the policy rules of their namespace, and
+// the annotation can only change warn to deny. Cluster sinks are created by
+// cluster admins and are probed when annotated.
+func (s *Server) probeMode(kind, namespace string, annotations map[string]string) (string, string, string) {
+	annotation, ok := annotations[ProbeAnnotation]
+	if ok && !validProbeMode(annotation) {
+		return "", "", ConfigProbeBadModeError
+	}
+	if kind != "LogSink" && kind != "MetricSink" {
+		return annotation, "", ""
+	}
+
+	rules, msg := s.rulesFor(namespace)
+	if msg != "" {
+		return "", "", msg
+	}
+	var mode string
+	for _, r := range rules {
+		if r.Probe == ProbeDeny || mode == "" {
+			mode = r.Probe
+		}
+	}
+	if mode == "" {
+		if ok {
+			return "", ProbeIgnoredWarning, ""
+		}
+		return "", "", ""
+	}
+	if annotation == ProbeDeny {
+		mode = ProbeDeny
+	}
+	return mode, "", ""
+}
+
+func logSinkTargets(spec sink.SinkSpec) []probeTarget {
+	switch spec.Type {
+	case "syslog":
+		return []probeTarget{{
+			dest:     destination{host: spec.Host, port: spec.Port},
+			tls:      spec.EnableTLS,
+			insecure: spec.InsecureSkipVerify,
+		}}
+	case "webhook":
+		d, ok := parseDestination(spec.URL)
+		if !ok {
+			return nil
+		}
+		return []probeTarget{{
+			dest:     d,
+			url:      spec.URL,
+			insecure: spec.InsecureSkipVerify,
+		}}
+	}
+	return nil
+}
+
+// metricSinkTargets probes HTTP outputs with a request to the root of the
+// host and dials outputs with a known port. The TLS settings of other
+// outputs are not known, so they only get a TCP connection.
+func metricSinkTargets(spec sink.MetricSinkSpec) []probeTarget {
+	var targets []probeTarget
+	for _, output := range spec.Outputs {
+		insecure, _ := output["insecure_skip_verify"].(bool)
+		for _, d := range outputDestinations(output) {
+			switch {
+			case d.scheme == "http" || d.scheme == "https":
+				targets = append(targets, probeTarget{
+					dest:     d,
+					url:      d.String() + "/",
+					insecure: insecure,
+				})
+			case d.scheme == "udp" || d.port == 0:
+			default:
+				targets = append(targets, probeTarget{dest: d})
+			}
+		}
+	}
+	return targets
+}
+
+// probe probes the targets concurrently and returns a message for each one
+// that failed, in the order of the targets. The messages only say the
+// destination is unreachable so probes cannot be used to learn about the
+// network of the validator; the causes are logged.
+func (s *Server) probe(targets []probeTarget) []string {
+	ctx, cancel := context.WithTimeout(context.Background(), s.probeTimeout)
+	defer cancel()
+
+	denied := s.probeDeniedNets()
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t probeTarget) {
+			defer wg.Done()
+			errs[i] = s.probeTargetReachable(ctx, t, denied)
+		}(i, t)
+	}
+	wg.Wait()
+
+	var failures []string
+	for i, err := range errs {
+		if err != nil {
+			log.Printf("Probe of %s failed: %s", targets[i].dest, err)
+			failures = append(failures, fmt.Sprintf("%s: %s", ConfigProbeError, targets[i].dest))
+		}
+	}
+	return failures
+}
+
+// probeDeniedNets returns the denied CIDRs of every policy rule, or the
+// default denied CIDRs when no policy is loaded.
+func (s *Server) probeDeniedNets() []*net.IPNet {
+	if s.policy == nil {
+		return defaultProbeDeniedNets
+	}
+	p := s.policy.Policy()
+	if p == nil {
+		return defaultProbeDeniedNets
+	}
+
+	var nets []*net.IPNet
+	for _, r := range p.Rules {
+		nets = append(nets, r.deniedNets...)
+	}
+	return nets
+}
+
+// probeTargetReachable treats any HTTP response as reachable, since many
+// endpoints reject HEAD requests without credentials.
+func (s *Server) probeTargetReachable(ctx context.Context, t probeTarget, denied []*net.IPNet) error {
+	tlsConfig := &tls.Config{
+		ServerName:         t.dest.host,
+		InsecureSkipVerify: t.insecure,
+	}
+
+	if t.url != "" {
+		req, err := http.NewRequest(http.MethodHead, t.url, nil)
+		if err != nil {
+			return err
+		}
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return s.dialProbe(ctx, addr, denied)
+			},
+			TLSClientConfig:   tlsConfig,
+			DisableKeepAlives: true,
+		}
+		client := &http.Client{
+			Transport: transport,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			// The URL may hold credentials, so only the cause is returned.
+			if uerr, ok := err.(*url.Error); ok {
+				return uerr.Err
+			}
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	conn, err := s.dialProbe(ctx, net.JoinHostPort(t.dest.host, strconv.Itoa(t.dest.port)), denied)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if !t.tls {
+		return nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return tls.Client(conn, tlsConfig).Handshake()
+}
+
+// dialProbe resolves the host of addr and dials the resolved addresses, so
+// the connection goes to the addresses that were checked against the denied
+// CIDRs. No address is dialed when any of them is denied.
+func (s *Server) dialProbe(ctx context.Context, addr string, denied []*net.IPNet) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := s.lookupIPs(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if containsIP(denied, ip) {
+			return nil, errProbeDenied
+		}
+	}
+
+	var d net.Dialer
+	for _, ip := range ips {
+		var conn net.Conn
+		conn, err = d.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
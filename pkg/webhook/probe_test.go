@@ -0,0 +1,396 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/knative/observability/pkg/webhook"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDestinationProbe(t *testing.T) {
+	methods := make(chan string, 100)
+	reachable := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods <- r.Method
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	defer reachable.Close()
+	reachableHost, reachablePort, _ := net.SplitHostPort(reachable.Listener.Addr().String())
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := lis.Addr().String()
+	lis.Close()
+	unreachableHost, unreachablePort, _ := net.SplitHostPort(unreachable)
+
+	syslog := func(host, port string, insecure bool) string {
+		return fmt.Sprintf(`{"type": "syslog", "host": %q, "port": %s, "enable_tls": true, "insecure_skip_verify": %t}`, host, port, insecure)
+	}
+	webhookSpec := func(url string) string {
+		return fmt.Sprintf(`{"type": "webhook", "url": %q, "insecure_skip_verify": true}`, url)
+	}
+
+	p, err := webhook.ParseDestinationPolicy([]byte(`
+rules:
+- namespaceSelector:
+    matchLabels:
+      probe: deny
+  probe: deny
+- namespaceSelector:
+    matchLabels:
+      probe: warn
+  probe: warn
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := webhook.NewPolicyStore("destination-policy")
+	ps.Set(p)
+
+	tests := []struct {
+		name       string
+		kind       string
+		resource   string
+		endpoint   string
+		namespace  string
+		annotation string
+		spec       string
+		denial     string
+		warning    string
+	}{
+		{
+			name:      "reachable syslog",
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			namespace: "probed",
+			spec:      syslog(reachableHost, reachablePort, true),
+		},
+		{
+			name:      "unreachable syslog",
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			namespace: "probed",
+			spec:      syslog(unreachableHost, unreachablePort, true),
+			denial:    webhook.ConfigProbeError + ": " + unreachable,
+		},
+		{
+			name:      "syslog with an untrusted certificate",
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			namespace: "probed",
+			spec:      syslog(reachableHost, reachablePort, false),
+			denial:    webhook.ConfigProbeError + ": " + reachable.Listener.Addr().String(),
+		},
+		{
+			name:      "unreachable syslog without probing",
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			namespace: "open",
+			spec:      syslog(unreachableHost, unreachablePort, true),
+		},
+		{
+			name:       "annotated syslog without probing",
+			kind:       "LogSink",
+			resource:   "logsinks",
+			endpoint:   "/logsink",
+			namespace:  "open",
+			annotation: webhook.ProbeDeny,
+			spec:       syslog(unreachableHost, unreachablePort, true),
+			warning:    webhook.ProbeIgnoredWarning,
+		},
+		{
+			name:      "unreachable syslog with warnings",
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			namespace: "warned",
+			spec:      syslog(unreachableHost, unreachablePort, true),
+			warning:   webhook.ConfigProbeError + ": " + unreachable,
+		},
+		{
+			name:       "unreachable syslog annotated to deny",
+			kind:       "LogSink",
+			resource:   "logsinks",
+			endpoint:   "/logsink",
+			namespace:  "warned",
+			annotation: webhook.ProbeDeny,
+			spec:       syslog(unreachableHost, unreachablePort, true),
+			denial:     webhook.ConfigProbeError + ": " + unreachable,
+		},
+		{
+			name:       "unreachable syslog annotated to warn",
+			kind:       "LogSink",
+			resource:   "logsinks",
+			endpoint:   "/logsink",
+			namespace:  "probed",
+			annotation: webhook.ProbeWarn,
+			spec:       syslog(unreachableHost, unreachablePort, true),
+			denial:     webhook.ConfigProbeError + ": " + unreachable,
+		},
+		{
+			name:       "unreachable ClusterLogSink",
+			kind:       "ClusterLogSink",
+			resource:   "clusterlogsinks",
+			endpoint:   "/logsink",
+			annotation: webhook.ProbeDeny,
+			spec:       syslog(unreachableHost, unreachablePort, true),
+			denial:     webhook.ConfigProbeError + ": " + unreachable,
+		},
+		{
+			name:      "reachable webhook",
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			namespace: "probed",
+			spec:      webhookSpec(reachable.URL + "/logs?token=secret"),
+		},
+		{
+			name:      "unreachable webhook",
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			namespace: "warned",
+			spec:      webhookSpec("https://" + unreachable + "/logs?token=secret"),
+			warning:   webhook.ConfigProbeError + ": https://" + unreachable,
+		},
+		{
+			name:      "unreachable metric output",
+			kind:      "MetricSink",
+			resource:  "metricsinks",
+			endpoint:  "/metricsink",
+			namespace: "warned",
+			spec:      fmt.Sprintf(`{"inputs": [{"type": "cpu"}], "outputs": [{"type": "influxdb", "urls": ["http://%s"]}]}`, unreachable),
+			warning:   webhook.ConfigProbeError + ": http://" + unreachable,
+		},
+		{
+			name:       "bad annotation",
+			kind:       "LogSink",
+			resource:   "logsinks",
+			endpoint:   "/logsink",
+			namespace:  "open",
+			annotation: "always",
+			spec:       syslog(reachableHost, reachablePort, true),
+			denial:     webhook.ConfigProbeBadModeError,
+		},
+	}
+
+	server := webhook.NewServer(
+		"127.0.0.1:0",
+		webhook.WithDestinationProbe(2*time.Second),
+		webhook.WithDestinationPolicy(ps, spyNamespaces{
+			"open":   {},
+			"probed": {"probe": "deny"},
+			"warned": {"probe": "warn"},
+		}),
+	)
+	server.Run(false)
+	defer server.Close()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var annotations map[string]string
+			if test.annotation != "" {
+				annotations = map[string]string{webhook.ProbeAnnotation: test.annotation}
+			}
+			meta, err := json.Marshal(metav1.ObjectMeta{
+				Name:        "sink",
+				Namespace:   test.namespace,
+				Annotations: annotations,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			object := fmt.Sprintf(`{"metadata": %s, "spec": %s}`, meta, test.spec)
+
+			review := postProbeReview(t, server, test.endpoint, fmt.Sprintf(mutateAdmissionTemplate, test.kind, test.resource, object))
+
+			if test.denial != "" {
+				if review.Response.Allowed {
+					t.Fatalf("expected response to be disallowed, got allowed")
+				}
+				if review.Response.Result.Message != test.denial {
+					t.Errorf("expected message %q, got %q", test.denial, review.Response.Result.Message)
+				}
+				return
+			}
+
+			if !review.Response.Allowed {
+				t.Fatalf("expected response to be allowed, got %v", review.Response.Result)
+			}
+			if test.warning == "" {
+				if len(review.Response.Warnings) != 0 {
+					t.Errorf("expected no warnings, got %v", review.Response.Warnings)
+				}
+				return
+			}
+			if len(review.Response.Warnings) != 1 || review.Response.Warnings[0] != test.warning {
+				t.Fatalf("expected warning %q, got %v", test.warning, review.Response.Warnings)
+			}
+			if strings.Contains(review.Response.Warnings[0], "secret") {
+				t.Errorf("expected the warning not to include the URL, got %q", review.Response.Warnings[0])
+			}
+		})
+	}
+
+	select {
+	case m := <-methods:
+		if m != http.MethodHead {
+			t.Errorf("expected webhooks to be probed with HEAD, got %s", m)
+		}
+	default:
+		t.Errorf("expected the reachable webhook to be probed")
+	}
+}
+
+func TestDestinationProbeDeniedCIDRs(t *testing.T) {
+	requests := make(chan string, 100)
+	reachable := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r.Host
+	}))
+	defer reachable.Close()
+	_, port, _ := net.SplitHostPort(reachable.Listener.Addr().String())
+
+	p, err := webhook.ParseDestinationPolicy([]byte(`
+rules:
+- namespaceSelector:
+    matchLabels:
+      tier: internal
+  deniedCIDRs: ["127.0.0.2/32"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := webhook.NewPolicyStore("destination-policy")
+	ps.Set(p)
+
+	server := webhook.NewServer(
+		"127.0.0.1:0",
+		webhook.WithDestinationProbe(2*time.Second),
+		webhook.WithDestinationPolicy(ps, spyNamespaces{}),
+		webhook.WithHostResolver(spyResolver{
+			"logs.example.net":     {"127.0.0.1"},
+			"internal.example.net": {"127.0.0.1", "127.0.0.2"},
+		}),
+	)
+	server.Run(false)
+	defer server.Close()
+
+	probe := func(host string) probeReview {
+		object := fmt.Sprintf(`{
+			"metadata": {"name": "sink", "annotations": {%q: "deny"}},
+			"spec": {"type": "webhook", "url": "https://%s:%s/", "insecure_skip_verify": true}
+		}`, webhook.ProbeAnnotation, host, port)
+		return postProbeReview(t, server, "/logsink", fmt.Sprintf(mutateAdmissionTemplate, "ClusterLogSink", "clusterlogsinks", object))
+	}
+
+	review := probe("logs.example.net")
+	if !review.Response.Allowed {
+		t.Fatalf("expected the resolved address to be probed, got %v", review.Response.Result)
+	}
+	if h := <-requests; h != "logs.example.net:"+port {
+		t.Errorf("expected the request to keep the host name, got %q", h)
+	}
+
+	review = probe("internal.example.net")
+	if review.Response.Allowed {
+		t.Fatal("expected a host resolving into a denied CIDR to be unreachable, got allowed")
+	}
+	expected := webhook.ConfigProbeError + ": https://internal.example.net:" + port
+	if review.Response.Result.Message != expected {
+		t.Errorf("expected message %q, got %q", expected, review.Response.Result.Message)
+	}
+	select {
+	case h := <-requests:
+		t.Errorf("expected no request to a denied host, got one for %q", h)
+	default:
+	}
+}
+
+func TestDestinationProbeWithoutPolicy(t *testing.T) {
+	requests := make(chan string, 100)
+	reachable := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r.Host
+	}))
+	defer reachable.Close()
+
+	server := webhook.NewServer(
+		"127.0.0.1:0",
+		webhook.WithDestinationProbe(2*time.Second),
+	)
+	server.Run(false)
+	defer server.Close()
+
+	object := fmt.Sprintf(`{
+		"metadata": {"name": "sink", "annotations": {%q: "deny"}},
+		"spec": {"type": "webhook", "url": %q, "insecure_skip_verify": true}
+	}`, webhook.ProbeAnnotation, reachable.URL)
+	review := postProbeReview(t, server, "/logsink", fmt.Sprintf(mutateAdmissionTemplate, "ClusterLogSink", "clusterlogsinks", object))
+
+	if review.Response.Allowed {
+		t.Fatal("expected a loopback destination to be unreachable without a policy, got allowed")
+	}
+	select {
+	case h := <-requests:
+		t.Errorf("expected no request to a loopback address, got one for %q", h)
+	default:
+	}
+}
+
+func TestDestinationProbeDisabled(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := lis.Addr().String()
+	lis.Close()
+
+	server := webhook.NewServer("127.0.0.1:0")
+	server.Run(false)
+	defer server.Close()
+
+	object := fmt.Sprintf(`{
+		"metadata": {"name": "sink", "annotations": {%q: "deny"}},
+		"spec": {"type": "webhook", "url": "https://%s"}
+	}`, webhook.ProbeAnnotation, unreachable)
+	review := postProbeReview(t, server, "/logsink", fmt.Sprintf(mutateAdmissionTemplate, "LogSink", "logsinks", object))
+
+	if !review.Response.Allowed {
+		t.Errorf("expected sinks not to be probed without the option, got %v", review.Response.Result)
+	}
+}
+
+type probeReview struct {
+	Response struct {
+		Allowed  bool           `json:"allowed"`
+		Result   *metav1.Status `json:"status"`
+		Warnings []string       `json:"warnings"`
+	} `json:"response"`
+}
+
+func postProbeReview(t *testing.T, server *webhook.Server, path, body string) probeReview {
+	t.Helper()
+
+	resp := postReview(t, server, path, body)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected http status 200, got %d", resp.StatusCode)
+	}
+
+	var review probeReview
+	if err := json.NewDecoder(resp.Body).Decode(&review); err != nil {
+		t.Fatalf("unable to decode resp body: %s", err)
+	}
+	return review
+}
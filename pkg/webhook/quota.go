@@ -0,0 +1,106 @@
+package webhook
+
+import (
+	"fmt"
+	"log"
+
+	sinklisters "github.com/knative/observability/pkg/client/listers/sink/v1alpha1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// SinkQuota limits how many LogSinks and MetricSinks tenants may create.
+// Every LogSink adds an output to the shared fluent-bit config and every
+// MetricSink runs its own telegraf Deployment. The cluster limits count
+// sinks across all namespaces; cluster sinks are not counted. Zero means
+// unlimited.
+type SinkQuota struct {
+	LogSinksPerNamespace    int
+	MetricSinksPerNamespace int
+	LogSinks                int
+	MetricSinks             int
+}
+
+type quota struct {
+	SinkQuota
+	logSinks    sinklisters.LogSinkLister
+	metricSinks sinklisters.MetricSinkLister
+}
+
+// WithSinkQuota rejects new LogSinks and MetricSinks beyond the quota. Usage
+// is counted from the listers, so sinks created faster than the informer
+// caches sync may briefly exceed it.
+func WithSinkQuota(q SinkQuota, logSinks sinklisters.LogSinkLister, metricSinks sinklisters.MetricSinkLister) ServerOpt {
+	return func(s *Server) {
+		s.quota = &quota{
+			SinkQuota:   q,
+			logSinks:    logSinks,
+			metricSinks: metricSinks,
+		}
+	}
+}
+
+// checkLogSinkQuota returns a denial message if creating another LogSink in
+// the namespace would exceed the quota.
+func (s *Server) checkLogSinkQuota(namespace string) string {
+	if s.quota == nil {
+		return ""
+	}
+	q := s.quota
+
+	count := func(ns string) (int, error) {
+		if ns == "" {
+			sinks, err := q.logSinks.List(labels.Everything())
+			return len(sinks), err
+		}
+		sinks, err := q.logSinks.LogSinks(ns).List(labels.Everything())
+		return len(sinks), err
+	}
+	return checkQuota(ConfigQuotaLogSinkError, "LogSinks", canonicalNamespace(namespace), q.LogSinksPerNamespace, q.LogSinks, count)
+}
+
+// checkMetricSinkQuota returns a denial message if creating another
+// MetricSink in the namespace would exceed the quota.
+func (s *Server) checkMetricSinkQuota(namespace string) string {
+	if s.quota == nil {
+		return ""
+	}
+	q := s.quota
+
+	count := func(ns string) (int, error) {
+		if ns == "" {
+			sinks, err := q.metricSinks.List(labels.Everything())
+			return len(sinks), err
+		}
+		sinks, err := q.metricSinks.MetricSinks(ns).List(labels.Everything())
+		return len(sinks), err
+	}
+	return checkQuota(ConfigQuotaMetricSinkError, "MetricSinks", canonicalNamespace(namespace), q.MetricSinksPerNamespace, q.MetricSinks, count)
+}
+
+// checkQuota compares the sinks counted in the namespace, and in all
+// namespaces when count is given "", against the limits.
+func checkQuota(msg, kind, namespace string, namespaceLimit, clusterLimit int, count func(string) (int, error)) string {
+	if namespaceLimit > 0 {
+		n, err := count(namespace)
+		if err != nil {
+			log.Printf("Unable to count %s in %s: %s", kind, namespace, err)
+			return ConfigQuotaUnavailableError
+		}
+		if n >= namespaceLimit {
+			return fmt.Sprintf("%s: namespace %s has %d of %d %s", msg, namespace, n, namespaceLimit, kind)
+		}
+	}
+
+	if clusterLimit > 0 {
+		n, err := count("")
+		if err != nil {
+			log.Printf("Unable to count %s: %s", kind, err)
+			return ConfigQuotaUnavailableError
+		}
+		if n >= clusterLimit {
+			return fmt.Sprintf("%s: cluster has %d of %d %s", msg, n, clusterLimit, kind)
+		}
+	}
+
+	return ""
+}
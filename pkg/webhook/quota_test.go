@@ -0,0 +1,180 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	sink "github.com/knative/observability/pkg/apis/sink/v1alpha1"
+	sinklisters "github.com/knative/observability/pkg/client/listers/sink/v1alpha1"
+	"github.com/knative/observability/pkg/webhook"
+	"k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestSinkQuota(t *testing.T) {
+	logSinks := newIndexer()
+	metricSinks := newIndexer()
+	for i := 0; i < 2; i++ {
+		logSinks.Add(&sink.LogSink{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprint("sink-", i), Namespace: "full-ns"}})
+		metricSinks.Add(&sink.MetricSink{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprint("sink-", i), Namespace: "full-ns"}})
+	}
+	logSinks.Add(&sink.LogSink{ObjectMeta: metav1.ObjectMeta{Name: "sink", Namespace: "other-ns"}})
+
+	logSinkSpec := `{"type": "syslog", "host": "example.com", "port": 514, "enable_tls": true}`
+	metricSinkSpec := `{"inputs": [{"type": "cpu"}], "outputs": [{"type": "discard"}]}`
+
+	tests := []struct {
+		name      string
+		quota     webhook.SinkQuota
+		kind      string
+		resource  string
+		endpoint  string
+		namespace string
+		operation string
+		spec      string
+		denial    string
+	}{
+		{
+			name:      "LogSink under the namespace quota",
+			quota:     webhook.SinkQuota{LogSinksPerNamespace: 2},
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			namespace: "other-ns",
+			operation: "CREATE",
+			spec:      logSinkSpec,
+		},
+		{
+			name:      "LogSink over the namespace quota",
+			quota:     webhook.SinkQuota{LogSinksPerNamespace: 2},
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			namespace: "full-ns",
+			operation: "CREATE",
+			spec:      logSinkSpec,
+			denial:    webhook.ConfigQuotaLogSinkError + ": namespace full-ns has 2 of 2 LogSinks",
+		},
+		{
+			name:      "LogSink update over the namespace quota",
+			quota:     webhook.SinkQuota{LogSinksPerNamespace: 2},
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			namespace: "full-ns",
+			operation: "UPDATE",
+			spec:      logSinkSpec,
+		},
+		{
+			name:      "LogSink over the cluster quota",
+			quota:     webhook.SinkQuota{LogSinksPerNamespace: 5, LogSinks: 3},
+			kind:      "LogSink",
+			resource:  "logsinks",
+			endpoint:  "/logsink",
+			namespace: "new-ns",
+			operation: "CREATE",
+			spec:      logSinkSpec,
+			denial:    webhook.ConfigQuotaLogSinkError + ": cluster has 3 of 3 LogSinks",
+		},
+		{
+			name:      "ClusterLogSink over the cluster quota",
+			quota:     webhook.SinkQuota{LogSinks: 3},
+			kind:      "ClusterLogSink",
+			resource:  "clusterlogsinks",
+			endpoint:  "/logsink",
+			operation: "CREATE",
+			spec:      logSinkSpec,
+		},
+		{
+			name:      "MetricSink over the namespace quota",
+			quota:     webhook.SinkQuota{MetricSinksPerNamespace: 2},
+			kind:      "MetricSink",
+			resource:  "metricsinks",
+			endpoint:  "/metricsink",
+			namespace: "full-ns",
+			operation: "CREATE",
+			spec:      metricSinkSpec,
+			denial:    webhook.ConfigQuotaMetricSinkError + ": namespace full-ns has 2 of 2 MetricSinks",
+		},
+		{
+			name:      "MetricSink under the cluster quota",
+			quota:     webhook.SinkQuota{MetricSinks: 3},
+			kind:      "MetricSink",
+			resource:  "metricsinks",
+			endpoint:  "/metricsink",
+			namespace: "other-ns",
+			operation: "CREATE",
+			spec:      metricSinkSpec,
+		},
+		{
+			name:      "MetricSink over the cluster quota",
+			quota:     webhook.SinkQuota{MetricSinks: 2},
+			kind:      "MetricSink",
+			resource:  "metricsinks",
+			endpoint:  "/metricsink",
+			namespace: "other-ns",
+			operation: "CREATE",
+			spec:      metricSinkSpec,
+			denial:    webhook.ConfigQuotaMetricSinkError + ": cluster has 2 of 2 MetricSinks",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := webhook.NewServer(
+				"127.0.0.1:0",
+				webhook.WithSinkQuota(
+					test.quota,
+					sinklisters.NewLogSinkLister(logSinks),
+					sinklisters.NewMetricSinkLister(metricSinks),
+				),
+			)
+			server.Run(false)
+			defer server.Close()
+
+			object := fmt.Sprintf(`{
+				"metadata": {"name": "new-sink", "namespace": %q},
+				"spec": %s
+			}`, test.namespace, test.spec)
+			body := fmt.Sprintf(mutateAdmissionTemplate, test.kind, test.resource, object)
+			if test.operation == "UPDATE" {
+				body = strings.Replace(body, `"operation": "CREATE",`, fmt.Sprintf(`"operation": "UPDATE", "oldObject": %s,`, object), 1)
+			}
+
+			resp := postReview(t, server, test.endpoint, body)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected http status 200, got %d", resp.StatusCode)
+			}
+			defer resp.Body.Close()
+
+			var review v1beta1.AdmissionReview
+			err := json.NewDecoder(resp.Body).Decode(&review)
+			if err != nil {
+				t.Fatalf("unable to decode resp body: %s", err)
+			}
+
+			if test.denial == "" {
+				if !review.Response.Allowed {
+					t.Errorf("expected response to be allowed, got %v", review.Response.Result)
+				}
+				return
+			}
+			if review.Response.Allowed {
+				t.Fatalf("expected response to be disallowed, got allowed")
+			}
+			if review.Response.Result.Message != test.denial {
+				t.Errorf("expected message %q, got %q", test.denial, review.Response.Result.Message)
+			}
+		})
+	}
+}
+
+func newIndexer() cache.Indexer {
+	return cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+	})
+}
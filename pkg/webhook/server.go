@@ -4,17 +4,20 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
-	"os/exec"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
 
 	sink "github.com/knative/observability/pkg/apis/sink/v1alpha1"
 	"github.com/knative/observability/pkg/metric"
+	logsink "github.com/knative/observability/pkg/sink"
+	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/api/admission/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -33,6 +36,31 @@ const (
 	ConfigWebhookInsecureError     = "Insecure webhook not allowed, scheme must be https"
 	ConfigMetricNoTypeError        = "Must specify type for each inputs/outputs"
 	ConfigMetricNonStringTypeError = "Input/output type must be a string"
+	ConfigMultilineClusterError    = "Multiline is only supported on LogSink"
+	ConfigMultilineBadPresetError  = "Multiline preset invalid, should be one of go, java, python or ruby"
+	ConfigMultilineBadRegexError   = "Multiline regex invalid"
+	ConfigParserClusterError       = "Parser is only supported on LogSink"
+	ConfigParserBadNameError       = "Parser name invalid"
+	ConfigParserBadFormatError     = "Parser format invalid, should be one of regex, json, logfmt or ltsv"
+	ConfigParserBadRegexError      = "Parser regex invalid, must compile and contain a named capture"
+	ConfigParserBadFieldError      = "Parser fields must not contain control characters"
+	ConfigPodParserNamespaceError  = "Parser annotation must reference a parser in the namespace of the pod"
+	ConfigPolicyHostError          = "Destination host not allowed by cluster policy"
+	ConfigPolicyPortError          = "Destination port not allowed by cluster policy"
+	ConfigPolicySchemeError        = "Destination scheme not allowed by cluster policy"
+	ConfigPolicyPluginError        = "Plugin type not allowed by cluster policy"
+	ConfigPolicyUnavailableError   = "Unable to evaluate cluster policy for namespace"
+	ConfigPolicyResolveError       = "Destination host could not be resolved for cluster policy"
+	ConfigQuotaLogSinkError        = "LogSink quota exceeded"
+	ConfigQuotaMetricSinkError     = "MetricSink quota exceeded"
+	ConfigQuotaUnavailableError    = "Unable to check sink quota"
+	ConfigProbeError               = "Destination unreachable"
+	ConfigProbeBadModeError        = "Probe annotation invalid, should be warn or deny"
+)
+
+const (
+	admissionV1      = "admission.k8s.io/v1"
+	admissionV1beta1 = "admission.k8s.io/v1beta1"
 )
 
 type ServerOpt func(*Server)
@@ -44,17 +72,39 @@ type Server struct {
 
 	addr      string
 	tlsConfig *tls.Config
+
+	telegrafPath    string
+	telegrafTimeout time.Duration
+	telegrafSem     chan struct{}
+
+	policy     *PolicyStore
+	namespaces NamespaceGetter
+	resolver   HostResolver
+
+	quota *quota
+
+	probeTimeout time.Duration
+
+	metrics *metrics
+	audit   *auditLog
 }
 
 func NewServer(addr string, options ...ServerOpt) *Server {
 	s := &Server{
-		addr: addr,
+		addr:            addr,
+		telegrafTimeout: 5 * time.Second,
+		telegrafSem:     make(chan struct{}, 4),
+		resolver:        net.DefaultResolver,
 	}
 
 	for _, o := range options {
 		o(s)
 	}
 
+	if s.metrics == nil {
+		s.metrics = newMetrics(prometheus.NewRegistry())
+	}
+
 	return s
 }
 
@@ -64,6 +114,42 @@ func WithTLSConfig(tlsConfig *tls.Config) ServerOpt {
 	}
 }
 
+// WithTelegrafBinary additionally validates metric sinks by running the
+// telegraf binary at path against the rendered config.
+func WithTelegrafBinary(path string) ServerOpt {
+	return func(s *Server) {
+		s.telegrafPath = path
+	}
+}
+
+// WithTelegrafTimeout bounds how long validating a metric sink may take,
+// from the policy and quota checks through waiting for and running telegraf.
+// It should be shorter than the timeout of the webhook configuration.
+func WithTelegrafTimeout(d time.Duration) ServerOpt {
+	return func(s *Server) {
+		s.telegrafTimeout = d
+	}
+}
+
+// WithTelegrafConcurrency limits how many telegraf runs happen at once.
+func WithTelegrafConcurrency(n int) ServerOpt {
+	if n < 1 {
+		n = 1
+	}
+	return func(s *Server) {
+		s.telegrafSem = make(chan struct{}, n)
+	}
+}
+
+// WithDestinationPolicy restricts the destinations of LogSinks and
+// MetricSinks to those allowed by the policy for their namespace.
+func WithDestinationPolicy(ps *PolicyStore, namespaces NamespaceGetter) ServerOpt {
+	return func(s *Server) {
+		s.policy = ps
+		s.namespaces = namespaces
+	}
+}
+
 func (s *Server) Run(blocking bool) {
 	if blocking {
 		s.run()
@@ -109,8 +195,11 @@ func (s *Server) run() {
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", healthHandler)
-	mux.HandleFunc("/metricsink", metricSinkHandler)
-	mux.HandleFunc("/logsink", logSinkHandler)
+	mux.HandleFunc("/metricsink", s.instrument("/metricsink", s.metricSinkHandler))
+	mux.HandleFunc("/logsink", s.instrument("/logsink", s.logSinkHandler))
+	mux.HandleFunc("/logparser", s.instrument("/logparser", s.logParserHandler))
+	mux.HandleFunc("/pod", s.instrument("/pod", s.podHandler))
+	mux.HandleFunc("/mutate", s.instrument("/mutate", s.mutateHandler))
 
 	s.mu.Lock()
 	s.lis = lis
@@ -136,30 +225,54 @@ var codecs = serializer.NewCodecFactory(scheme)
 
 func healthHandler(_ http.ResponseWriter, _ *http.Request) {}
 
-func metricSinkHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) metricSinkHandler(w http.ResponseWriter, r *http.Request) {
 	requestedAdmissionReview, httpErr := deserializeReview(r)
 	if httpErr != nil {
 		httpErr.Write(w)
 		return
 	}
 
-	var cms sink.ClusterMetricSink
-	err := json.Unmarshal(requestedAdmissionReview.Request.Object.Raw, &cms)
-	if err != nil {
-		errUnableToDeserialize.Write(w)
-		return
-	}
+	// The telegraf timeout covers the whole validation, including the policy
+	// and quota lookups and waiting for a telegraf slot.
+	ctx, cancel := context.WithTimeout(r.Context(), s.telegrafTimeout)
+	defer cancel()
 
-	resp, httpErr := validateMetricSinkConfig(*requestedAdmissionReview, cms)
+	var (
+		resp     *v1beta1.AdmissionResponse
+		warnings []string
+	)
+	switch requestedAdmissionReview.Request.Kind.Kind {
+	case "MetricSink":
+		var ms sink.MetricSink
+		err := json.Unmarshal(requestedAdmissionReview.Request.Object.Raw, &ms)
+		if err != nil {
+			errUnableToDeserialize.Write(w)
+			return
+		}
+		resp, httpErr = s.validateNamespacedMetricSinkConfig(ctx, *requestedAdmissionReview, ms)
+		warnings = unknownTelegrafPlugins(ms.Spec)
+	case "ClusterMetricSink":
+		var cms sink.ClusterMetricSink
+		err := json.Unmarshal(requestedAdmissionReview.Request.Object.Raw, &cms)
+		if err != nil {
+			errUnableToDeserialize.Write(w)
+			return
+		}
+		resp, httpErr = s.validateMetricSinkConfig(ctx, *requestedAdmissionReview, cms)
+		warnings = unknownTelegrafPlugins(cms.Spec)
+	default:
+		httpErr = errInvalidRequest
+	}
 	if httpErr != nil {
 		httpErr.Write(w)
 		return
 	}
-
-	err = json.NewEncoder(w).Encode(&v1beta1.AdmissionReview{Response: resp})
-	if err != nil {
-		log.Printf("Unable to marshal resp: %s", err)
+	if !resp.Allowed {
+		warnings = nil
 	}
+
+	resp, probeWarnings := s.probeDestinations(requestedAdmissionReview, resp)
+	s.writeReview(w, r, requestedAdmissionReview, resp, append(warnings, probeWarnings...)...)
 }
 
 func toAdmissionErrorResponse(err string) *v1beta1.AdmissionResponse {
@@ -170,24 +283,23 @@ func toAdmissionErrorResponse(err string) *v1beta1.AdmissionResponse {
 	}
 }
 
-func logSinkHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) logSinkHandler(w http.ResponseWriter, r *http.Request) {
 	requestedAdmissionReview, httpErr := deserializeReview(r)
 	if httpErr != nil {
 		httpErr.Write(w)
 		return
 	}
-	resp, err := validateLogSinkConfigRequest(requestedAdmissionReview)
+	resp, err := s.validateLogSinkConfigRequest(requestedAdmissionReview)
 	if err != nil {
 		errUnableToDeserialize.Write(w)
+		return
 	}
 
-	err = json.NewEncoder(w).Encode(&v1beta1.AdmissionReview{Response: resp})
-	if err != nil {
-		log.Printf("Unable to marshal resp: %s", err)
-	}
+	resp, warnings := s.probeDestinations(requestedAdmissionReview, resp)
+	s.writeReview(w, r, requestedAdmissionReview, resp, warnings...)
 }
 
-func validateLogSinkConfigRequest(rar *v1beta1.AdmissionReview) (*v1beta1.AdmissionResponse, error) {
+func (s *Server) validateLogSinkConfigRequest(rar *v1beta1.AdmissionReview) (*v1beta1.AdmissionResponse, error) {
 	var cls sink.ClusterLogSink
 	err := json.Unmarshal(rar.Request.Object.Raw, &cls)
 	if err != nil {
@@ -226,58 +338,294 @@ func validateLogSinkConfigRequest(rar *v1beta1.AdmissionReview) (*v1beta1.Admiss
 	default:
 		return toAdmissionErrorResponse(ConfigLogNoTypeError), nil
 	}
+
+	if cls.Spec.Multiline != nil {
+		if msg := validateMultiline(rar.Request.Kind.Kind, cls.Spec.Multiline); msg != "" {
+			return toAdmissionErrorResponse(msg), nil
+		}
+	}
+
+	if cls.Spec.Parser != "" {
+		if rar.Request.Kind.Kind == "ClusterLogSink" {
+			return toAdmissionErrorResponse(ConfigParserClusterError), nil
+		}
+		if strings.Contains(cls.Spec.Parser, " ") || logsink.HasControlCharacter(cls.Spec.Parser) {
+			return toAdmissionErrorResponse(ConfigParserBadNameError), nil
+		}
+	}
+
+	if rar.Request.Kind.Kind == "LogSink" {
+		namespace := cls.Namespace
+		if namespace == "" {
+			namespace = rar.Request.Namespace
+		}
+		if msg := s.checkLogSinkPolicy(namespace, cls.Spec); msg != "" {
+			return toAdmissionErrorResponse(msg), nil
+		}
+		if rar.Request.Operation == "CREATE" {
+			if msg := s.checkLogSinkQuota(namespace); msg != "" {
+				return toAdmissionErrorResponse(msg), nil
+			}
+		}
+	}
+
 	return &v1beta1.AdmissionResponse{
 		UID:     rar.Request.UID,
 		Allowed: true,
 	}, nil
 }
 
-func validRequest(r v1beta1.AdmissionReview) bool {
-	return r.Request != nil
+func validateMultiline(kind string, m *sink.MultilineSpec) string {
+	if kind == "ClusterLogSink" {
+		return ConfigMultilineClusterError
+	}
+
+	for _, p := range m.Presets {
+		if !logsink.IsMultilinePreset(p) {
+			return ConfigMultilineBadPresetError
+		}
+	}
+
+	if m.StartRegex == "" && m.ContinueRegex != "" {
+		return ConfigMultilineBadRegexError
+	}
+	for _, r := range []string{m.StartRegex, m.ContinueRegex} {
+		if strings.Contains(r, `"`) || logsink.HasControlCharacter(r) {
+			return ConfigMultilineBadRegexError
+		}
+		if _, err := regexp.Compile(r); err != nil {
+			return ConfigMultilineBadRegexError
+		}
+		if !onigmoCompatible(r) {
+			return ConfigMultilineBadRegexError
+		}
+	}
+
+	return ""
 }
 
-func validateMetricSinkConfig(rar v1beta1.AdmissionReview, cms sink.ClusterMetricSink) (*v1beta1.AdmissionResponse, *httpError) {
-	for _, input := range cms.Spec.Inputs {
-		it, ok := input["type"]
-		if !ok {
-			return toAdmissionErrorResponse(ConfigMetricNoTypeError), nil
+// onigmoCompatible reports whether a regex that compiles in Go is read the
+// same way by Onigmo, the Ruby syntax regex engine of fluent-bit. It rejects
+// the Go syntax Onigmo does not support or interprets differently: (?P<name>)
+// groups, flags other than i, \Q...\E quoting, \C and single letter Unicode
+// classes such as \pL.
+func onigmoCompatible(pattern string) bool {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+			if i == len(pattern) {
+				return false
+			}
+			switch pattern[i] {
+			case 'Q', 'E', 'C':
+				return false
+			case 'p', 'P':
+				if i+1 == len(pattern) || pattern[i+1] != '{' {
+					return false
+				}
+			}
+		case '(':
+			if !strings.HasPrefix(pattern[i:], "(?") {
+				continue
+			}
+			group := pattern[i+2:]
+			if strings.HasPrefix(group, "P<") {
+				return false
+			}
+			end := strings.IndexAny(group, ":)")
+			if end < 0 {
+				continue
+			}
+			if strings.Trim(group[:end], "i-") != "" && !strings.HasPrefix(group, "<") {
+				return false
+			}
 		}
-		if _, ok = it.(string); !ok {
-			return toAdmissionErrorResponse(ConfigMetricNonStringTypeError), nil
+	}
+	return true
+}
+
+func (s *Server) logParserHandler(w http.ResponseWriter, r *http.Request) {
+	requestedAdmissionReview, httpErr := deserializeReview(r)
+	if httpErr != nil {
+		httpErr.Write(w)
+		return
+	}
+
+	var lp sink.LogParser
+	err := json.Unmarshal(requestedAdmissionReview.Request.Object.Raw, &lp)
+	if err != nil {
+		errUnableToDeserialize.Write(w)
+		return
+	}
+
+	resp := validateLogParser(*requestedAdmissionReview, lp)
+	s.writeReview(w, r, requestedAdmissionReview, resp)
+}
+
+// validateLogParser rejects regexes that fluent-bit would fail to load and
+// fields that would break out of the rendered [PARSER] section. A failing
+// parser prevents fluent-bit from starting on every node.
+func validateLogParser(rar v1beta1.AdmissionReview, lp sink.LogParser) *v1beta1.AdmissionResponse {
+	if !logsink.ValidParserSpec(lp.Spec) {
+		return toAdmissionErrorResponse(ConfigParserBadFieldError)
+	}
+
+	switch lp.Spec.Format {
+	case "regex":
+		re, err := regexp.Compile(lp.Spec.Regex)
+		if err != nil {
+			return toAdmissionErrorResponse(ConfigParserBadRegexError)
 		}
-		if it == "kubernetes" {
-			return toAdmissionErrorResponse(ConfigIncludesKubernetesError), nil
+		if !hasNamedCapture(re) || !onigmoCompatible(lp.Spec.Regex) {
+			return toAdmissionErrorResponse(ConfigParserBadRegexError)
 		}
+	case "json", "logfmt", "ltsv":
+	default:
+		return toAdmissionErrorResponse(ConfigParserBadFormatError)
 	}
-	for _, output := range cms.Spec.Outputs {
-		ot, ok := output["type"]
-		if !ok {
-			return toAdmissionErrorResponse(ConfigMetricNoTypeError), nil
+
+	return &v1beta1.AdmissionResponse{
+		UID:     rar.Request.UID,
+		Allowed: true,
+	}
+}
+
+func hasNamedCapture(re *regexp.Regexp) bool {
+	for _, n := range re.SubexpNames() {
+		if n != "" {
+			return true
 		}
-		if _, ok := ot.(string); !ok {
-			return toAdmissionErrorResponse(ConfigMetricNonStringTypeError), nil
+	}
+	return false
+}
+
+func validRequest(r v1beta1.AdmissionReview) bool {
+	switch r.APIVersion {
+	case "", admissionV1, admissionV1beta1:
+	default:
+		return false
+	}
+	return r.Request != nil
+}
+
+// writeReview records the decision and replies in the API version of the
+// request. The v1 and v1beta1 reviews share a wire format, but v1 requires
+// the response UID to match the request. Warnings are shown to the client
+// by API servers that support them and ignored by older ones.
+func (s *Server) writeReview(w http.ResponseWriter, r *http.Request, rar *v1beta1.AdmissionReview, resp *v1beta1.AdmissionResponse, warnings ...string) {
+	resp.UID = rar.Request.UID
+	s.recordDecision(r, rar, resp, warnings)
+
+	apiVersion := rar.APIVersion
+	if apiVersion == "" {
+		apiVersion = admissionV1beta1
+	}
+
+	err := json.NewEncoder(w).Encode(&admissionReview{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "AdmissionReview",
+			APIVersion: apiVersion,
+		},
+		Response: &admissionResponse{
+			AdmissionResponse: resp,
+			Warnings:          warnings,
+		},
+	})
+	if err != nil {
+		log.Printf("Unable to marshal resp: %s", err)
+	}
+}
+
+// admissionReview is a v1beta1.AdmissionReview with the warnings that were
+// added to the response after the vendored API types.
+type admissionReview struct {
+	metav1.TypeMeta `json:",inline"`
+	Response        *admissionResponse `json:"response"`
+}
+
+type admissionResponse struct {
+	*v1beta1.AdmissionResponse
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// validateMetricSinkConfig validates a ClusterMetricSink against the
+// cluster config rendered by the metric ClusterController, which already
+// includes the kubernetes input.
+func (s *Server) validateMetricSinkConfig(ctx context.Context, rar v1beta1.AdmissionReview, cms sink.ClusterMetricSink) (*v1beta1.AdmissionResponse, *httpError) {
+	if msg := validateMetricTypes(cms.Spec); msg != "" {
+		return toAdmissionErrorResponse(msg), nil
+	}
+	for _, input := range cms.Spec.Inputs {
+		if input["type"] == "kubernetes" {
+			return toAdmissionErrorResponse(ConfigIncludesKubernetesError), nil
 		}
 	}
+	if err := validateTelegrafPlugins(cms.Spec); err != nil {
+		return toAdmissionErrorResponse(telegrafErrorMessage(err)), nil
+	}
 
 	// Which version of default inputs irrelevant to validation at time of
 	// commit.
+	cms.Spec = telegrafTestSpec(cms.Spec)
 	cfg := metric.NewConfig("", metric.KubernetesDefault(false))
 	cfg.UpsertSink(cms)
-	err := ioutil.WriteFile("/tmp/telegraf.conf", []byte(cfg.String()), 0644)
-	if err != nil {
-		return nil, errUnableToWriteConfig
+
+	return s.validateTelegrafConfig(ctx, rar, cfg.String())
+}
+
+// validateNamespacedMetricSinkConfig validates a MetricSink against the
+// config the metric Controller deploys for it, with the prometheus input for
+// its namespace.
+func (s *Server) validateNamespacedMetricSinkConfig(ctx context.Context, rar v1beta1.AdmissionReview, ms sink.MetricSink) (*v1beta1.AdmissionResponse, *httpError) {
+	if msg := validateMetricTypes(ms.Spec); msg != "" {
+		return toAdmissionErrorResponse(msg), nil
 	}
 
-	cmd := exec.Command("telegraf", "--config", "/tmp/telegraf.conf", "--test")
-	err = cmd.Run()
-	if err != nil {
-		return toAdmissionErrorResponse(ConfigTelegrafError), nil
+	if err := validateTelegrafPlugins(ms.Spec); err != nil {
+		return toAdmissionErrorResponse(telegrafErrorMessage(err)), nil
 	}
 
-	return &v1beta1.AdmissionResponse{
-		UID:     rar.Request.UID,
-		Allowed: true,
-	}, nil
+	if ms.Namespace == "" {
+		ms.Namespace = rar.Request.Namespace
+	}
+	if msg := s.checkMetricSinkPolicy(ms.Namespace, ms.Spec); msg != "" {
+		return toAdmissionErrorResponse(msg), nil
+	}
+	if rar.Request.Operation == "CREATE" {
+		if msg := s.checkMetricSinkQuota(ms.Namespace); msg != "" {
+			return toAdmissionErrorResponse(msg), nil
+		}
+	}
+	ms.Spec = telegrafTestSpec(ms.Spec)
+
+	return s.validateTelegrafConfig(ctx, rar, metric.MetricSinkConfig("", &ms))
+}
+
+func validateMetricTypes(spec sink.MetricSinkSpec) string {
+	for _, input := range spec.Inputs {
+		it, ok := input["type"]
+		if !ok {
+			return ConfigMetricNoTypeError
+		}
+		if _, ok = it.(string); !ok {
+			return ConfigMetricNonStringTypeError
+		}
+	}
+	for _, output := range spec.Outputs {
+		ot, ok := output["type"]
+		if !ok {
+			return ConfigMetricNoTypeError
+		}
+		if _, ok := ot.(string); !ok {
+			return ConfigMetricNonStringTypeError
+		}
+	}
+	return ""
+}
+
+func telegrafErrorMessage(err error) string {
+	return fmt.Sprintf("%s: %s", ConfigTelegrafError, err)
 }
 
 func deserializeReview(r *http.Request) (*v1beta1.AdmissionReview, *httpError) {
@@ -137,7 +137,7 @@ func TestValidator(t *testing.T) {
 	})
 
 	t.Run("it returns non-200 response code if unable to deserialize object", func(t *testing.T) {
-		endpoints := []string{"metricsink", "logsink"}
+		endpoints := []string{"metricsink", "logsink", "logparser"}
 		server := webhook.NewServer("127.0.0.1:0")
 		server.Run(false)
 		defer server.Close()
@@ -359,7 +359,9 @@ func TestValidator(t *testing.T) {
 						}
 
 						expectedInvalidResponse := v1beta1.AdmissionReview{
+							TypeMeta: reviewTypeMeta,
 							Response: &v1beta1.AdmissionResponse{
+								UID: testUID,
 								Result: &metav1.Status{
 									Message: test.errorResponse,
 								},
@@ -372,6 +374,194 @@ func TestValidator(t *testing.T) {
 				}
 			}
 		})
+		t.Run("validates multiline and parser configuration", func(t *testing.T) {
+			tests := []struct {
+				name          string
+				template      string
+				specObject    string
+				errorResponse string
+			}{
+				{
+					"presets and regexes",
+					logSinkAdmissionTemplate,
+					`{
+						"type": "syslog",
+						"host": "example.com",
+						"port": 100,
+						"enable_tls": true,
+						"multiline": {
+							"presets": ["java", "python"],
+							"start_regex": "^\\d{4}-",
+							"continue_regex": "^\\s+at "
+						}
+					}`,
+					"",
+				},
+				{
+					"cluster log sink",
+					clusterLogSinkAdmissionTemplate,
+					`{
+						"type": "syslog",
+						"host": "example.com",
+						"port": 100,
+						"enable_tls": true,
+						"multiline": {
+							"presets": ["java"]
+						}
+					}`,
+					webhook.ConfigMultilineClusterError,
+				},
+				{
+					"unknown preset",
+					logSinkAdmissionTemplate,
+					`{
+						"type": "webhook",
+						"url": "https://example.com/place",
+						"multiline": {
+							"presets": ["cobol"]
+						}
+					}`,
+					webhook.ConfigMultilineBadPresetError,
+				},
+				{
+					"invalid regex",
+					logSinkAdmissionTemplate,
+					`{
+						"type": "webhook",
+						"url": "https://example.com/place",
+						"multiline": {
+							"start_regex": "^(unclosed"
+						}
+					}`,
+					webhook.ConfigMultilineBadRegexError,
+				},
+				{
+					"regex with Go only flags",
+					logSinkAdmissionTemplate,
+					`{
+						"type": "webhook",
+						"url": "https://example.com/place",
+						"multiline": {
+							"start_regex": "(?s)^Traceback.*"
+						}
+					}`,
+					webhook.ConfigMultilineBadRegexError,
+				},
+				{
+					"regex with Go named groups",
+					logSinkAdmissionTemplate,
+					`{
+						"type": "webhook",
+						"url": "https://example.com/place",
+						"multiline": {
+							"start_regex": "^(?P<time>\\d+) "
+						}
+					}`,
+					webhook.ConfigMultilineBadRegexError,
+				},
+				{
+					"regex with Onigmo compatible groups",
+					logSinkAdmissionTemplate,
+					`{
+						"type": "webhook",
+						"url": "https://example.com/place",
+						"multiline": {
+							"start_regex": "^(?i:error)(?<time>\\d+) \\p{Lu}\\("
+						}
+					}`,
+					"",
+				},
+				{
+					"continue regex without start regex",
+					logSinkAdmissionTemplate,
+					`{
+						"type": "webhook",
+						"url": "https://example.com/place",
+						"multiline": {
+							"continue_regex": "^\\s+"
+						}
+					}`,
+					webhook.ConfigMultilineBadRegexError,
+				},
+				{
+					"parser",
+					logSinkAdmissionTemplate,
+					`{
+						"type": "webhook",
+						"url": "https://example.com/place",
+						"parser": "my-parser"
+					}`,
+					"",
+				},
+				{
+					"cluster log sink parser",
+					clusterLogSinkAdmissionTemplate,
+					`{
+						"type": "webhook",
+						"url": "https://example.com/place",
+						"parser": "my-parser"
+					}`,
+					webhook.ConfigParserClusterError,
+				},
+			}
+			server := webhook.NewServer("127.0.0.1:0")
+			server.Run(false)
+			defer server.Close()
+
+			for _, test := range tests {
+				t.Run(test.name, func(t *testing.T) {
+					var (
+						err  error
+						resp *http.Response
+					)
+					for i := 0; i < 100; i++ {
+						resp, err = http.Post(
+							"http://"+server.Addr()+"/logsink",
+							"application/json",
+							strings.NewReader(fmt.Sprintf(test.template, test.specObject)),
+						)
+						if err == nil {
+							break
+						}
+						time.Sleep(5 * time.Millisecond)
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+					if resp.StatusCode != http.StatusOK {
+						t.Errorf("expected http status 200, got %d", resp.StatusCode)
+					}
+					defer resp.Body.Close()
+
+					var actualResp v1beta1.AdmissionReview
+					err = json.NewDecoder(resp.Body).Decode(&actualResp)
+					if err != nil {
+						t.Errorf("unable to decode resp body: %s", err)
+					}
+
+					if test.errorResponse == "" {
+						if !actualResp.Response.Allowed {
+							t.Errorf("expected response to be allowed, got false")
+						}
+						return
+					}
+
+					expectedInvalidResponse := v1beta1.AdmissionReview{
+						TypeMeta: reviewTypeMeta,
+						Response: &v1beta1.AdmissionResponse{
+							UID: testUID,
+							Result: &metav1.Status{
+								Message: test.errorResponse,
+							},
+						},
+					}
+					if diff := cmp.Diff(expectedInvalidResponse, actualResp); diff != "" {
+						t.Errorf("As (-want, +got) = %v", diff)
+					}
+				})
+			}
+		})
+
 		t.Run("Does not allow changing sink type", func(t *testing.T) {
 			server := webhook.NewServer("127.0.0.1:0")
 			server.Run(false)
@@ -422,7 +612,9 @@ func TestValidator(t *testing.T) {
 					}
 
 					expectedInvalidResponse := v1beta1.AdmissionReview{
+						TypeMeta: reviewTypeMeta,
 						Response: &v1beta1.AdmissionResponse{
+							UID: testUID,
 							Result: &metav1.Status{
 								Message: "Changing sink type invalid",
 							},
@@ -436,13 +628,247 @@ func TestValidator(t *testing.T) {
 		})
 	})
 
+	t.Run("LogParser", func(t *testing.T) {
+		tests := []struct {
+			name          string
+			specObject    string
+			errorResponse string
+		}{
+			{
+				"regex with named captures",
+				`{
+					"format": "regex",
+					"regex": "^(?<time>[^ ]+) (?<message>.*)$",
+					"time_key": "time",
+					"time_format": "%Y-%m-%dT%H:%M:%S"
+				}`,
+				"",
+			},
+			{
+				"json",
+				`{"format": "json"}`,
+				"",
+			},
+			{
+				"logfmt",
+				`{"format": "logfmt"}`,
+				"",
+			},
+			{
+				"ltsv",
+				`{"format": "ltsv"}`,
+				"",
+			},
+			{
+				"unknown format",
+				`{"format": "xml"}`,
+				webhook.ConfigParserBadFormatError,
+			},
+			{
+				"missing regex",
+				`{"format": "regex"}`,
+				webhook.ConfigParserBadRegexError,
+			},
+			{
+				"regex that does not compile",
+				`{"format": "regex", "regex": "^(?<message>.*"}`,
+				webhook.ConfigParserBadRegexError,
+			},
+			{
+				"regex without named captures",
+				`{"format": "regex", "regex": "^(.*)$"}`,
+				webhook.ConfigParserBadRegexError,
+			},
+			{
+				"regex with Go named captures",
+				`{"format": "regex", "regex": "^(?P<message>.*)$"}`,
+				webhook.ConfigParserBadRegexError,
+			},
+			{
+				"regex with a newline",
+				`{"format": "regex", "regex": "^(?<message>.*)$\n[OUTPUT]"}`,
+				webhook.ConfigParserBadFieldError,
+			},
+			{
+				"time key with a newline",
+				`{"format": "json", "time_key": "time\n[OUTPUT]"}`,
+				webhook.ConfigParserBadFieldError,
+			},
+			{
+				"time format with a control character",
+				`{"format": "json", "time_format": "%Y\u0000"}`,
+				webhook.ConfigParserBadFieldError,
+			},
+		}
+		server := webhook.NewServer("127.0.0.1:0")
+		server.Run(false)
+		defer server.Close()
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				var (
+					err  error
+					resp *http.Response
+				)
+				for i := 0; i < 100; i++ {
+					resp, err = http.Post(
+						"http://"+server.Addr()+"/logparser",
+						"application/json",
+						strings.NewReader(fmt.Sprintf(logParserAdmissionTemplate, test.specObject)),
+					)
+					if err == nil {
+						break
+					}
+					time.Sleep(5 * time.Millisecond)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("expected http status 200, got %d", resp.StatusCode)
+				}
+				defer resp.Body.Close()
+
+				var actualResp v1beta1.AdmissionReview
+				err = json.NewDecoder(resp.Body).Decode(&actualResp)
+				if err != nil {
+					t.Errorf("unable to decode resp body: %s", err)
+				}
+
+				if test.errorResponse == "" {
+					if !actualResp.Response.Allowed {
+						t.Errorf("expected response to be allowed, got false")
+					}
+					return
+				}
+
+				expectedInvalidResponse := v1beta1.AdmissionReview{
+					TypeMeta: reviewTypeMeta,
+					Response: &v1beta1.AdmissionResponse{
+						UID: testUID,
+						Result: &metav1.Status{
+							Message: test.errorResponse,
+						},
+					},
+				}
+				if diff := cmp.Diff(expectedInvalidResponse, actualResp); diff != "" {
+					t.Errorf("As (-want, +got) = %v", diff)
+				}
+			})
+		}
+	})
+
+	t.Run("Metric sink kinds", func(t *testing.T) {
+		kubernetesInput := `{
+			"inputs": [ {
+				"type": "kubernetes"
+			} ],
+			"outputs": [ {
+				"apikey": "apikey",
+				"type": "datadog"
+			} ]
+		}`
+		tests := []struct {
+			name          string
+			template      string
+			telegraf      bool
+			errorResponse string
+		}{
+			{
+				"ClusterMetricSink with kubernetes input",
+				clusterMetricAdmissionTemplate,
+				false,
+				webhook.ConfigIncludesKubernetesError,
+			},
+			{
+				"MetricSink with kubernetes input",
+				metricAdmissionTemplate,
+				false,
+				"",
+			},
+		}
+		server := webhook.NewServer("127.0.0.1:0")
+		server.Run(false)
+		defer server.Close()
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				if test.telegraf {
+					requireTelegraf(t)
+				}
+				var (
+					err  error
+					resp *http.Response
+				)
+				for i := 0; i < 100; i++ {
+					resp, err = http.Post(
+						"http://"+server.Addr()+"/metricsink",
+						"application/json",
+						strings.NewReader(fmt.Sprintf(test.template, kubernetesInput)),
+					)
+					if err == nil {
+						break
+					}
+					time.Sleep(5 * time.Millisecond)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("expected http status 200, got %d", resp.StatusCode)
+				}
+				defer resp.Body.Close()
+
+				var actualResp v1beta1.AdmissionReview
+				err = json.NewDecoder(resp.Body).Decode(&actualResp)
+				if err != nil {
+					t.Errorf("unable to decode resp body: %s", err)
+				}
+
+				if test.errorResponse == "" {
+					if !actualResp.Response.Allowed {
+						t.Errorf("expected response to be allowed, got false")
+					}
+					return
+				}
+
+				expectedInvalidResponse := v1beta1.AdmissionReview{
+					TypeMeta: reviewTypeMeta,
+					Response: &v1beta1.AdmissionResponse{
+						UID: testUID,
+						Result: &metav1.Status{
+							Message: test.errorResponse,
+						},
+					},
+				}
+				if diff := cmp.Diff(expectedInvalidResponse, actualResp); diff != "" {
+					t.Errorf("As (-want, +got) = %v", diff)
+				}
+			})
+		}
+
+		t.Run("it rejects unknown kinds", func(t *testing.T) {
+			resp, err := http.Post(
+				"http://"+server.Addr()+"/metricsink",
+				"application/json",
+				strings.NewReader(fmt.Sprintf(logSinkAdmissionTemplate, kubernetesInput)),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusUnprocessableEntity {
+				t.Errorf("expected http status 422, got %d", resp.StatusCode)
+			}
+		})
+	})
+
 	for ttype, template := range map[string]string{
 		"Cluster":   clusterMetricAdmissionTemplate,
 		"Namespace": metricAdmissionTemplate,
 	} {
 		t.Run(ttype+"_Metric_Sink", func(t *testing.T) {
 			t.Run("returns an allowed admission response", func(t *testing.T) {
-				requireTelegraf(t)
 				server := webhook.NewServer("127.0.0.1:0")
 				server.Run(false)
 				defer server.Close()
@@ -495,21 +921,7 @@ func TestValidator(t *testing.T) {
 			})
 
 			t.Run("returns a disallowed admission response for", func(t *testing.T) {
-				requireTelegraf(t)
 				tests := []invalidValidationTest{
-					{
-						"user specified kubernetes input",
-						`{
-						"inputs": [ {
-							"type": "kubernetes"
-						} ],
-						"outputs": [ {
-							"apikey": "apikey",
-							"type": "datadog"
-						} ]
-					}`,
-						webhook.ConfigIncludesKubernetesError,
-					},
 					{
 						"no input type",
 						`{
@@ -557,7 +969,58 @@ func TestValidator(t *testing.T) {
 							"garbage": "datadog"
 						} ]
 					}`,
-						webhook.ConfigTelegrafError,
+						webhook.ConfigTelegrafError + `: outputs.datadog: field "garbage" is unknown`,
+					},
+					{
+						"input option with the wrong type",
+						`{
+						"inputs": [ {
+							"type": "cpu",
+							"percpu": "yes"
+						} ]
+					}`,
+						webhook.ConfigTelegrafError + `: inputs.cpu: field "percpu" must be a boolean`,
+					},
+					{
+						"invalid duration",
+						`{
+						"inputs": [ {
+							"type": "exec",
+							"commands": [ "echo", "5" ],
+							"timeout": "5 parsecs"
+						} ]
+					}`,
+						webhook.ConfigTelegrafError + `: inputs.exec: field "timeout" must be a duration string`,
+					},
+					{
+						"invalid list",
+						`{
+						"inputs": [ {
+							"type": "exec",
+							"commands": [ "echo", 5 ]
+						} ]
+					}`,
+						webhook.ConfigTelegrafError + `: inputs.exec: field "commands" must be a list of strings`,
+					},
+					{
+						"non integer option",
+						`{
+						"outputs": [ {
+							"type": "wavefront",
+							"port": 2878.5
+						} ]
+					}`,
+						webhook.ConfigTelegrafError + `: outputs.wavefront: field "port" must be an integer`,
+					},
+					{
+						"invalid common option",
+						`{
+						"outputs": [ {
+							"type": "discard",
+							"tagpass": { "cpu": "cpu0" }
+						} ]
+					}`,
+						webhook.ConfigTelegrafError + `: outputs.discard: field "tagpass" must be a table of string lists`,
 					},
 				}
 				server := webhook.NewServer("127.0.0.1:0")
@@ -596,7 +1059,9 @@ func TestValidator(t *testing.T) {
 						}
 
 						expectedInvalidResponse := v1beta1.AdmissionReview{
+							TypeMeta: reviewTypeMeta,
 							Response: &v1beta1.AdmissionResponse{
+								UID: testUID,
 								Result: &metav1.Status{
 									Message: test.errorResponse,
 								},
@@ -610,6 +1075,122 @@ func TestValidator(t *testing.T) {
 			})
 		})
 	}
+
+	t.Run("it validates metric sinks with telegraf when configured", func(t *testing.T) {
+		requireTelegraf(t)
+		server := webhook.NewServer("127.0.0.1:0", webhook.WithTelegrafBinary("telegraf"))
+		server.Run(false)
+		defer server.Close()
+
+		var (
+			err  error
+			resp *http.Response
+		)
+		for i := 0; i < 100; i++ {
+			resp, err = http.Post(
+				"http://"+server.Addr()+"/metricsink",
+				"application/json",
+				strings.NewReader(fmt.Sprintf(clusterMetricAdmissionTemplate, `{
+					"inputs": [ {
+						"data_format": "not-a-format",
+						"type": "http"
+					} ],
+					"outputs": [ {
+						"type": "discard"
+					} ]
+				}`)),
+			)
+			if err == nil {
+				break
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var actualResp v1beta1.AdmissionReview
+		err = json.NewDecoder(resp.Body).Decode(&actualResp)
+		if err != nil {
+			t.Errorf("unable to decode resp body: %s", err)
+		}
+
+		if actualResp.Response.Allowed {
+			t.Errorf("expected response to be disallowed, got allowed")
+		}
+	})
+}
+
+func TestAdmissionReviewVersions(t *testing.T) {
+	server := webhook.NewServer("127.0.0.1:0")
+	server.Run(false)
+	defer server.Close()
+
+	requests := []struct {
+		name     string
+		endpoint string
+		template string
+		spec     string
+		allowed  bool
+	}{
+		{"allowed LogSink", "/logsink", logSinkAdmissionTemplate, `{"type": "webhook", "url": "https://example.com"}`, true},
+		{"denied LogSink", "/logsink", logSinkAdmissionTemplate, `{"type": "webhook", "url": "http://example.com"}`, false},
+		{"allowed MetricSink", "/metricsink", metricAdmissionTemplate, `{"inputs": [{"type": "cpu"}], "outputs": [{"type": "discard"}]}`, true},
+		{"denied MetricSink", "/metricsink", metricAdmissionTemplate, `{"inputs": [{}], "outputs": []}`, false},
+		{"allowed LogParser", "/logparser", logParserAdmissionTemplate, `{"format": "json"}`, true},
+		{"denied LogParser", "/logparser", logParserAdmissionTemplate, `{"format": "xml"}`, false},
+		{"defaulted LogSink", "/mutate", logSinkAdmissionTemplate, `{"type": "syslog", "host": "example.com"}`, true},
+	}
+
+	for _, version := range []string{"admission.k8s.io/v1", "admission.k8s.io/v1beta1"} {
+		for _, r := range requests {
+			t.Run(version+"/"+r.name, func(t *testing.T) {
+				body := strings.Replace(fmt.Sprintf(r.template, r.spec), "admission.k8s.io/v1beta1", version, 1)
+				resp := postReview(t, server, r.endpoint, body)
+				if resp.StatusCode != http.StatusOK {
+					t.Fatalf("expected http status 200, got %d", resp.StatusCode)
+				}
+				defer resp.Body.Close()
+
+				var actualResp v1beta1.AdmissionReview
+				err := json.NewDecoder(resp.Body).Decode(&actualResp)
+				if err != nil {
+					t.Fatalf("unable to decode resp body: %s", err)
+				}
+
+				if actualResp.APIVersion != version || actualResp.Kind != "AdmissionReview" {
+					t.Errorf("expected %s AdmissionReview, got %s %s", version, actualResp.APIVersion, actualResp.Kind)
+				}
+				if actualResp.Response.UID != testUID {
+					t.Errorf("expected response UID %s, got %q", testUID, actualResp.Response.UID)
+				}
+				if actualResp.Response.Allowed != r.allowed {
+					t.Errorf("expected allowed to be %t, got %t", r.allowed, actualResp.Response.Allowed)
+				}
+			})
+		}
+	}
+
+	t.Run("it rejects unknown versions", func(t *testing.T) {
+		body := strings.Replace(
+			fmt.Sprintf(logParserAdmissionTemplate, `{"format": "json"}`),
+			"admission.k8s.io/v1beta1",
+			"admission.k8s.io/v2",
+			1,
+		)
+		resp := postReview(t, server, "/logparser", body)
+		if resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("expected http status 422, got %d", resp.StatusCode)
+		}
+	})
+}
+
+const testUID = "f9bc53a0-266b-11e9-928e-42010a800feb"
+
+var reviewTypeMeta = metav1.TypeMeta{
+	Kind:       "AdmissionReview",
+	APIVersion: "admission.k8s.io/v1beta1",
 }
 
 var (
@@ -669,6 +1250,7 @@ var (
 	logSinkAdmissionTemplate        = fmt.Sprintf(admissionTemplate, "LogSink", "logsinks")
 	clusterMetricAdmissionTemplate  = fmt.Sprintf(admissionTemplate, "ClusterMetricSink", "clustermetricsinks")
 	metricAdmissionTemplate         = fmt.Sprintf(admissionTemplate, "MetricSink", "metricsinks")
+	logParserAdmissionTemplate      = fmt.Sprintf(admissionTemplate, "LogParser", "logparsers")
 
 	logSinkUpdateAdmissionTemplate        = fmt.Sprintf(updateAdmissionTemplate, "LogSink", "logsinks")
 	clusterLogSinkUpdateAdmissionTemplate = fmt.Sprintf(updateAdmissionTemplate, "ClusterLogSink", "clusterlogsinks")
@@ -0,0 +1,552 @@
+package webhook
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	sink "github.com/knative/observability/pkg/apis/sink/v1alpha1"
+)
+
+type fieldType int
+
+const (
+	stringField fieldType = iota
+	boolField
+	intField
+	durationField
+	stringListField
+	floatListField
+	stringMapField
+	stringListMapField
+)
+
+func (t fieldType) String() string {
+	switch t {
+	case boolField:
+		return "a boolean"
+	case intField:
+		return "an integer"
+	case durationField:
+		return "a duration string"
+	case stringListField:
+		return "a list of strings"
+	case floatListField:
+		return "a list of numbers"
+	case stringMapField:
+		return "a table of strings"
+	case stringListMapField:
+		return "a table of string lists"
+	default:
+		return "a string"
+	}
+}
+
+// pluginSchema maps each option of a telegraf plugin to its type.
+type pluginSchema map[string]fieldType
+
+func schema(schemas ...pluginSchema) pluginSchema {
+	s := make(pluginSchema)
+	for _, ps := range schemas {
+		for k, v := range ps {
+			s[k] = v
+		}
+	}
+	return s
+}
+
+var (
+	filterFields = pluginSchema{
+		"namepass":   stringListField,
+		"namedrop":   stringListField,
+		"fieldpass":  stringListField,
+		"fielddrop":  stringListField,
+		"taginclude": stringListField,
+		"tagexclude": stringListField,
+		"tagpass":    stringListMapField,
+		"tagdrop":    stringListMapField,
+	}
+
+	commonInputFields = schema(filterFields, pluginSchema{
+		"interval":      durationField,
+		"name_override": stringField,
+		"name_prefix":   stringField,
+		"name_suffix":   stringField,
+		"precision":     durationField,
+		"tags":          stringMapField,
+	})
+
+	commonOutputFields = schema(filterFields, pluginSchema{
+		"metric_batch_size":   intField,
+		"metric_buffer_limit": intField,
+	})
+
+	tlsClientFields = pluginSchema{
+		"tls_ca":               stringField,
+		"tls_cert":             stringField,
+		"tls_key":              stringField,
+		"insecure_skip_verify": boolField,
+	}
+
+	parserFields = pluginSchema{
+		"data_format":        stringField,
+		"data_type":          stringField,
+		"separator":          stringField,
+		"templates":          stringListField,
+		"tag_keys":           stringListField,
+		"json_query":         stringField,
+		"json_name_key":      stringField,
+		"json_string_fields": stringListField,
+		"json_time_key":      stringField,
+		"json_time_format":   stringField,
+		"json_timezone":      stringField,
+	}
+
+	serializerFields = pluginSchema{
+		"data_format":           stringField,
+		"prefix":                stringField,
+		"template":              stringField,
+		"graphite_tag_support":  boolField,
+		"influx_max_line_bytes": intField,
+		"influx_sort_fields":    boolField,
+		"influx_uint_support":   boolField,
+		"json_timestamp_units":  durationField,
+	}
+)
+
+// inputSchemas and outputSchemas cover the telegraf plugins whose options
+// are checked. Plugins that are not listed are admitted with a warning and
+// left for telegraf to validate.
+var inputSchemas = map[string]pluginSchema{
+	"cpu": {
+		"percpu":           boolField,
+		"totalcpu":         boolField,
+		"collect_cpu_time": boolField,
+		"report_active":    boolField,
+	},
+	"disk": {
+		"mount_points": stringListField,
+		"ignore_fs":    stringListField,
+	},
+	"diskio": {
+		"devices":            stringListField,
+		"device_tags":        stringListField,
+		"name_templates":     stringListField,
+		"skip_serial_number": boolField,
+	},
+	"docker": schema(tlsClientFields, pluginSchema{
+		"endpoint":                 stringField,
+		"gather_services":          boolField,
+		"container_name_include":   stringListField,
+		"container_name_exclude":   stringListField,
+		"container_state_include":  stringListField,
+		"container_state_exclude":  stringListField,
+		"docker_label_include":     stringListField,
+		"docker_label_exclude":     stringListField,
+		"timeout":                  durationField,
+		"perdevice":                boolField,
+		"total":                    boolField,
+		"tag_env":                  stringListField,
+		"source_tag":               boolField,
+		"container_names":          stringListField,
+		"storage_objects":          stringListField,
+		"container_label_include":  stringListField,
+		"container_label_exclude":  stringListField,
+		"swarm_service_label_tags": stringListField,
+	}),
+	"exec": schema(parserFields, pluginSchema{
+		"commands": stringListField,
+		"command":  stringField,
+		"timeout":  durationField,
+	}),
+	"http": schema(parserFields, tlsClientFields, pluginSchema{
+		"urls":     stringListField,
+		"method":   stringField,
+		"headers":  stringMapField,
+		"body":     stringField,
+		"username": stringField,
+		"password": stringField,
+		"timeout":  durationField,
+	}),
+	"http_response": schema(tlsClientFields, pluginSchema{
+		"address":               stringField,
+		"http_proxy":            stringField,
+		"response_timeout":      durationField,
+		"method":                stringField,
+		"follow_redirects":      boolField,
+		"body":                  stringField,
+		"response_string_match": stringField,
+		"headers":               stringMapField,
+	}),
+	"internal": {
+		"collect_memstats": boolField,
+	},
+	"kernel": {},
+	"kubernetes": schema(tlsClientFields, pluginSchema{
+		"url":                 stringField,
+		"bearer_token":        stringField,
+		"bearer_token_string": stringField,
+		"response_timeout":    durationField,
+	}),
+	"mem": {},
+	"net": {
+		"interfaces":            stringListField,
+		"ignore_protocol_stats": boolField,
+	},
+	"netstat":   {},
+	"processes": {},
+	"procstat": {
+		"pid_file":      stringField,
+		"exe":           stringField,
+		"pattern":       stringField,
+		"user":          stringField,
+		"systemd_unit":  stringField,
+		"cgroup":        stringField,
+		"prefix":        stringField,
+		"pid_tag":       boolField,
+		"pid_finder":    stringField,
+		"process_name":  stringField,
+		"pid_as_tag":    boolField,
+		"win_service":   stringField,
+		"cmdline_tag":   boolField,
+		"process_label": stringField,
+	},
+	"prometheus": schema(tlsClientFields, pluginSchema{
+		"urls":                              stringListField,
+		"url_tag":                           stringField,
+		"metric_version":                    intField,
+		"kubernetes_services":               stringListField,
+		"kube_config":                       stringField,
+		"monitor_kubernetes_pods":           boolField,
+		"monitor_kubernetes_pods_namespace": stringField,
+		"bearer_token":                      stringField,
+		"bearer_token_string":               stringField,
+		"username":                          stringField,
+		"password":                          stringField,
+		"response_timeout":                  durationField,
+	}),
+	"statsd": {
+		"protocol":                 stringField,
+		"service_address":          stringField,
+		"max_tcp_connections":      intField,
+		"tcp_keep_alive":           boolField,
+		"tcp_keep_alive_period":    durationField,
+		"delete_gauges":            boolField,
+		"delete_counters":          boolField,
+		"delete_sets":              boolField,
+		"delete_timings":           boolField,
+		"percentiles":              floatListField,
+		"percentile_limit":         intField,
+		"metric_separator":         stringField,
+		"parse_data_dog_tags":      boolField,
+		"datadog_extensions":       boolField,
+		"templates":                stringListField,
+		"allowed_pending_messages": intField,
+		"read_buffer_size":         intField,
+	},
+	"swap":   {},
+	"system": {},
+}
+
+var outputSchemas = map[string]pluginSchema{
+	"cloudwatch": {
+		"region":                  stringField,
+		"access_key":              stringField,
+		"secret_key":              stringField,
+		"role_arn":                stringField,
+		"profile":                 stringField,
+		"shared_credential_file":  stringField,
+		"token":                   stringField,
+		"endpoint_url":            stringField,
+		"namespace":               stringField,
+		"high_resolution_metrics": boolField,
+		"write_statistics":        boolField,
+	},
+	"datadog": {
+		"apikey":  stringField,
+		"timeout": durationField,
+		"url":     stringField,
+	},
+	"discard": {},
+	"file": schema(serializerFields, pluginSchema{
+		"files": stringListField,
+	}),
+	"graphite": schema(tlsClientFields, pluginSchema{
+		"servers":              stringListField,
+		"prefix":               stringField,
+		"template":             stringField,
+		"templates":            stringListField,
+		"graphite_tag_support": boolField,
+		"timeout":              intField,
+	}),
+	"http": schema(serializerFields, tlsClientFields, pluginSchema{
+		"url":              stringField,
+		"method":           stringField,
+		"timeout":          durationField,
+		"username":         stringField,
+		"password":         stringField,
+		"headers":          stringMapField,
+		"content_encoding": stringField,
+	}),
+	"influxdb": schema(tlsClientFields, pluginSchema{
+		"urls":                         stringListField,
+		"url":                          stringField,
+		"database":                     stringField,
+		"database_tag":                 stringField,
+		"username":                     stringField,
+		"password":                     stringField,
+		"retention_policy":             stringField,
+		"write_consistency":            stringField,
+		"timeout":                      durationField,
+		"user_agent":                   stringField,
+		"udp_payload":                  intField,
+		"http_proxy":                   stringField,
+		"http_headers":                 stringMapField,
+		"content_encoding":             stringField,
+		"skip_database_creation":       boolField,
+		"influx_uint_support":          boolField,
+		"exclude_retention_policy_tag": boolField,
+	}),
+	"influxdb_v2": schema(tlsClientFields, pluginSchema{
+		"urls":                stringListField,
+		"token":               stringField,
+		"organization":        stringField,
+		"bucket":              stringField,
+		"bucket_tag":          stringField,
+		"timeout":             durationField,
+		"http_headers":        stringMapField,
+		"http_proxy":          stringField,
+		"user_agent":          stringField,
+		"content_encoding":    stringField,
+		"influx_uint_support": boolField,
+	}),
+	"kafka": schema(serializerFields, tlsClientFields, pluginSchema{
+		"brokers":           stringListField,
+		"topic":             stringField,
+		"client_id":         stringField,
+		"version":           stringField,
+		"routing_tag":       stringField,
+		"routing_key":       stringField,
+		"compression_codec": intField,
+		"required_acks":     intField,
+		"max_retry":         intField,
+		"max_message_bytes": intField,
+		"sasl_username":     stringField,
+		"sasl_password":     stringField,
+	}),
+	"prometheus_client": {
+		"listen":              stringField,
+		"basic_username":      stringField,
+		"basic_password":      stringField,
+		"ip_range":            stringListField,
+		"path":                stringField,
+		"expiration_interval": durationField,
+		"collectors_exclude":  stringListField,
+		"string_as_label":     boolField,
+		"export_timestamp":    boolField,
+		"tls_cert":            stringField,
+		"tls_key":             stringField,
+		"tls_allowed_cacerts": stringListField,
+	},
+	"stackdriver": {
+		"project":   stringField,
+		"namespace": stringField,
+	},
+	"wavefront": {
+		"url":              stringField,
+		"token":            stringField,
+		"host":             stringField,
+		"port":             intField,
+		"prefix":           stringField,
+		"simple_fields":    boolField,
+		"metric_separator": stringField,
+		"convert_paths":    boolField,
+		"use_regex":        boolField,
+		"source_override":  stringListField,
+		"convert_bool":     boolField,
+	},
+}
+
+// pluginError describes which option of which plugin failed validation.
+type pluginError struct {
+	section string
+	plugin  string
+	field   string
+	reason  string
+}
+
+func (e *pluginError) Error() string {
+	if e.field == "" {
+		return fmt.Sprintf("%s.%s: %s", e.section, e.plugin, e.reason)
+	}
+	return fmt.Sprintf("%s.%s: field %q %s", e.section, e.plugin, e.field, e.reason)
+}
+
+// validateTelegrafPlugins type checks the options of each input and output
+// that has a plugin schema. The type of each plugin must already be known to
+// be a string.
+func validateTelegrafPlugins(spec sink.MetricSinkSpec) error {
+	for _, input := range spec.Inputs {
+		err := validatePlugin("inputs", inputSchemas, commonInputFields, input)
+		if err != nil {
+			return err
+		}
+	}
+	for _, output := range spec.Outputs {
+		err := validatePlugin("outputs", outputSchemas, commonOutputFields, output)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unknownTelegrafPlugins returns a warning for each input and output that
+// has no plugin schema, so its options were not checked.
+func unknownTelegrafPlugins(spec sink.MetricSinkSpec) []string {
+	var warnings []string
+	for _, input := range spec.Inputs {
+		warnings = appendUnknownPlugin(warnings, "inputs", inputSchemas, input)
+	}
+	for _, output := range spec.Outputs {
+		warnings = appendUnknownPlugin(warnings, "outputs", outputSchemas, output)
+	}
+	return warnings
+}
+
+func appendUnknownPlugin(
+	warnings []string,
+	section string,
+	schemas map[string]pluginSchema,
+	plugin sink.MetricSinkMap,
+) []string {
+	name, ok := plugin["type"].(string)
+	if !ok {
+		return warnings
+	}
+	if _, ok := schemas[name]; ok {
+		return warnings
+	}
+	return append(warnings, fmt.Sprintf("%s.%s: unknown plugin, its options were not validated", section, name))
+}
+
+func validatePlugin(
+	section string,
+	schemas map[string]pluginSchema,
+	common pluginSchema,
+	plugin sink.MetricSinkMap,
+) error {
+	name := plugin["type"].(string)
+	ps, ok := schemas[name]
+	if !ok {
+		return nil
+	}
+
+	fields := make([]string, 0, len(plugin))
+	for k := range plugin {
+		if k != "type" {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		ft, ok := ps[field]
+		if !ok {
+			ft, ok = common[field]
+		}
+		if !ok {
+			return &pluginError{section: section, plugin: name, field: field, reason: "is unknown"}
+		}
+		if !validFieldValue(ft, plugin[field]) {
+			return &pluginError{
+				section: section,
+				plugin:  name,
+				field:   field,
+				reason:  fmt.Sprintf("must be %s", ft),
+			}
+		}
+	}
+
+	return nil
+}
+
+func validFieldValue(ft fieldType, v interface{}) bool {
+	switch ft {
+	case stringField:
+		_, ok := v.(string)
+		return ok
+	case boolField:
+		_, ok := v.(bool)
+		return ok
+	case intField:
+		f, ok := number(v)
+		return ok && f == math.Trunc(f)
+	case durationField:
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		_, err := time.ParseDuration(s)
+		return err == nil
+	case stringListField:
+		return validList(v, func(e interface{}) bool {
+			_, ok := e.(string)
+			return ok
+		})
+	case floatListField:
+		return validList(v, func(e interface{}) bool {
+			_, ok := number(e)
+			return ok
+		})
+	case stringMapField:
+		return validMap(v, func(e interface{}) bool {
+			_, ok := e.(string)
+			return ok
+		})
+	case stringListMapField:
+		return validMap(v, func(e interface{}) bool {
+			return validFieldValue(stringListField, e)
+		})
+	}
+	return false
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func validList(v interface{}, valid func(interface{}) bool) bool {
+	l, ok := v.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, e := range l {
+		if !valid(e) {
+			return false
+		}
+	}
+	return true
+}
+
+func validMap(v interface{}, valid func(interface{}) bool) bool {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for _, e := range m {
+		if !valid(e) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,145 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	sink "github.com/knative/observability/pkg/apis/sink/v1alpha1"
+	"k8s.io/api/admission/v1beta1"
+)
+
+const maxTelegrafErrorLength = 512
+
+// sideEffectFreeInputs only read the local host. Other inputs are removed
+// before running telegraf since --test gathers every input once, which would
+// run commands, make requests or open listeners from the validator.
+var sideEffectFreeInputs = map[string]bool{
+	"cpu":       true,
+	"disk":      true,
+	"diskio":    true,
+	"internal":  true,
+	"kernel":    true,
+	"mem":       true,
+	"net":       true,
+	"netstat":   true,
+	"processes": true,
+	"swap":      true,
+	"system":    true,
+}
+
+// telegrafLogPrefix matches the timestamp and level telegraf prefixes to
+// each log line, e.g. "2019-07-01T00:00:00Z E! ".
+var telegrafLogPrefix = regexp.MustCompile(`(?m)^\d{4}-\d{2}-\d{2}T\S+ [DIWE]! `)
+
+func telegrafTestSpec(spec sink.MetricSinkSpec) sink.MetricSinkSpec {
+	inputs := make([]sink.MetricSinkMap, 0, len(spec.Inputs))
+	for _, input := range spec.Inputs {
+		if t, _ := input["type"].(string); !sideEffectFreeInputs[t] {
+			continue
+		}
+		inputs = append(inputs, input)
+	}
+	spec.Inputs = inputs
+	return spec
+}
+
+// validateTelegrafConfig runs telegraf against the rendered config when the
+// server has been given a telegraf binary. Each run gets its own directory
+// and an empty environment so configs cannot read the validator's
+// environment variables. The run ends with the validation deadline in ctx.
+func (s *Server) validateTelegrafConfig(ctx context.Context, rar v1beta1.AdmissionReview, config string) (*v1beta1.AdmissionResponse, *httpError) {
+	if ctx.Err() == context.DeadlineExceeded {
+		return toAdmissionErrorResponse(ConfigTelegrafError + ": timed out"), nil
+	}
+
+	allowed := &v1beta1.AdmissionResponse{
+		UID:     rar.Request.UID,
+		Allowed: true,
+	}
+	if s.telegrafPath == "" {
+		return allowed, nil
+	}
+
+	result := "error"
+	start := time.Now()
+	defer func() {
+		s.metrics.telegrafDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+	}()
+
+	select {
+	case s.telegrafSem <- struct{}{}:
+		defer func() { <-s.telegrafSem }()
+	case <-ctx.Done():
+		result = "busy"
+		return nil, errTelegrafBusy
+	}
+
+	dir, err := ioutil.TempDir("", "telegraf-validate-")
+	if err != nil {
+		return nil, errUnableToWriteConfig
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "telegraf.conf")
+	err = ioutil.WriteFile(path, []byte(config), 0600)
+	if err != nil {
+		return nil, errUnableToWriteConfig
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.telegrafPath, "--config", path, "--test")
+	cmd.Dir = dir
+	cmd.Env = []string{}
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		result = "timeout"
+		return toAdmissionErrorResponse(ConfigTelegrafError + ": timed out"), nil
+	}
+	if err != nil {
+		result = "invalid"
+		msg := sanitizeTelegrafError(stderr.String(), dir)
+		if msg == "" {
+			return toAdmissionErrorResponse(ConfigTelegrafError), nil
+		}
+		return toAdmissionErrorResponse(ConfigTelegrafError + ": " + msg), nil
+	}
+
+	result = "valid"
+	return allowed, nil
+}
+
+// sanitizeTelegrafError removes log prefixes, the temp directory and
+// non-printable characters from telegraf's stderr and joins it into a
+// single bounded line.
+func sanitizeTelegrafError(stderr, dir string) string {
+	stderr = strings.Replace(stderr, dir+string(filepath.Separator), "", -1)
+	stderr = telegrafLogPrefix.ReplaceAllString(stderr, "")
+
+	var lines []string
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.Map(func(r rune) rune {
+			if r < ' ' || r == 0x7f {
+				return -1
+			}
+			return r
+		}, line)
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	msg := strings.Join(lines, "; ")
+	if len(msg) > maxTelegrafErrorLength {
+		msg = msg[:maxTelegrafErrorLength] + "..."
+	}
+	return msg
+}
@@ -0,0 +1,226 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/knative/observability/pkg/webhook"
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestTelegrafExec(t *testing.T) {
+	spec := `{
+		"inputs": [ {
+			"commands": [ "echo", "5" ],
+			"type": "exec"
+		}, {
+			"urls": [ "http://10.0.0.1/metrics" ],
+			"type": "http"
+		}, {
+			"address": "http://10.0.0.1",
+			"type": "http_response"
+		}, {
+			"urls": [ "http://10.0.0.1/metrics" ],
+			"type": "prometheus"
+		}, {
+			"endpoint": "unix:///var/run/docker.sock",
+			"type": "docker"
+		}, {
+			"pattern": "telegraf",
+			"type": "procstat"
+		}, {
+			"type": "not-a-plugin"
+		}, {
+			"type": "cpu"
+		} ],
+		"outputs": [ {
+			"type": "discard"
+		} ]
+	}`
+
+	tests := []struct {
+		name     string
+		script   string
+		opts     []webhook.ServerOpt
+		allowed  bool
+		expected string
+	}{
+		{
+			name:    "it allows configs telegraf accepts",
+			script:  "exit 0",
+			allowed: true,
+		},
+		{
+			name: "it returns sanitized stderr",
+			script: `echo "2019-07-01T00:00:00Z E! Error parsing $2, line 3: bad" >&2
+printf 'second\033 line\n' >&2
+exit 1`,
+			expected: webhook.ConfigTelegrafError + ": Error parsing telegraf.conf, line 3: bad; second line",
+		},
+		{
+			name: "it only runs side effect free inputs",
+			script: `grep -qE 'inputs\.(exec|http|http_response|prometheus|docker|procstat|not-a-plugin)\]' "$2" && echo "ran input" >&2 && exit 1
+grep -q 'inputs\.cpu\]' "$2" || { echo "missing cpu" >&2; exit 1; }
+exit 0`,
+			allowed:  true,
+			expected: "",
+		},
+		{
+			name:     "it runs telegraf without the validator environment",
+			script:   `[ -n "$VALIDATOR_SECRET" ] && echo "environment leaked" >&2 && exit 1; exit 0`,
+			allowed:  true,
+			expected: "",
+		},
+		{
+			name:     "it times out slow runs",
+			script:   "exec sleep 5",
+			opts:     []webhook.ServerOpt{webhook.WithTelegrafTimeout(50 * time.Millisecond)},
+			expected: webhook.ConfigTelegrafError + ": timed out",
+		},
+	}
+
+	os.Setenv("VALIDATOR_SECRET", "secret")
+	defer os.Unsetenv("VALIDATOR_SECRET")
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			telegraf := fakeTelegraf(t, test.script)
+			opts := append([]webhook.ServerOpt{webhook.WithTelegrafBinary(telegraf)}, test.opts...)
+			server := webhook.NewServer("127.0.0.1:0", opts...)
+			server.Run(false)
+			defer server.Close()
+
+			var (
+				err  error
+				resp *http.Response
+			)
+			for i := 0; i < 100; i++ {
+				resp, err = http.Post(
+					"http://"+server.Addr()+"/metricsink",
+					"application/json",
+					strings.NewReader(fmt.Sprintf(clusterMetricAdmissionTemplate, spec)),
+				)
+				if err == nil {
+					break
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			var actualResp v1beta1.AdmissionReview
+			err = json.NewDecoder(resp.Body).Decode(&actualResp)
+			if err != nil {
+				t.Fatalf("unable to decode resp body: %s", err)
+			}
+
+			if actualResp.Response.Allowed != test.allowed {
+				t.Errorf("expected allowed to be %t, got %t: %v", test.allowed, actualResp.Response.Allowed, actualResp.Response.Result)
+			}
+			if test.allowed {
+				return
+			}
+			if actualResp.Response.Result.Message != test.expected {
+				t.Errorf("expected message %q, got %q", test.expected, actualResp.Response.Result.Message)
+			}
+		})
+	}
+}
+
+func TestTelegrafTimeoutCoversValidation(t *testing.T) {
+	p, err := webhook.ParseDestinationPolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := webhook.NewPolicyStore("destination-policy")
+	ps.Set(p)
+
+	server := webhook.NewServer(
+		"127.0.0.1:0",
+		webhook.WithTelegrafBinary(fakeTelegraf(t, "exit 0")),
+		webhook.WithTelegrafTimeout(50*time.Millisecond),
+		webhook.WithDestinationPolicy(ps, slowNamespaces{
+			delay:      100 * time.Millisecond,
+			namespaces: spyNamespaces{"open": {}},
+		}),
+	)
+	server.Run(false)
+	defer server.Close()
+
+	object := `{
+		"metadata": {"name": "sink", "namespace": "open"},
+		"spec": {
+			"inputs": [{"type": "cpu"}],
+			"outputs": [{"type": "discard"}]
+		}
+	}`
+	review := postProbeReview(t, server, "/metricsink", fmt.Sprintf(mutateAdmissionTemplate, "MetricSink", "metricsinks", object))
+
+	if review.Response.Allowed {
+		t.Fatal("expected response to be disallowed, got allowed")
+	}
+	if review.Response.Result.Message != webhook.ConfigTelegrafError+": timed out" {
+		t.Errorf("expected a timeout, got %q", review.Response.Result.Message)
+	}
+}
+
+func TestUnknownTelegrafPlugins(t *testing.T) {
+	server := webhook.NewServer("127.0.0.1:0", webhook.WithTelegrafBinary(fakeTelegraf(t, "exit 0")))
+	server.Run(false)
+	defer server.Close()
+
+	object := `{
+		"metadata": {"name": "sink"},
+		"spec": {
+			"inputs": [{"type": "cpu"}, {"type": "nvidia_smi", "bin_path": "/usr/bin/nvidia-smi"}],
+			"outputs": [{"type": "opentsdb", "host": "tcp://opentsdb.example.com"}]
+		}
+	}`
+	review := postProbeReview(t, server, "/metricsink", fmt.Sprintf(mutateAdmissionTemplate, "ClusterMetricSink", "clustermetricsinks", object))
+
+	if !review.Response.Allowed {
+		t.Fatalf("expected response to be allowed, got %v", review.Response.Result)
+	}
+	expected := []string{
+		"inputs.nvidia_smi: unknown plugin, its options were not validated",
+		"outputs.opentsdb: unknown plugin, its options were not validated",
+	}
+	if fmt.Sprint(review.Response.Warnings) != fmt.Sprint(expected) {
+		t.Errorf("expected warnings %v, got %v", expected, review.Response.Warnings)
+	}
+}
+
+type slowNamespaces struct {
+	delay      time.Duration
+	namespaces spyNamespaces
+}
+
+func (s slowNamespaces) Get(name string) (*corev1.Namespace, error) {
+	time.Sleep(s.delay)
+	return s.namespaces.Get(name)
+}
+
+func fakeTelegraf(t *testing.T, script string) string {
+	dir, err := ioutil.TempDir("", "fake-telegraf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "telegraf")
+	err = ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
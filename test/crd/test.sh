@@ -41,6 +41,9 @@ function cleanup {
     if [ "$created_cluster_log_sink_crd" -eq 0 ]; then
         kubectl delete -f "$working_dir/../config/100-cluster-log-sink-crd.yaml" > /dev/null 2>&1
     fi
+    if [ "$created_log_parser_crd" -eq 0 ]; then
+        kubectl delete -f "$working_dir/../config/100-log-parser-crd.yaml" > /dev/null 2>&1
+    fi
 }
 trap cleanup EXIT
 
@@ -50,6 +53,8 @@ kubectl create -f "$working_dir/../config/100-log-sink-crd.yaml" > /dev/null 2>&
 created_log_sink_crd=$?
 kubectl create -f "$working_dir/../config/100-cluster-log-sink-crd.yaml" > /dev/null 2>&1
 created_cluster_log_sink_crd=$?
+kubectl create -f "$working_dir/../config/100-log-parser-crd.yaml" > /dev/null 2>&1
+created_log_parser_crd=$?
 set -e
 
 failed=false